@@ -0,0 +1,37 @@
+package client
+
+// Accounts remembers the account the user last logged in with to each provider, to hint it to the issuer on the next
+// logins. It is safe for concurrent use and a nil Accounts remembers nothing.
+type Accounts struct {
+	file *stateFile
+}
+
+// NewAccounts returns the accounts saved in the file at path.
+func NewAccounts(path string) *Accounts {
+	return &Accounts{file: newStateFile(path, "accounts")}
+}
+
+// Get returns the account remembered for the provider, if any.
+func (a *Accounts) Get(providerName string) (string, error) {
+	if a == nil {
+		return "", nil
+	}
+	accounts := make(map[string]string)
+	err := a.file.view(&accounts)
+	return accounts[providerName], err
+}
+
+// Put remembers the account of the provider.
+func (a *Accounts) Put(providerName, account string) error {
+	if a == nil {
+		return nil
+	}
+	accounts := make(map[string]string)
+	return a.file.update(&accounts, func() bool {
+		if accounts[providerName] == account {
+			return false
+		}
+		accounts[providerName] = account
+		return true
+	})
+}
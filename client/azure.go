@@ -8,8 +8,13 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/SermoDigital/jose/jws"
+	"github.com/SermoDigital/jose/jwt"
+	log "github.com/sirupsen/logrus"
 	"github.com/sky-uk/osprey/v2/client/oidc"
 	"github.com/sky-uk/osprey/v2/common/pb"
 	"github.com/sky-uk/osprey/v2/common/web"
@@ -21,132 +26,609 @@ const (
 	// AzureProviderName is the constant string value for the azure provider
 	AzureProviderName         = "azure"
 	wellKnownConfigurationURI = "v2.0/.well-known/openid-configuration"
+	// azureUsernameClaim is the claim the username is taken from unless the provider or GKE ClientConfig sets one
+	azureUsernameClaim = "unique_name"
+	// azureV1IssuerFormat is the issuer of the v1 tokens of a tenant
+	azureV1IssuerFormat = "https://sts.windows.net/%s/"
+	// maxClusterRefreshDelay bounds the back-off of the background refreshes of the cached cluster details
+	maxClusterRefreshDelay = 4 * time.Second
 )
 
-// AzureConfig holds the configuration for Azure
-type AzureConfig struct {
-	// Name provides a named reference to the provider. For e.g sky-azure, nbcu-azure etc. Optional field
-	Name string `yaml:"name,omitempty"`
+// AzureOptions holds the options specific to providers of type azure.
+// The oidc settings are only optional if all the targets use the GKE ClientConfig, which configures the ones not set.
+type AzureOptions struct {
 	// ServerApplicationID is the oidc-client-id used on the apiserver configuration
-	ServerApplicationID string `yaml:"server-application-id,omitempty"`
+	ServerApplicationID string `yaml:"server-application-id"`
 	// ClientID is the oidc client id used for osprey
-	ClientID string `yaml:"client-id,omitempty"`
+	ClientID string `yaml:"client-id"`
 	// ClientSecret is the oidc client secret used for osprey
-	ClientSecret string `yaml:"client-secret,omitempty"`
-	// CertificateAuthority is the filesystem path from which to read the CA certificate
-	CertificateAuthority string `yaml:"certificate-authority,omitempty"`
-	// CertificateAuthorityData is base64-encoded CA cert data.
-	// This will override any cert file specified in CertificateAuthority.
-	// +optional
-	CertificateAuthorityData string `yaml:"certificate-authority-data,omitempty"`
+	ClientSecret string `yaml:"client-secret"`
 	// RedirectURI is the redirect URI that the oidc application is configured to call back to
-	RedirectURI string `yaml:"redirect-uri,omitempty"`
+	RedirectURI string `yaml:"redirect-uri"`
+	// LoopbackRedirect receives the redirects of the browser login on an ephemeral port of the IPv4 or IPv6 loopback
+	// IP, 127.0.0.1 or [::1], instead of the host and port of the RedirectURI, as allowed for public clients by
+	// RFC 8252. The path of the RedirectURI is kept, and defaults to /auth/callback.
+	// +optional
+	LoopbackRedirect string `yaml:"loopback-redirect,omitempty" jsonschema:"enum=ipv4|ipv6"`
 	// Scopes is the list of scopes to request when performing the oidc login request
 	Scopes []string `yaml:"scopes"`
 	// AzureTenantID is the Azure Tenant ID assigned to your organisation
-	AzureTenantID string `yaml:"tenant-id,omitempty"`
+	AzureTenantID string `yaml:"tenant-id"`
 	// IssuerURL is the URL of the OpenID server. This is mainly used for testing.
 	// +optional
 	IssuerURL string `yaml:"issuer-url,omitempty"`
-	// Targets contains a map of strings to osprey targets
-	Targets map[string]*TargetEntry `yaml:"targets"`
+	// LoginHint is the account the issuer logs in with, or preselects. Defaults to the account the user last logged
+	// in with to the provider.
+	// +optional
+	LoginHint string `yaml:"login-hint,omitempty"`
+	// DomainHint skips the account discovery of Azure AD, e.g. contoso.com, or consumers for personal accounts
+	// +optional
+	DomainHint string `yaml:"domain-hint,omitempty"`
+	// Prompt asks the issuer to let the user select the account, select_account, enter their credentials again,
+	// login, or grant the permissions again, consent
+	// +optional
+	Prompt string `yaml:"prompt,omitempty" jsonschema:"enum=select_account|login|consent"`
+	// GroupsOverageURL is the URL of a Graph-compatible memberOf endpoint that lists the groups of the users whose
+	// token has too many groups to list them, e.g. https://graph.microsoft.com/v1.0/me/memberOf. Defaults to the
+	// endpoint of the token's _claim_sources.
+	// +optional
+	GroupsOverageURL string `yaml:"groups-overage-url,omitempty"`
 }
 
-// ValidateConfig checks that the required configuration has been provided for Azure
-func (ac *AzureConfig) ValidateConfig() error {
-	if len(ac.Targets) == 0 {
+func (ao *AzureOptions) validate(targets map[string]*TargetEntry) error {
+	if len(targets) == 0 {
 		return errors.New("at least one target server should be present for azure")
 	}
-	if ac.AzureTenantID == "" {
-		return errors.New("tenant-id is required for azure targets")
-	}
-	if ac.ServerApplicationID == "" {
-		return errors.New("server-application-id is required for azure targets")
+	if !allUseGKEClientConfig(targets) {
+		if ao.AzureTenantID == "" {
+			return errors.New("tenant-id is required for azure targets")
+		}
+		if ao.ServerApplicationID == "" {
+			return errors.New("server-application-id is required for azure targets")
+		}
+		if ao.ClientID == "" || ao.ClientSecret == "" {
+			return errors.New("oauth2 clientid and client-secret must be supplied for azure targets")
+		}
+		if ao.RedirectURI == "" && ao.LoopbackRedirect == "" {
+			return errors.New("oauth2 redirect-uri is required for azure targets")
+		}
 	}
-	if ac.ClientID == "" || ac.ClientSecret == "" {
-		return errors.New("oauth2 clientid and client-secret must be supplied for azure targets")
+	if _, err := loopbackIP(ao.LoopbackRedirect); err != nil {
+		return err
 	}
-	if ac.RedirectURI == "" {
-		return errors.New("oauth2 redirect-uri is required for azure targets")
+	if err := validatePrompt(ao.Prompt); err != nil {
+		return err
 	}
 
-	for name, target := range ac.Targets {
+	for name, target := range targets {
+		if target.ClientCertificate != "" || target.ClientKey != "" {
+			return fmt.Errorf("%s: client-certificate and client-key are only supported for osprey targets", name)
+		}
+		if target.IssuerURL != "" || target.ClientID != "" || target.IssuerCAData != "" {
+			return fmt.Errorf("%s: issuer-url, client-id and issuer-ca-data are only supported for osprey targets", name)
+		}
+		if discoveryModes(target) != 1 {
+			return fmt.Errorf("%s: exactly one of server, api-server or api-server-url must be set for azure targets", name)
+		}
 		if target.UseGKEClientConfig && target.APIServer == "" {
 			return fmt.Errorf("%s: use-gke-clientconfig:true requires api-server to be set", name)
 		}
+		if target.GKEAuthentication != "" && !target.UseGKEClientConfig {
+			return fmt.Errorf("%s: gke-authentication requires use-gke-clientconfig:true", name)
+		}
+		if err := validateKubeadmDiscovery(name, target); err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
-// NewAzureRetriever creates new Azure oAuth client
-func NewAzureRetriever(provider *ProviderConfig, options RetrieverOptions) (Retriever, error) {
-	if provider.issuerURL == "" {
-		provider.issuerURL = fmt.Sprintf("https://login.microsoftonline.com/%s/%s", provider.azureTenantID, wellKnownConfigurationURI)
-	} else {
-		provider.issuerURL = fmt.Sprintf("%s/%s", provider.issuerURL, wellKnownConfigurationURI)
+func allUseGKEClientConfig(targets map[string]*TargetEntry) bool {
+	for _, target := range targets {
+		if !target.UseGKEClientConfig {
+			return false
+		}
 	}
+	return true
+}
 
-	oidcEndpoint, err := oidc.GetWellKnownConfig(provider.issuerURL)
-	if err != nil {
-		return nil, fmt.Errorf("unable to query well-known oidc config: %w", err)
+// loopbackIP returns the loopback IP of the loopback-redirect option, if set
+func loopbackIP(loopbackRedirect string) (string, error) {
+	switch web.IPFamily(loopbackRedirect) {
+	case "":
+		return "", nil
+	case web.IPFamilyIPv4:
+		return "127.0.0.1", nil
+	case web.IPFamilyIPv6:
+		return "::1", nil
+	default:
+		return "", fmt.Errorf("invalid loopback-redirect %q: must be ipv4 or ipv6", loopbackRedirect)
+	}
+}
+
+func validatePrompt(prompt string) error {
+	switch prompt {
+	case "", "select_account", "login", "consent":
+		return nil
+	default:
+		return fmt.Errorf("invalid prompt %q: must be one of select_account, login or consent", prompt)
+	}
+}
+
+// hasIssuer returns true if the provider sets the tenant or the issuer to log in with
+func (ao *AzureOptions) hasIssuer() bool {
+	return ao.AzureTenantID != "" || ao.IssuerURL != ""
+}
+
+// wellKnownConfigurationURL returns the URL of the OpenID discovery document of the tenant, or of the IssuerURL if set.
+func (ao *AzureOptions) wellKnownConfigurationURL() string {
+	if ao.IssuerURL == "" {
+		return fmt.Sprintf("https://login.microsoftonline.com/%s/%s", ao.AzureTenantID, wellKnownConfigurationURI)
 	}
+	return fmt.Sprintf("%s/%s", ao.IssuerURL, wellKnownConfigurationURI)
+}
+
+// oidcSettings configure the oidc login of a target, from its provider and, for GKE targets, from the authentication
+// of the ClientConfig
+type oidcSettings struct {
+	wellKnownURL string
+	// issuerCA is the base64-encoded CA of the issuer, trusted in addition to the system certs
+	issuerCA     string
+	clientID     string
+	clientSecret string
+	redirectURI  string
+	// loopbackIP receives the redirects on an ephemeral port instead of the host and port of the redirectURI
+	loopbackIP string
+	scopes     []string
+	// usernameClaim and groupsClaim are the claims of the provider or ClientConfig, empty for the defaults
+	usernameClaim string
+	groupsClaim   string
+	// tokenType is the token written to the kubeconfig, id or access, empty for the default
+	tokenType string
+	// audience is the aud claim the access tokens must have, named by audienceName in the verification errors
+	audience     string
+	audienceName string
+}
+
+func (p *ProviderConfig) oidcSettings() oidcSettings {
+	ao := p.azure
+	loopbackIP, _ := loopbackIP(ao.LoopbackRedirect)
+	settings := oidcSettings{
+		clientID:      ao.ClientID,
+		clientSecret:  ao.ClientSecret,
+		redirectURI:   ao.RedirectURI,
+		loopbackIP:    loopbackIP,
+		scopes:        ao.Scopes,
+		usernameClaim: p.usernameClaim,
+		groupsClaim:   p.groupsClaim,
+		tokenType:     p.tokenType,
+		audience:      ao.ServerApplicationID,
+		audienceName:  "server-application-id",
+	}
+	if ao.hasIssuer() {
+		settings.wellKnownURL = ao.wellKnownConfigurationURL()
+	}
+	return settings
+}
+
+// withGKEAuthentication returns the settings with the ones not set on the provider taken from the oidc authentication
+// of a GKE ClientConfig, including the claims the API server uses. GKE Identity Service validates the id tokens of
+// the ClientConfig's client, which are written unless the provider sets its own server-application-id or token-type.
+func (s oidcSettings) withGKEAuthentication(authentication *clientConfigOIDC) oidcSettings {
+	if s.wellKnownURL == "" && authentication.IssuerURI != "" {
+		s.wellKnownURL = authentication.wellKnownConfigurationURL()
+		s.issuerCA = authentication.CertificateAuthorityData
+	}
+	if s.clientID == "" {
+		s.clientID = authentication.ClientID
+	}
+	if s.clientSecret == "" {
+		s.clientSecret = authentication.ClientSecret
+	}
+	if s.redirectURI == "" {
+		s.redirectURI = authentication.KubectlRedirectURI
+	}
+	if len(s.scopes) == 0 {
+		s.scopes = authentication.scopes()
+	}
+	if s.usernameClaim == "" {
+		s.usernameClaim = authentication.UserClaim
+	}
+	if s.groupsClaim == "" {
+		s.groupsClaim = authentication.GroupsClaim
+	}
+	if s.tokenType == "" && s.audience == "" {
+		s.tokenType = IDTokenType
+	}
+	if s.audience == "" {
+		s.audience = authentication.ClientID
+		s.audienceName = "client id of the GKE ClientConfig"
+	}
+	return s
+}
+
+func (s oidcSettings) validate() error {
+	var missing []string
+	if s.wellKnownURL == "" {
+		missing = append(missing, "issuer")
+	}
+	if s.clientID == "" {
+		missing = append(missing, "client id")
+	}
+	if s.redirectURI == "" && s.loopbackIP == "" {
+		missing = append(missing, "redirect uri")
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("the oidc login has no %s, set them on the provider or in the authentication of the GKE ClientConfig",
+			strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+func (s oidcSettings) key() string {
+	return strings.Join([]string{s.wellKnownURL, s.issuerCA, s.clientID, s.clientSecret, s.redirectURI,
+		s.loopbackIP, strings.Join(s.scopes, " "), s.usernameClaim, s.tokenType, s.audience}, "\n")
+}
+
+// usernameClaimOrDefault returns the claim the API server takes the username from
+func (s oidcSettings) usernameClaimOrDefault() string {
+	if s.usernameClaim == "" {
+		return azureUsernameClaim
+	}
+	return s.usernameClaim
+}
 
+// groupsClaimOrDefault returns the claim the API server takes the groups from
+func (s oidcSettings) groupsClaimOrDefault() string {
+	if s.groupsClaim == "" {
+		return defaultGroupsClaim
+	}
+	return s.groupsClaim
+}
+
+// tokenTypeOrDefault returns the type of the token written to the kubeconfig
+func (s oidcSettings) tokenTypeOrDefault() string {
+	if s.tokenType == "" {
+		return AccessTokenType
+	}
+	return s.tokenType
+}
+
+// tokenAudience returns the audience of the tokens written to the kubeconfig, and the setting it comes from: the
+// client id for the id tokens and the server application id for the access tokens
+func (s oidcSettings) tokenAudience() (string, string) {
+	if s.tokenTypeOrDefault() == IDTokenType {
+		return s.clientID, "client-id"
+	}
+	return s.audience, s.audienceName
+}
+
+// NewAzureRetriever creates new Azure oAuth client
+func NewAzureRetriever(provider *ProviderConfig, options RetrieverOptions) (Retriever, error) {
+	azure := provider.azure
+	hints, err := azure.loginHints(profileKey(provider.name, options.Profile), provider.profile(options.Profile), options)
+	if err != nil {
+		return nil, err
+	}
 	retriever := &azureRetriever{
-		oidc: oidc.New(oidc.Config{
-			Config: oauth2.Config{
-				ClientID:     provider.clientID,
-				ClientSecret: provider.clientSecret,
-				Endpoint:     *oidcEndpoint,
-				RedirectURL:  provider.redirectURI,
-				Scopes:       provider.scopes,
-			},
-			LoginTimeout:        options.LoginTimeout,
-			UseDeviceCode:       options.UseDeviceCode,
-			DisableBrowserPopup: options.DisableBrowserPopup,
-		}),
-		tenantID: provider.azureTenantID,
+		settings:     provider.oidcSettings(),
+		providerName: provider.name,
+		profile:      options.Profile,
+		proxyURL:     provider.proxyURL,
+		options:      options,
+		clients:      make(map[string]*oidc.Client),
+		verifiers:    make(map[string]*oidc.Verifier),
+		tenantID:     azure.AzureTenantID,
+		knownCAs:     options.KnownCAs,
+		acceptNewCA:  options.AcceptNewCA,
+		clusterCache: options.ClusterCache,
+		memberOfURL:  azure.GroupsOverageURL,
+		groupsCache:  options.GroupsCache,
+		hints:        hints,
+		accounts:     options.Accounts,
+	}
+	if retriever.settings.validate() == nil {
+		// the issuer of the provider is checked upfront, the ones of the GKE ClientConfigs when logging in
+		if _, _, err := retriever.oidcClient(retriever.settings); err != nil {
+			return nil, err
+		}
 	}
 	return retriever, nil
 }
 
 type azureRetriever struct {
-	oidc     *oidc.Client
-	tenantID string
+	// settings are the oidc settings of the provider
+	settings     oidcSettings
+	providerName string
+	// profile is the profile the user logs in with, "" for the default one
+	profile  string
+	proxyURL string
+	options  RetrieverOptions
+	// clients are the oidc clients by settings, shared by the targets so that the user logs in once per issuer
+	clients map[string]*oidc.Client
+	// verifiers verify the tokens of the clients of the same settings
+	verifiers    map[string]*oidc.Verifier
+	muClients    sync.Mutex
+	tenantID     string
+	knownCAs     *KnownCAs
+	acceptNewCA  bool
+	clusterCache *ClusterCache
+	memberOfURL  string
+	groupsCache  *GroupsCache
+	hints        loginHints
+	accounts     *Accounts
+	// account is the account the user logged in with, checked against the login hint once
+	account   string
+	muAccount sync.Mutex
+}
+
+// loginHints are the parameters of the authorization requests that select the account to log in with
+type loginHints struct {
+	loginHint  string
+	domainHint string
+	prompt     string
 }
 
-func (r *azureRetriever) RetrieveUserDetails(target Target, authInfo api.AuthInfo) (*UserInfo, error) {
+// loginHints returns the hints of the login options, or else of the profile, or else of the provider. The login hint
+// defaults to the account the user last logged in with, remembered under accountKey.
+func (ao *AzureOptions) loginHints(accountKey string, profile *ProfileEntry, options RetrieverOptions) (loginHints, error) {
+	hints := loginHints{loginHint: ao.LoginHint, domainHint: ao.DomainHint, prompt: ao.Prompt}
+	if profile != nil {
+		if profile.LoginHint != "" {
+			hints.loginHint = profile.LoginHint
+		}
+		if profile.DomainHint != "" {
+			hints.domainHint = profile.DomainHint
+		}
+		if profile.Prompt != "" {
+			hints.prompt = profile.Prompt
+		}
+	}
+	if options.LoginHint != "" {
+		hints.loginHint = options.LoginHint
+	}
+	if options.DomainHint != "" {
+		hints.domainHint = options.DomainHint
+	}
+	if options.Prompt != "" {
+		hints.prompt = options.Prompt
+	}
+	if err := validatePrompt(hints.prompt); err != nil {
+		return hints, err
+	}
+	if hints.loginHint == "" {
+		account, err := options.Accounts.Get(accountKey)
+		if err != nil {
+			log.Warnf("Failed to read the account last logged in with to %s: %v", accountKey, err)
+		}
+		hints.loginHint = account
+	}
+	return hints, nil
+}
+
+func (h loginHints) authCodeOptions() []oauth2.AuthCodeOption {
+	var options []oauth2.AuthCodeOption
+	if h.loginHint != "" {
+		options = append(options, oauth2.SetAuthURLParam("login_hint", h.loginHint))
+	}
+	if h.domainHint != "" {
+		options = append(options, oauth2.SetAuthURLParam("domain_hint", h.domainHint))
+	}
+	if h.prompt != "" {
+		options = append(options, oauth2.SetAuthURLParam("prompt", h.prompt))
+	}
+	return options
+}
+
+// loginDescription names the login of the settings to the user, with the tenant or the issuer being authenticated
+func (r *azureRetriever) loginDescription(settings oidcSettings) string {
+	if r.tenantID != "" && settings.wellKnownURL == r.settings.wellKnownURL {
+		return fmt.Sprintf("%s (tenant %s)", r.providerName, r.tenantID)
+	}
+	return fmt.Sprintf("%s (issuer %s)", r.providerName,
+		strings.TrimSuffix(settings.wellKnownURL, "/.well-known/openid-configuration"))
+}
+
+// oidcClient returns the oidc client of the settings and the verifier of its tokens, creating them on first use
+func (r *azureRetriever) oidcClient(settings oidcSettings) (*oidc.Client, *oidc.Verifier, error) {
+	if err := settings.validate(); err != nil {
+		return nil, nil, err
+	}
+	r.muClients.Lock()
+	defer r.muClients.Unlock()
+
+	key := settings.key()
+	if client, ok := r.clients[key]; ok {
+		return client, r.verifiers[key], nil
+	}
+	httpClient, err := web.NewClient(web.ClientOptions{CACerts: []string{settings.issuerCA}, ProxyURL: r.proxyURL})
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to create the issuer client: %w", err)
+	}
+	endpoints, err := oidc.GetEndpointsWithClient(httpClient, settings.wellKnownURL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to query well-known oidc config: %w", err)
+	}
+	if endpoints.Issuer == "" || endpoints.JWKSURL == "" {
+		return nil, nil, fmt.Errorf("the well-known oidc config %s has no issuer or jwks_uri to verify the tokens with",
+			settings.wellKnownURL)
+	}
+	issuers := []string{endpoints.Issuer}
+	if r.tenantID != "" && settings.wellKnownURL == r.settings.wellKnownURL {
+		// the v1 access tokens of the tenant, the default of the Azure applications, are issued by the v1 issuer
+		issuers = append(issuers, fmt.Sprintf(azureV1IssuerFormat, r.tenantID))
+	}
+	audience, audienceName := settings.tokenAudience()
+	verifier := oidc.NewVerifier(oidc.VerifierConfig{
+		Issuers:       issuers,
+		JWKSURL:       endpoints.JWKSURL,
+		Audience:      audience,
+		AudienceName:  audienceName,
+		UsernameClaim: settings.usernameClaimOrDefault(),
+		HTTPClient:    httpClient,
+	})
+	client := oidc.New(oidc.Config{
+		Config: oauth2.Config{
+			ClientID:     settings.clientID,
+			ClientSecret: settings.clientSecret,
+			Endpoint:     endpoints.Endpoint,
+			RedirectURL:  settings.redirectURI,
+			Scopes:       settings.scopes,
+		},
+		LoginTimeout:        r.options.LoginTimeout,
+		UseDeviceCode:       r.options.UseDeviceCode,
+		DisableBrowserPopup: r.options.DisableBrowserPopup,
+		HTTPClient:          httpClient,
+		CallbackServer:      r.options.CallbackServer,
+		Description:         r.loginDescription(settings),
+		LoopbackIP:          settings.loopbackIP,
+		Manual:              r.options.Manual,
+		DeviceAuthURL:       endpoints.DeviceAuthURL,
+		AuthCodeOptions:     r.hints.authCodeOptions(),
+	})
+	r.clients[key] = client
+	r.verifiers[key] = verifier
+	return client, verifier, nil
+}
+
+func (r *azureRetriever) RetrieveUserDetails(target Target, profile string, authInfo api.AuthInfo) (*UserInfo, error) {
 	jwt, err := jws.ParseJWT([]byte(authInfo.Token))
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse user token for %s: %w", target.Name(), err)
 	}
 
-	if jwt.Claims().Get("unique_name") != nil {
-		user := jwt.Claims().Get("unique_name")
-		return &UserInfo{
-			Username: fmt.Sprintf("%s", user),
-		}, nil
+	usernameClaims := []string{r.settings.usernameClaim}
+	if r.settings.usernameClaim == "" {
+		// the claim of a GKE ClientConfig is only known on login, so the usual ones of the id tokens are tried too
+		usernameClaims = []string{azureUsernameClaim, "email", "preferred_username"}
+	}
+	for _, usernameClaim := range usernameClaims {
+		if jwt.Claims().Get(usernameClaim) != nil {
+			user := fmt.Sprintf("%s", jwt.Claims().Get(usernameClaim))
+			return &UserInfo{
+				Username: user,
+				Roles:    r.userGroups(target, profile, jwt.Claims(), user, r.settings.groupsClaimOrDefault()),
+			}, nil
+		}
 	}
 
-	return nil, fmt.Errorf("jwt does not contain the 'unique_name' field")
+	return nil, fmt.Errorf("jwt does not contain the '%s' field", usernameClaims[0])
 }
 
 func (r *azureRetriever) RetrieveClusterDetailsAndAuthTokens(target Target) (*TargetInfo, error) {
 	ctx := context.TODO()
 
-	token, err := r.oidc.Token(ctx)
+	// The cluster details are discovered in the background while the user logs in
+	discovery := make(chan discoveryResult, 1)
+	go func() {
+		cluster, err := r.discoverCluster(target)
+		discovery <- discoveryResult{cluster: cluster, err: err}
+	}()
+
+	settings := r.settings
+	var cluster *discoveredCluster
+	if target.ShouldConfigureForGKE() {
+		// The ClientConfig may configure the login, so it is waited for. Its issuer and client secret are only used
+		// once the CA it came with is trusted.
+		result := <-discovery
+		var err error
+		cluster, err = r.clusterDetails(target, result.cluster, result.err)
+		if err != nil {
+			if result.err != nil && settings.validate() != nil {
+				return nil, fmt.Errorf("unable to configure the oidc login from the GKE ClientConfig: %w", err)
+			}
+			return nil, err
+		}
+		if cluster.gke != nil {
+			authentication, err := cluster.gke.oidcAuthentication(target.GKEAuthentication())
+			if err != nil {
+				return nil, err
+			}
+			if authentication != nil {
+				settings = settings.withGKEAuthentication(authentication.OIDC)
+			}
+		} else if settings.validate() != nil {
+			return nil, fmt.Errorf("unable to configure the oidc login from the GKE ClientConfig: %w", result.err)
+		}
+	}
+
+	oidcClient, verifier, err := r.oidcClient(settings)
+	if err != nil {
+		return nil, err
+	}
+	token, err := oidcClient.Token(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to retrieve access token: %w", err)
 	}
+	// the token written to the kubeconfig is the one the API server validates, as set by the token-type
+	kubeconfigToken := token.AccessToken
+	if settings.tokenTypeOrDefault() == IDTokenType {
+		idToken, ok := token.Extra("id_token").(string)
+		if !ok || idToken == "" {
+			return nil, fmt.Errorf("%s returned no id token for the token-type id, add the openid scope to the provider",
+				r.loginDescription(settings))
+		}
+		kubeconfigToken = idToken
+	}
+	if err := verifier.Verify(ctx, kubeconfigToken); err != nil {
+		return nil, fmt.Errorf("failed to verify the %s token of %s: %w", settings.tokenTypeOrDefault(),
+			r.loginDescription(settings), err)
+	}
 
-	err = checkTokenForGroupsClaim(token.AccessToken)
+	r.checkAccount(kubeconfigToken, settings.usernameClaimOrDefault())
+	err = r.resolveGroupsOverage(ctx, target, oidcClient, token, kubeconfigToken, settings)
 	if err != nil {
 		return nil, err
 	}
 
-	var apiServerURL, apiServerCA string
+	if !target.ShouldConfigureForGKE() {
+		result := <-discovery
+		cluster, err = r.clusterDetails(target, result.cluster, result.err)
+		if err != nil {
+			return nil, err
+		}
+	}
 
-	if target.ShouldConfigureForGKE() {
-		tlsClient, err := web.NewTLSClient(target.ShouldSkipTLSVerify())
+	return &TargetInfo{
+		Username:            claimOf(kubeconfigToken, settings.usernameClaimOrDefault()),
+		AccessToken:         kubeconfigToken,
+		ClusterAPIServerURL: cluster.apiServerURL,
+		ClusterCA:           cluster.apiServerCA,
+		ProxyURL:            target.ProxyURL(),
+		TLSServerName:       target.TLSServerName(),
+		DisableCompression:  target.DisableCompression(),
+	}, nil
+}
+
+// discoveredCluster holds the API server URL and base64-encoded CA found for a target
+type discoveredCluster struct {
+	apiServerURL string
+	apiServerCA  string
+	// trustOnFirstUse is set when the CA could not be verified and must be checked against the known CAs
+	trustOnFirstUse bool
+	// gke is the spec of the GKE ClientConfig the details were found in, if any
+	gke *clientConfigSpec
+}
+
+type discoveryResult struct {
+	cluster *discoveredCluster
+	err     error
+}
+
+// discoverCluster returns the API server URL and CA of the target from its static details, the API server's
+// kube-public resources or the osprey server's cluster-info
+func (r *azureRetriever) discoverCluster(target Target) (*discoveredCluster, error) {
+	switch {
+	case target.ShouldUseStaticClusterDetails():
+		return &discoveredCluster{apiServerURL: target.APIServerURL(), apiServerCA: target.APIServerCAData()}, nil
+
+	case target.ShouldConfigureForGKE():
+		tlsClient, err := web.NewClient(web.ClientOptions{
+			SkipVerify:       target.ShouldSkipTLSVerify(),
+			ProxyURL:         target.ProxyURL(),
+			IPFamily:         target.IPFamily(),
+			PinnedPublicKeys: target.PinnedPublicKeys(),
+		})
 		if err != nil {
 			return nil, fmt.Errorf("unable to create TLS client: %w", err)
 		}
@@ -162,64 +644,174 @@ func (r *azureRetriever) RetrieveClusterDetailsAndAuthTokens(target Target) (*Ta
 		if err != nil {
 			return nil, err
 		}
-		apiServerURL = clientConfig.Spec.Server
-		apiServerCA = clientConfig.Spec.CaCertBase64
+		return &discoveredCluster{
+			apiServerURL:    clientConfig.Spec.Server,
+			apiServerCA:     clientConfig.Spec.CaCertBase64,
+			trustOnFirstUse: true,
+			gke:             &clientConfig.Spec,
+		}, nil
 
-	} else if target.ShouldFetchCAFromAPIServer() {
-		tlsClient, err := web.NewTLSClient(target.ShouldSkipTLSVerify())
+	case target.ShouldUseKubeadmClusterInfo():
+		// The CA of the API server is not known yet, the cluster-info is verified with the bootstrap token or the
+		// CA hashes instead, as kubeadm join does
+		tlsClient, err := web.NewClient(web.ClientOptions{
+			SkipVerify:       true,
+			ProxyURL:         target.ProxyURL(),
+			IPFamily:         target.IPFamily(),
+			PinnedPublicKeys: target.PinnedPublicKeys(),
+		})
 		if err != nil {
 			return nil, fmt.Errorf("unable to create TLS client: %w", err)
 		}
-		req, err := createKubePublicRequest(target.APIServer(), "api/v1", "configmaps", "kube-root-ca.crt")
+		req, err := createClusterInfoConfigMapRequest(target.APIServer())
 		if err != nil {
-			return nil, fmt.Errorf("unable to create API Server request for CA ConfigMap: %w", err)
+			return nil, fmt.Errorf("unable to create API Server request for cluster-info: %w", err)
 		}
 		resp, err := tlsClient.Do(req)
 		if err != nil {
-			return nil, fmt.Errorf("failed to retrieve CA from API Server endpoint: %w", err)
+			return nil, fmt.Errorf("failed to retrieve cluster-info from API Server endpoint: %w", err)
 		}
-		caConfigMap, err := r.consumeCAConfigMapResponse(resp)
+		clusterInfo, err := consumeClusterInfoConfigMapResponse(resp)
+		if err != nil {
+			return nil, err
+		}
+		cluster, err := clusterInfo.verify(target.BootstrapToken(), target.CACertHashes())
 		if err != nil {
 			return nil, err
 		}
-		apiServerURL = target.APIServer()
-		apiServerCA = base64.StdEncoding.EncodeToString([]byte(caConfigMap.Data.CACertData))
+		return &discoveredCluster{
+			apiServerURL: cluster.Server,
+			apiServerCA:  base64.StdEncoding.EncodeToString(cluster.CertificateAuthorityData),
+		}, nil
 
-	} else {
-		tlsClient, err := web.NewTLSClient(target.ShouldSkipTLSVerify(), target.CertificateAuthorityData())
+	case target.ShouldFetchCAFromAPIServer():
+		tlsClient, err := web.NewClient(web.ClientOptions{
+			SkipVerify:       target.ShouldSkipTLSVerify(),
+			ProxyURL:         target.ProxyURL(),
+			IPFamily:         target.IPFamily(),
+			PinnedPublicKeys: target.PinnedPublicKeys(),
+		})
 		if err != nil {
 			return nil, fmt.Errorf("unable to create TLS client: %w", err)
 		}
-
-		req, err := createClusterInfoRequest(target.Server())
+		req, err := createKubePublicRequest(target.APIServer(), "api/v1", "configmaps", "kube-root-ca.crt")
 		if err != nil {
-			return nil, fmt.Errorf("unable to create cluster-info request: %w", err)
+			return nil, fmt.Errorf("unable to create API Server request for CA ConfigMap: %w", err)
 		}
 		resp, err := tlsClient.Do(req)
 		if err != nil {
-			return nil, fmt.Errorf("failed to retrieve cluster-info: %w", err)
+			return nil, fmt.Errorf("failed to retrieve CA from API Server endpoint: %w", err)
 		}
-		clusterInfo, err := pb.ConsumeClusterInfoResponse(resp)
+		caConfigMap, err := r.consumeCAConfigMapResponse(resp)
 		if err != nil {
 			return nil, err
 		}
-		apiServerURL = clusterInfo.Cluster.ApiServerURL
-		apiServerCA = clusterInfo.Cluster.ApiServerCA
+		return &discoveredCluster{
+			apiServerURL:    target.APIServer(),
+			apiServerCA:     base64.StdEncoding.EncodeToString([]byte(caConfigMap.Data.CACertData)),
+			trustOnFirstUse: true,
+		}, nil
 	}
 
-	return &TargetInfo{
-		AccessToken:         token.AccessToken,
-		ClusterAPIServerURL: apiServerURL,
-		ClusterCA:           apiServerCA,
-	}, nil
+	tlsClient, err := web.NewClient(web.ClientOptions{
+		SkipVerify:       target.ShouldSkipTLSVerify(),
+		CACerts:          []string{target.CertificateAuthorityData()},
+		ProxyURL:         target.ProxyURL(),
+		IPFamily:         target.IPFamily(),
+		PinnedPublicKeys: target.PinnedPublicKeys(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to create TLS client: %w", err)
+	}
+
+	req, err := createClusterInfoRequest(target.Server())
+	if err != nil {
+		return nil, fmt.Errorf("unable to create cluster-info request: %w", err)
+	}
+	resp, err := tlsClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve cluster-info: %w", err)
+	}
+	clusterInfo, err := pb.ConsumeClusterInfoResponse(resp)
+	if err != nil {
+		return nil, err
+	}
+	return &discoveredCluster{apiServerURL: clusterInfo.Cluster.ApiServerURL, apiServerCA: clusterInfo.Cluster.ApiServerCA}, nil
 }
 
-type clientConfig struct {
-	Spec clientConfigSpec `json:"spec"`
+// clusterDetails verifies and caches the discovered cluster details of the target. If the discovery failed, it falls
+// back to the details cached for the target until they expire.
+func (r *azureRetriever) clusterDetails(target Target, cluster *discoveredCluster, discoveryErr error) (*discoveredCluster, error) {
+	if target.ShouldUseStaticClusterDetails() {
+		return cluster, discoveryErr
+	}
+	endpoint := target.discoveryEndpoint()
+	if discoveryErr != nil {
+		if errors.Is(discoveryErr, errClusterInfoSignature) || errors.Is(discoveryErr, errClusterInfoCACertHash) {
+			// the endpoint answered, but with details that can't be trusted
+			return nil, discoveryErr
+		}
+		cached, err := r.clusterCache.Get(target, r.profile, endpoint)
+		if err != nil {
+			log.Warnf("Failed to read the cached cluster details of %s: %v", target.Name(), err)
+		}
+		if cached == nil {
+			return nil, discoveryErr
+		}
+		log.Warnf("Using the cluster details of %s cached on %s while they are refreshed: %v", target.Name(),
+			cached.Discovered.Format(time.RFC3339), discoveryErr)
+		r.clusterCache.refresh(func() { r.refreshClusterDetails(target) })
+		return &discoveredCluster{apiServerURL: cached.APIServerURL, apiServerCA: cached.CertificateAuthorityData}, nil
+	}
+
+	if cluster.trustOnFirstUse {
+		if err := r.verifyKnownCA(target, cluster.apiServerCA); err != nil {
+			return nil, err
+		}
+	}
+	previous, err := r.clusterCache.Put(target, r.profile, &CachedCluster{
+		Endpoint:                 endpoint,
+		APIServerURL:             cluster.apiServerURL,
+		CertificateAuthorityData: cluster.apiServerCA,
+		Discovered:               time.Now(),
+	})
+	if err != nil {
+		log.Warnf("Failed to cache the cluster details of %s: %v", target.Name(), err)
+	} else if previous != nil && previous.Endpoint == endpoint && previous.CertificateAuthorityData != cluster.apiServerCA {
+		log.Warnf("The CA of the API server of %s changed since it was cached on %s, from %s to %s", target.Name(),
+			previous.Discovered.Format(time.RFC3339), caDataFingerprint(previous.CertificateAuthorityData),
+			caDataFingerprint(cluster.apiServerCA))
+	}
+	return cluster, nil
 }
-type clientConfigSpec struct {
-	Server       string `json:"server"`
-	CaCertBase64 string `json:"certificateAuthorityData"`
+
+// refreshClusterDetails retries the discovery of the cluster details of the target in the background, backing off up
+// to maxClusterRefreshDelay, and caches them once discovered
+func (r *azureRetriever) refreshClusterDetails(target Target) {
+	var err error
+	for delay := time.Second; delay <= maxClusterRefreshDelay; delay *= 2 {
+		time.Sleep(delay)
+		var cluster *discoveredCluster
+		if cluster, err = r.discoverCluster(target); err == nil {
+			if _, err = r.clusterDetails(target, cluster, nil); err == nil {
+				log.Infof("Refreshed the cached cluster details of %s", target.Name())
+				return
+			}
+			break
+		}
+		if errors.Is(err, errClusterInfoSignature) || errors.Is(err, errClusterInfoCACertHash) {
+			break
+		}
+	}
+	log.Warnf("Failed to refresh the cached cluster details of %s: %v", target.Name(), err)
+}
+
+// verifyKnownCA checks the CA fetched from the API server's kube-public namespace against the one trusted on first use
+func (r *azureRetriever) verifyKnownCA(target Target, apiServerCA string) error {
+	if r.knownCAs == nil {
+		return nil
+	}
+	return r.knownCAs.Verify(target, r.profile, target.APIServer(), apiServerCA, r.acceptNewCA)
 }
 
 func (r *azureRetriever) consumeClientConfigResponse(response *http.Response) (*clientConfig, error) {
@@ -229,29 +821,103 @@ func (r *azureRetriever) consumeClientConfigResponse(response *http.Response) (*
 			return nil, fmt.Errorf("failed to read ClientConfig response from API Server: %w", err)
 		}
 		defer response.Body.Close()
-		clientConfig := &clientConfig{}
-		err = json.Unmarshal(data, clientConfig)
-		if err != nil {
-			return nil, fmt.Errorf("failed to parse response: %w", err)
-		}
-		return clientConfig, nil
+		return parseClientConfig(data)
 	}
 	return nil, fmt.Errorf("error fetching ClientConfig from API Server: %s", response.Status)
 }
 
-func checkTokenForGroupsClaim(token string) error {
+// checkAccount warns when the user logged in with another account than the login hint, and remembers the account for
+// the next logins to the provider with the profile
+func (r *azureRetriever) checkAccount(token, usernameClaim string) {
 	jwt, err := jws.ParseJWT([]byte(token))
 	if err != nil {
-		return fmt.Errorf("oidc: malformed jwt: %v", err)
+		return
+	}
+	account, ok := jwt.Claims().Get(usernameClaim).(string)
+	if !ok {
+		return
 	}
+	r.muAccount.Lock()
+	defer r.muAccount.Unlock()
+	if account == r.account {
+		return
+	}
+	r.account = account
+	if r.hints.loginHint != "" && !strings.EqualFold(account, r.hints.loginHint) {
+		log.Warnf("Logged in to %s as %s instead of the expected account %s", r.providerName, account, r.hints.loginHint)
+	}
+	accountKey := profileKey(r.providerName, r.profile)
+	if err := r.accounts.Put(accountKey, account); err != nil {
+		log.Warnf("Failed to remember the account logged in with to %s: %v", accountKey, err)
+	}
+}
 
-	if jwt.Claims().Get("groups") == nil && jwt.Claims().Get("_claim_names") != nil {
-		return fmt.Errorf("users with more than 200 groups are not supported")
+// resolveGroupsOverage lists and caches the groups of the user if the token has too many to list them in its
+// groups claim. The groups are listed with an access token for the groups endpoint, redeemed with the refresh token
+// of the login, as the token of the login is for the API server. Failing to do so only warns, as the API server may
+// still authorize the user.
+func (r *azureRetriever) resolveGroupsOverage(ctx context.Context, target Target, oidcClient *oidc.Client,
+	loginToken *oauth2.Token, token string, settings oidcSettings) error {
+	jwt, err := jws.ParseJWT([]byte(token))
+	if err != nil {
+		return fmt.Errorf("oidc: malformed jwt: %v", err)
 	}
 
+	overage, claimSourceEndpoint := groupsOverage(jwt.Claims(), settings.groupsClaimOrDefault())
+	if !overage {
+		return nil
+	}
+	user := fmt.Sprintf("%v", jwt.Claims().Get(settings.usernameClaimOrDefault()))
+	httpClient, err := web.NewClient(web.ClientOptions{ProxyURL: r.proxyURL})
+	if err != nil {
+		return fmt.Errorf("unable to create the groups client: %w", err)
+	}
+	groups, err := r.resolveGroups(ctx, httpClient, oidcClient, loginToken, claimSourceEndpoint)
+	if err != nil {
+		log.Warnf("Unable to resolve the groups of %s for %s, the token has too many to list them: %v", user, target.Name(), err)
+		return nil
+	}
+	err = r.groupsCache.Put(target, r.profile, &CachedGroups{User: user, Groups: groups, Resolved: time.Now()})
+	if err != nil {
+		log.Warnf("Failed to cache the groups of %s for %s: %v", user, target.Name(), err)
+	}
 	return nil
 }
 
+// resolveGroups lists the groups of the user from the groups endpoint, with an access token of its scope
+func (r *azureRetriever) resolveGroups(ctx context.Context, httpClient *http.Client, oidcClient *oidc.Client,
+	loginToken *oauth2.Token, claimSourceEndpoint string) ([]string, error) {
+	endpoint, err := groupsEndpoint(r.memberOfURL, claimSourceEndpoint)
+	if err != nil {
+		return nil, err
+	}
+	scope, err := groupsScope(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	groupsToken, err := oidcClient.TokenForScopes(ctx, loginToken, scope)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get a token for %s: %w", scope, err)
+	}
+	return resolveGroups(httpClient, groupsToken.AccessToken, r.memberOfURL, claimSourceEndpoint)
+}
+
+// userGroups returns the groups of the token, or the ones resolved on the login with the profile if it has too many to
+// list them
+func (r *azureRetriever) userGroups(target Target, profile string, claims jwt.Claims, user, groupsClaim string) []string {
+	if groups, ok := claimGroups(claims.Get(groupsClaim)); ok {
+		return groups
+	}
+	cached, err := r.groupsCache.Get(target, profile, user)
+	if err != nil {
+		log.Warnf("Failed to read the cached groups of %s: %v", target.Name(), err)
+	}
+	if cached == nil {
+		return nil
+	}
+	return cached.Groups
+}
+
 type configMap struct {
 	Data configMapData `json:"data"`
 }
@@ -276,8 +942,8 @@ func (r *azureRetriever) consumeCAConfigMapResponse(response *http.Response) (*c
 	return nil, fmt.Errorf("error fetching CA ConfigMap from API Server: %s", response.Status)
 }
 
-func (r *azureRetriever) GetAuthInfo(config *api.Config, target Target) *api.AuthInfo {
-	authInfo := config.AuthInfos[target.Name()]
+func (r *azureRetriever) GetAuthInfo(config *api.Config, user string) *api.AuthInfo {
+	authInfo := config.AuthInfos[user]
 	if authInfo == nil || authInfo.Token == "" {
 		return nil
 	}
@@ -285,5 +951,38 @@ func (r *azureRetriever) GetAuthInfo(config *api.Config, target Target) *api.Aut
 }
 
 func (r *azureRetriever) SetUseDeviceCode(value bool) {
-	r.oidc.SetUseDeviceCode(value)
+	r.muClients.Lock()
+	defer r.muClients.Unlock()
+	r.options.UseDeviceCode = value
+	for _, client := range r.clients {
+		client.SetUseDeviceCode(value)
+	}
+}
+
+// claimGroups returns the groups of a groups claim, which is a list or a single group. It returns false if the token
+// has no such claim.
+func claimGroups(claim interface{}) ([]string, bool) {
+	switch value := claim.(type) {
+	case []interface{}:
+		var groups []string
+		for _, group := range value {
+			groups = append(groups, fmt.Sprintf("%v", group))
+		}
+		return groups, true
+	case string:
+		return []string{value}, true
+	}
+	return nil, false
+}
+
+// claimOf returns the claim of the token as a string, empty if the token has none
+func claimOf(token, claim string) string {
+	jwt, err := jws.ParseJWT([]byte(token))
+	if err != nil {
+		return ""
+	}
+	if value := jwt.Claims().Get(claim); value != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return ""
 }
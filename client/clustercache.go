@@ -0,0 +1,111 @@
+package client
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultClusterCacheTTL is how long the discovered cluster details of a target are reused when its discovery
+// endpoint is unreachable, unless the config sets cluster-cache-ttl.
+const DefaultClusterCacheTTL = 7 * 24 * time.Hour
+
+// CachedCluster holds the cluster details discovered for a target
+type CachedCluster struct {
+	// Endpoint is the osprey server or API server the details were discovered from
+	Endpoint string `yaml:"endpoint"`
+	// APIServerURL is the discovered URL of the API server
+	APIServerURL string `yaml:"api-server-url"`
+	// CertificateAuthorityData is the discovered base64-encoded CA of the API server
+	CertificateAuthorityData string `yaml:"certificate-authority-data"`
+	// Discovered is when the details were discovered
+	Discovered time.Time `yaml:"discovered"`
+}
+
+// ClusterCache stores the cluster details discovered for the targets, so logins still work for a while when their
+// discovery endpoint is down. The details are cached per provider, profile and target. It is safe for concurrent use
+// and a nil ClusterCache caches nothing.
+type ClusterCache struct {
+	file *stateFile
+	ttl  time.Duration
+	// refreshes are the background refreshes of the details used from the cache
+	refreshes sync.WaitGroup
+}
+
+// NewClusterCache returns the cache saved in the file at path, whose entries expire after ttl.
+func NewClusterCache(path string, ttl time.Duration) *ClusterCache {
+	return &ClusterCache{file: newStateFile(path, "cluster cache"), ttl: ttl}
+}
+
+// Get returns the cluster details cached for the target logged in to with the profile when discovered from the
+// endpoint, unless they expired.
+func (c *ClusterCache) Get(target Target, profile, endpoint string) (*CachedCluster, error) {
+	if c == nil {
+		return nil, nil
+	}
+	clusters := make(map[string]*CachedCluster)
+	if err := c.file.view(&clusters); err != nil {
+		return nil, err
+	}
+	cluster, ok := clusters[targetKey(target, profile)]
+	if !ok {
+		// the details were cached by target name only before
+		cluster, ok = clusters[target.Name()]
+	}
+	if !ok || cluster.Endpoint != endpoint || time.Since(cluster.Discovered) > c.ttl {
+		return nil, nil
+	}
+	return cluster, nil
+}
+
+// Put caches the cluster details discovered for the target logged in to with the profile, and returns the ones they
+// replace, if any.
+func (c *ClusterCache) Put(target Target, profile string, cluster *CachedCluster) (*CachedCluster, error) {
+	if c == nil {
+		return nil, nil
+	}
+	key := targetKey(target, profile)
+	clusters := make(map[string]*CachedCluster)
+	var previous *CachedCluster
+	err := c.file.update(&clusters, func() bool {
+		previous = clusters[key]
+		if legacy, isLegacy := clusters[target.Name()]; previous == nil && isLegacy {
+			// the details were cached by target name only before, which is moved to the key
+			previous = legacy
+			delete(clusters, target.Name())
+		}
+		clusters[key] = cluster
+		return true
+	})
+	return previous, err
+}
+
+// refresh runs the background refresh of details used from the cache.
+func (c *ClusterCache) refresh(refresh func()) {
+	if c == nil {
+		return
+	}
+	c.refreshes.Add(1)
+	go func() {
+		defer c.refreshes.Done()
+		refresh()
+	}()
+}
+
+// WaitForRefreshes waits up to the timeout for the background refreshes of the details used from the cache, and
+// returns false if they didn't finish in time.
+func (c *ClusterCache) WaitForRefreshes(timeout time.Duration) bool {
+	if c == nil {
+		return true
+	}
+	done := make(chan struct{})
+	go func() {
+		c.refreshes.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
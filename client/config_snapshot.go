@@ -8,6 +8,9 @@ type ConfigSnapshot struct {
 	defaultGroupName     string
 	groupsByName         map[string]Group
 	providerConfigByName map[string]*ProviderConfig
+	// naming generates the names of the kubeconfig entries, unless the name templates are invalid
+	naming    *naming
+	namingErr error
 }
 
 // Groups returns all defined groups sorted alphabetically by name.
@@ -3,7 +3,6 @@ package client
 import (
 	"bufio"
 	"fmt"
-	"os"
 	"strings"
 	"syscall"
 
@@ -35,17 +34,22 @@ func consumeCredentials(pwdInputFunc func(string, *bufio.Reader) (string, error)
 		password = partialLoginCredentials.Password
 	}
 
-	reader := bufio.NewReader(os.Stdin)
-	if username == "" {
-		if username, err = common.Read("username", "Username: ", reader, common.Input); err != nil {
-			return nil, err
+	err = common.WithStdin(func(reader *bufio.Reader) (err error) {
+		if username == "" {
+			if username, err = common.Read("username", "Username: ", reader, common.Input); err != nil {
+				return err
+			}
 		}
-	}
 
-	if password == "" {
-		if password, err = common.Read("password", "Password: ", reader, pwdInputFunc); err != nil {
-			return nil, err
+		if password == "" {
+			if password, err = common.Read("password", "Password: ", reader, pwdInputFunc); err != nil {
+				return err
+			}
 		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return &LoginCredentials{Username: username, Password: password}, nil
@@ -53,7 +57,7 @@ func consumeCredentials(pwdInputFunc func(string, *bufio.Reader) (string, error)
 
 func hiddenInput(inputName string, reader *bufio.Reader) (string, error) {
 	passwordBytes, err := terminal.ReadPassword(int(syscall.Stdin))
-	fmt.Println()
+	fmt.Fprintln(common.PromptOutput)
 	if err == nil {
 		return strings.TrimSpace(string(passwordBytes)), nil
 	}
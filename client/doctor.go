@@ -0,0 +1,615 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sky-uk/osprey/v2/common/web"
+	clientgo "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// DiagnosticStatus is the outcome of a diagnostic check
+type DiagnosticStatus string
+
+const (
+	// DiagnosticOK is the status of a check that passed
+	DiagnosticOK DiagnosticStatus = "ok"
+	// DiagnosticWarning is the status of a check that passed but may cause problems
+	DiagnosticWarning DiagnosticStatus = "warning"
+	// DiagnosticFailed is the status of a check that failed
+	DiagnosticFailed DiagnosticStatus = "failed"
+	// DiagnosticSkipped is the status of a check that could not run because a previous one failed
+	DiagnosticSkipped DiagnosticStatus = "skipped"
+)
+
+const (
+	diagnosticTimeout     = 5 * time.Second
+	certificateExpiryWarn = 14 * 24 * time.Hour
+	clockSkewWarning      = time.Minute
+	clockSkewFailure      = 5 * time.Minute
+)
+
+// Diagnostic is the result of a single diagnostic check
+type Diagnostic struct {
+	// Check is the name of the check, e.g. dns or tls
+	Check string
+	// Status is the outcome of the check
+	Status DiagnosticStatus
+	// Detail describes what was found
+	Detail string
+	// Hint suggests how to fix a failed check or warning
+	Hint string
+}
+
+type diagnostics struct {
+	results []Diagnostic
+	// serverDate is the Date header of the first HTTP response, used to check the clock skew
+	serverDate time.Time
+	dateSource string
+	// proxied is set when the requests go through the target's proxy-url
+	proxied bool
+	// ipFamily is the IP version used to connect to the target
+	ipFamily web.IPFamily
+}
+
+func (d *diagnostics) ok(check, detail string, args ...interface{}) {
+	d.results = append(d.results, Diagnostic{Check: check, Status: DiagnosticOK, Detail: fmt.Sprintf(detail, args...)})
+}
+
+func (d *diagnostics) warn(check, hint, detail string, args ...interface{}) {
+	d.results = append(d.results, Diagnostic{Check: check, Status: DiagnosticWarning, Detail: fmt.Sprintf(detail, args...), Hint: hint})
+}
+
+// fail records a failed check and skips the checks that depend on it
+func (d *diagnostics) fail(check, hint string, err error, skipped ...string) {
+	d.results = append(d.results, Diagnostic{Check: check, Status: DiagnosticFailed, Detail: err.Error(), Hint: hint})
+	for _, skippedCheck := range skipped {
+		d.results = append(d.results, Diagnostic{Check: skippedCheck, Status: DiagnosticSkipped, Detail: fmt.Sprintf("%s failed", check)})
+	}
+}
+
+// DiagnoseProvider checks the provider's configuration that is shared by all its targets.
+// For azure providers it fetches the issuer's OpenID discovery document.
+func (t *ConfigSnapshot) DiagnoseProvider(providerName string) []Diagnostic {
+	d := &diagnostics{}
+	provider, ok := t.providerConfigByName[providerName]
+	if !ok {
+		d.fail("provider", "check the provider of the target in the osprey config", fmt.Errorf("unknown provider %s", providerName))
+		return d.results
+	}
+	if provider.providerType == AzureProviderName {
+		// without an issuer, the issuers of the GKE ClientConfigs are checked with the targets
+		if provider.azure.hasIssuer() {
+			d.checkDiscovery(provider.azure.wellKnownConfigurationURL(), "", false, provider.proxyURL)
+		}
+		d.checkClockSkew()
+	}
+	return d.results
+}
+
+// DiagnoseTarget checks the target's server step by step: DNS resolution, TCP reachability, TLS chain validation
+// against the configured CA and, depending on the target, the osprey server's health, the API server's kube-public
+// resources or, for static cluster details, the API server itself. If the user has logged in with osprey, it also
+// checks the issuer of the kubeconfig's user. It finishes with the clock skew against the servers' Date header.
+func (t *ConfigSnapshot) DiagnoseTarget(target Target, kubeconfig *clientgo.Config) []Diagnostic {
+	d := &diagnostics{ipFamily: target.IPFamily()}
+	endpoint := target.Server()
+	// azure targets with static cluster details have no discovery endpoint, the API server itself is checked instead
+	staticAPIServer := target.ShouldUseStaticClusterDetails() && endpoint == ""
+	if target.ShouldFetchCAFromAPIServer() {
+		endpoint = target.APIServer()
+	} else if staticAPIServer {
+		endpoint = target.APIServerURL()
+	}
+	serverURL, err := url.Parse(endpoint)
+	if err == nil && serverURL.Host == "" {
+		err = fmt.Errorf("%q has no host", endpoint)
+	}
+	if err != nil {
+		d.fail("url", "set a valid https URL as the target's server, api-server or api-server-url", fmt.Errorf("invalid server URL: %w", err))
+		return d.results
+	}
+
+	var caData []string
+	var clientCertificate, clientKey string
+	if provider, ok := t.providerConfigByName[target.providerName]; ok && provider.providerType == OspreyProviderName {
+		caData = append(caData, provider.certificateAuthorityData)
+		clientCertificate, clientKey = provider.osprey.clientCertificateFor(target, nil)
+	}
+	serverName := ""
+	if staticAPIServer {
+		caData = append(caData, target.APIServerCAData())
+		serverName = target.TLSServerName()
+	} else if !target.ShouldFetchCAFromAPIServer() {
+		caData = append(caData, target.CertificateAuthorityData())
+	}
+
+	clientCertificates, err := web.LoadClientCertificates(clientCertificate, clientKey)
+	if err != nil {
+		d.fail("client-certificate", "check the client-certificate and client-key files of the target, or of its provider", err)
+		return d.results
+	}
+	if len(clientCertificates) > 0 {
+		if leaf, err := x509.ParseCertificate(clientCertificates[0].Certificate[0]); err == nil {
+			if time.Now().After(leaf.NotAfter) {
+				d.fail("client-certificate", "renew the client certificate", fmt.Errorf("%s expired on %s",
+					certificateName(leaf), leaf.NotAfter.Format(time.RFC3339)))
+				return d.results
+			}
+			d.ok("client-certificate", "%s, expires on %s", certificateName(leaf), leaf.NotAfter.Format(time.RFC3339))
+		}
+	}
+
+	host := serverURL.Hostname()
+	port := serverURL.Port()
+	if port == "" {
+		port = "443"
+		if serverURL.Scheme == "http" {
+			port = "80"
+		}
+	}
+
+	if target.ProxyURL() != "" {
+		// The server is only reachable through the proxy, so the TLS chain is checked by the requests below
+		proxyURL, err := web.ParseProxyURL(target.ProxyURL())
+		if err != nil {
+			d.fail("proxy", "set a valid http, https or socks5 URL as the proxy-url", err)
+			return d.results
+		}
+		d.ok("proxy", "connecting through %s", proxyURL.Redacted())
+		d.proxied = true
+		if !d.checkDNS(proxyURL.Hostname()) || !d.checkTCP(proxyURL.Hostname(), proxyPort(proxyURL)) {
+			return d.results
+		}
+	} else {
+		if !d.checkDNS(host) || !d.checkTCP(host, port) {
+			return d.results
+		}
+		if serverURL.Scheme == "https" && !d.checkTLS(target, host, port, serverName, caData, clientCertificates) {
+			return d.results
+		}
+	}
+
+	httpClient, err := web.NewClient(web.ClientOptions{
+		SkipVerify:        target.ShouldSkipTLSVerify() || target.ShouldUseKubeadmClusterInfo(),
+		CACerts:           caData,
+		ProxyURL:          target.ProxyURL(),
+		IPFamily:          target.IPFamily(),
+		PinnedPublicKeys:  target.PinnedPublicKeys(),
+		ClientCertificate: clientCertificate,
+		ClientKey:         clientKey,
+		ServerName:        serverName,
+	})
+	if err != nil {
+		d.fail("http", "check the CA of the target", err)
+		return d.results
+	}
+	httpClient.Timeout = diagnosticTimeout
+
+	switch {
+	case target.ShouldConfigureForGKE():
+		if clientConfig := d.checkKubePublic(httpClient, target.APIServer(), "apis/authentication.gke.io/v2alpha1",
+			"clientconfigs", "default",
+			"enable the GKE Identity Service and grant system:anonymous read access to the default ClientConfig in kube-public"); clientConfig != nil {
+			d.checkGKEAuthentication(target, t.providerConfigByName[target.providerName], clientConfig)
+		}
+	case target.ShouldUseKubeadmClusterInfo():
+		if clusterInfo := d.checkKubePublic(httpClient, target.APIServer(), "api/v1", "configmaps", "cluster-info",
+			"grant system:anonymous read access to the cluster-info ConfigMap in kube-public, as kubeadm init does"); clusterInfo != nil {
+			d.checkClusterInfo(target, clusterInfo)
+		}
+	case target.ShouldFetchCAFromAPIServer():
+		d.checkKubePublic(httpClient, target.APIServer(), "api/v1", "configmaps", "kube-root-ca.crt",
+			"grant system:anonymous read access to the kube-root-ca.crt ConfigMap in kube-public (the RootCAConfigMap feature)")
+	case staticAPIServer:
+		d.checkAPIServer(httpClient, target.APIServerURL())
+	default:
+		d.checkHealth(httpClient, target.Server())
+	}
+
+	if names, err := t.KubeconfigNames(target, ""); err == nil && kubeconfig != nil {
+		if authInfo, ok := kubeconfig.AuthInfos[names.User]; ok && authInfo.AuthProvider != nil {
+			issuerURL := authInfo.AuthProvider.Config["idp-issuer-url"]
+			if issuerURL != "" {
+				d.checkDiscovery(strings.TrimSuffix(issuerURL, "/")+"/.well-known/openid-configuration",
+					authInfo.AuthProvider.Config["idp-certificate-authority-data"], target.ShouldSkipTLSVerify(), target.ProxyURL())
+			}
+		}
+	}
+
+	d.checkClockSkew()
+	return d.results
+}
+
+func proxyPort(proxyURL *url.URL) string {
+	if port := proxyURL.Port(); port != "" {
+		return port
+	}
+	switch proxyURL.Scheme {
+	case "https":
+		return "443"
+	case "socks5":
+		return "1080"
+	default:
+		return "80"
+	}
+}
+
+func (d *diagnostics) checkDNS(host string) bool {
+	if ip := net.ParseIP(host); ip != nil {
+		if !d.matchesIPFamily(ip) {
+			d.fail("dns", fmt.Sprintf("the target's ip-family is %s, set it to auto to connect to %s", d.ipFamily, host),
+				fmt.Errorf("%s is not an %s address", host, d.ipFamily), "tcp", "tls")
+			return false
+		}
+		d.ok("dns", "%s is an IP address", host)
+		return true
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), diagnosticTimeout)
+	defer cancel()
+	addresses, err := net.DefaultResolver.LookupHost(ctx, host)
+	if err != nil {
+		d.fail("dns", "check the host name of the target, and that your DNS settings or VPN can resolve it", err, "tcp", "tls")
+		return false
+	}
+	var usable []string
+	for _, address := range addresses {
+		if d.matchesIPFamily(net.ParseIP(address)) {
+			usable = append(usable, address)
+		}
+	}
+	if len(usable) == 0 {
+		d.fail("dns", fmt.Sprintf("the target's ip-family is %s, set it to auto or to the family of the host's addresses", d.ipFamily),
+			fmt.Errorf("%s resolves to %s, none of them %s", host, strings.Join(addresses, ", "), d.ipFamily), "tcp", "tls")
+		return false
+	}
+	d.ok("dns", "%s resolves to %s", host, strings.Join(usable, ", "))
+	return true
+}
+
+func (d *diagnostics) matchesIPFamily(ip net.IP) bool {
+	switch d.ipFamily {
+	case web.IPFamilyIPv4:
+		return ip.To4() != nil
+	case web.IPFamilyIPv6:
+		return ip.To4() == nil
+	default:
+		return true
+	}
+}
+
+func (d *diagnostics) checkTCP(host, port string) bool {
+	address := net.JoinHostPort(host, port)
+	dialer := net.Dialer{Timeout: diagnosticTimeout}
+	conn, err := dialer.Dial(d.ipFamily.Network(), address)
+	if err != nil {
+		d.fail("tcp", "check that the server is up and that no firewall or proxy blocks the connection", err, "tls")
+		return false
+	}
+	defer conn.Close()
+	d.ok("tcp", "connected to %s", conn.RemoteAddr())
+	return true
+}
+
+func (d *diagnostics) checkTLS(target Target, host, port, serverName string, caData []string, clientCertificates []tls.Certificate) bool {
+	certPool, err := web.NewCertPool(caData...)
+	if err != nil {
+		d.fail("tls", fmt.Sprintf("fix the CA configured for the target (%s)", target.CASource()), err)
+		return false
+	}
+	dialer := &net.Dialer{Timeout: diagnosticTimeout}
+	conn, err := tls.DialWithDialer(dialer, d.ipFamily.Network(), net.JoinHostPort(host, port), &tls.Config{
+		RootCAs:            certPool,
+		ServerName:         serverNameOr(serverName, host),
+		InsecureSkipVerify: target.ShouldSkipTLSVerify() || target.ShouldUseKubeadmClusterInfo(),
+		Certificates:       clientCertificates,
+	})
+	if err != nil {
+		d.fail("tls", tlsHint(target, err), err)
+		return false
+	}
+	defer conn.Close()
+
+	state := conn.ConnectionState()
+	if !d.checkPinnedPublicKeys(target, state) {
+		return false
+	}
+	certificate := state.PeerCertificates[0]
+	if target.ShouldUseKubeadmClusterInfo() && !target.ShouldSkipTLSVerify() {
+		d.ok("tls", "certificate of %s not verified, the kubeadm cluster-info is verified instead", certificateName(certificate))
+		return true
+	}
+	if target.ShouldSkipTLSVerify() {
+		d.warn("tls", "remove skip-tls-verify and configure the CA of the target instead",
+			"certificate not verified because of skip-tls-verify")
+		return true
+	}
+	expiresIn := time.Until(certificate.NotAfter)
+	if expiresIn < certificateExpiryWarn {
+		d.warn("tls", "renew the server's certificate", "certificate of %s expires on %s",
+			certificateName(certificate), certificate.NotAfter.Format(time.RFC3339))
+		return true
+	}
+	d.ok("tls", "certificate of %s verified against %s, expires on %s", certificateName(certificate),
+		target.CASource(), certificate.NotAfter.Format(time.RFC3339))
+	return true
+}
+
+func (d *diagnostics) checkPinnedPublicKeys(target Target, state tls.ConnectionState) bool {
+	if len(target.PinnedPublicKeys()) == 0 {
+		return true
+	}
+	chains := state.VerifiedChains
+	if len(chains) == 0 && len(state.PeerCertificates) > 0 {
+		// only the server's own certificate can be trusted in an unverified chain
+		chains = [][]*x509.Certificate{state.PeerCertificates[:1]}
+	}
+	var err error
+	for _, chain := range chains {
+		if err = web.VerifyPublicKeyPins(target.PinnedPublicKeys(), chain); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		d.fail("pinning", "if the server's key was rotated on purpose, add the new pin to pinned-public-keys", err)
+		return false
+	}
+	d.ok("pinning", "the server's chain matches one of the %d pinned public keys", len(target.PinnedPublicKeys()))
+	return true
+}
+
+func certificateName(certificate *x509.Certificate) string {
+	if certificate.Subject.CommonName != "" {
+		return certificate.Subject.CommonName
+	}
+	if len(certificate.DNSNames) > 0 {
+		return certificate.DNSNames[0]
+	}
+	return certificate.Subject.String()
+}
+
+func tlsHint(target Target, err error) string {
+	var unknownAuthority x509.UnknownAuthorityError
+	var hostnameError x509.HostnameError
+	var invalidCertificate x509.CertificateInvalidError
+	switch {
+	case errors.As(err, &unknownAuthority) && target.ShouldUseStaticClusterDetails() && target.Server() == "":
+		return fmt.Sprintf("the API server's certificate is not signed by the configured CA (%s), "+
+			"set the target's api-server-ca or api-server-ca-data to the CA that signed it", target.CASource())
+	case errors.As(err, &unknownAuthority):
+		return fmt.Sprintf("the server's certificate is not signed by the configured CA (%s), "+
+			"set the target's certificate-authority or certificate-authority-data to the CA that signed it", target.CASource())
+	case errors.As(err, &hostnameError) && target.TLSServerName() != "" && target.Server() == "":
+		return "the API server's certificate is not valid for the target's tls-server-name, check it or remove it"
+	case errors.As(err, &hostnameError):
+		return "the server's certificate is not valid for the host of the target, check the target's server URL"
+	case errors.As(err, &invalidCertificate) && invalidCertificate.Reason == x509.Expired:
+		return "the server's certificate has expired or is not yet valid, check the local clock or renew the certificate"
+	default:
+		return "check that the target's URL points to an HTTPS server"
+	}
+}
+
+func (d *diagnostics) checkHealth(httpClient *http.Client, server string) {
+	resp, err := httpClient.Get(server + "/healthz")
+	if err != nil {
+		d.fail("healthz", d.requestHint("check that the target's server is an osprey server"), err)
+		return
+	}
+	defer resp.Body.Close()
+	d.recordDate(resp, server)
+	if resp.StatusCode != http.StatusOK {
+		d.fail("healthz", "the osprey server is unhealthy, check its logs and its connection to the identity provider",
+			fmt.Errorf("%s/healthz returned %s", server, resp.Status))
+		return
+	}
+	d.ok("healthz", "%s is healthy", server)
+}
+
+// requestHint returns the hint for a failed request, pointing at the proxy first when there is one
+func (d *diagnostics) requestHint(hint string) string {
+	if d.proxied {
+		return "check the proxy-url and its credentials, and that the proxy allows connections to the server; otherwise " + hint
+	}
+	return hint
+}
+
+// checkAPIServer checks that the API server answers requests. Any answer, even a denied anonymous request, will do.
+func (d *diagnostics) checkAPIServer(httpClient *http.Client, apiServer string) {
+	resp, err := httpClient.Get(strings.TrimSuffix(apiServer, "/") + "/version")
+	if err != nil {
+		d.fail("api-server", d.requestHint("check the target's api-server-url"), err)
+		return
+	}
+	defer resp.Body.Close()
+	d.recordDate(resp, apiServer)
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		d.ok("api-server", "%s is reachable", apiServer)
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		d.ok("api-server", "%s is reachable, anonymous requests are denied", apiServer)
+	default:
+		d.fail("api-server", "check the health of the API server", fmt.Errorf("unexpected response for %s/version: %s", apiServer, resp.Status))
+	}
+}
+
+func serverNameOr(serverName, host string) string {
+	if serverName != "" {
+		return serverName
+	}
+	return host
+}
+
+// checkKubePublic checks that the resource of the kube-public namespace is readable, and returns it if so
+func (d *diagnostics) checkKubePublic(httpClient *http.Client, apiServer, api, kind, name, hint string) []byte {
+	check := fmt.Sprintf("kube-public %s", strings.TrimSuffix(kind, "s"))
+	req, err := createKubePublicRequest(apiServer, api, kind, name)
+	if err != nil {
+		d.fail(check, "check the target's api-server URL", err)
+		return nil
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		d.fail(check, d.requestHint("check the target's api-server URL"), err)
+		return nil
+	}
+	defer resp.Body.Close()
+	d.recordDate(resp, apiServer)
+	switch resp.StatusCode {
+	case http.StatusOK:
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			d.fail(check, "check the health of the API server", fmt.Errorf("failed to read %s/%s: %w", kind, name, err))
+			return nil
+		}
+		d.ok(check, "%s/%s is readable", kind, name)
+		return body
+	case http.StatusUnauthorized, http.StatusForbidden:
+		d.fail(check, hint, fmt.Errorf("access to %s/%s denied: %s", kind, name, resp.Status))
+	case http.StatusNotFound:
+		d.fail(check, hint, fmt.Errorf("%s/%s not found", kind, name))
+	default:
+		d.fail(check, "check the health of the API server", fmt.Errorf("unexpected response for %s/%s: %s", kind, name, resp.Status))
+	}
+	return nil
+}
+
+func (d *diagnostics) checkClusterInfo(target Target, data []byte) {
+	clusterInfo, err := parseClusterInfo(data)
+	if err != nil {
+		d.fail("cluster-info", "check that the api-server is the one of a kubeadm cluster", err)
+		return
+	}
+	cluster, err := clusterInfo.verify(target.BootstrapToken(), target.CACertHashes())
+	switch {
+	case errors.Is(err, errClusterInfoSignature):
+		d.fail("cluster-info", "check the target's bootstrap-token, or create a new one with 'kubeadm token create'", err)
+	case errors.Is(err, errClusterInfoCACertHash):
+		d.fail("cluster-info", "check the target's ca-cert-hashes against the cluster's CA", err)
+	case err != nil:
+		d.fail("cluster-info", "check that the api-server is the one of a kubeadm cluster", err)
+	default:
+		d.ok("cluster-info", "verified, API server %s", cluster.Server)
+	}
+}
+
+func (d *diagnostics) checkGKEAuthentication(target Target, provider *ProviderConfig, data []byte) {
+	clientConfig, err := parseClientConfig(data)
+	if err != nil {
+		d.fail("gke authentication", "check that the api-server is the one of a GKE cluster", err)
+		return
+	}
+	authentication, err := clientConfig.Spec.oidcAuthentication(target.GKEAuthentication())
+	if err != nil {
+		d.fail("gke authentication", "check the target's gke-authentication against the authentications of the ClientConfig", err)
+		return
+	}
+	if authentication == nil {
+		d.ok("gke authentication", "no oidc authentication in the ClientConfig, the provider's settings are used")
+		return
+	}
+	d.ok("gke authentication", "%s, issuer %s", authentication.Name, authentication.OIDC.IssuerURI)
+	if provider != nil && provider.azure != nil && !provider.azure.hasIssuer() {
+		d.checkDiscovery(authentication.OIDC.wellKnownConfigurationURL(), authentication.OIDC.CertificateAuthorityData,
+			false, target.ProxyURL())
+	}
+}
+
+func (d *diagnostics) checkDiscovery(discoveryURL, caData string, skipVerify bool, proxyURL string) {
+	httpClient, err := web.NewClient(web.ClientOptions{SkipVerify: skipVerify, CACerts: []string{caData}, ProxyURL: proxyURL})
+	if err != nil {
+		d.fail("issuer", "check the CA of the issuer", err)
+		return
+	}
+	httpClient.Timeout = diagnosticTimeout
+	resp, err := httpClient.Get(discoveryURL)
+	if err != nil {
+		hint := "check that the issuer is reachable from this machine"
+		var unknownAuthority x509.UnknownAuthorityError
+		if errors.As(err, &unknownAuthority) {
+			hint = "the issuer's certificate is not signed by a trusted CA, add its CA to the system's CA certs"
+		}
+		d.fail("issuer", hint, err)
+		return
+	}
+	defer resp.Body.Close()
+	d.recordDate(resp, discoveryURL)
+	if resp.StatusCode != http.StatusOK {
+		d.fail("issuer", "check the issuer URL, or the tenant-id for azure providers",
+			fmt.Errorf("%s returned %s", discoveryURL, resp.Status))
+		return
+	}
+
+	var discovery struct {
+		Issuer                string `json:"issuer"`
+		AuthorizationEndpoint string `json:"authorization_endpoint"`
+		TokenEndpoint         string `json:"token_endpoint"`
+		JWKSURI               string `json:"jwks_uri"`
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err == nil {
+		err = json.Unmarshal(body, &discovery)
+	}
+	if err != nil {
+		d.fail("issuer", "check that the issuer URL points to an OpenID Connect provider", fmt.Errorf("invalid discovery document: %w", err))
+		return
+	}
+	var missing []string
+	for field, value := range map[string]string{
+		"issuer":                 discovery.Issuer,
+		"authorization_endpoint": discovery.AuthorizationEndpoint,
+		"token_endpoint":         discovery.TokenEndpoint,
+		"jwks_uri":               discovery.JWKSURI,
+	} {
+		if value == "" {
+			missing = append(missing, field)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		d.fail("issuer", "check that the issuer URL points to an OpenID Connect provider",
+			fmt.Errorf("discovery document %s is missing %s", discoveryURL, strings.Join(missing, ", ")))
+		return
+	}
+	d.ok("issuer", "discovery document of %s is valid", discovery.Issuer)
+}
+
+func (d *diagnostics) recordDate(resp *http.Response, source string) {
+	if !d.serverDate.IsZero() {
+		return
+	}
+	if date, err := http.ParseTime(resp.Header.Get("Date")); err == nil {
+		d.serverDate = date
+		d.dateSource = source
+	}
+}
+
+func (d *diagnostics) checkClockSkew() {
+	if d.serverDate.IsZero() {
+		return
+	}
+	// the Date header has a precision of one second
+	skew := time.Since(d.serverDate).Truncate(time.Second)
+	absSkew := time.Duration(math.Abs(float64(skew)))
+	hint := "synchronise the local clock, e.g. enable NTP. Tokens are rejected when the clocks differ"
+	switch {
+	case absSkew > clockSkewFailure:
+		d.fail("clock", hint, fmt.Errorf("local clock is %s off the clock of %s", skew, d.dateSource))
+	case absSkew > clockSkewWarning:
+		d.warn("clock", hint, "local clock is %s off the clock of %s", skew, d.dateSource)
+	default:
+		d.ok("clock", "local clock is in sync with %s", d.dateSource)
+	}
+}
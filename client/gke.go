@@ -0,0 +1,87 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// clientConfig is the default ClientConfig of kube-public, created by the GKE Identity Service
+type clientConfig struct {
+	Spec clientConfigSpec `json:"spec"`
+}
+
+type clientConfigSpec struct {
+	Server         string                       `json:"server"`
+	CaCertBase64   string                       `json:"certificateAuthorityData"`
+	Authentication []clientConfigAuthentication `json:"authentication"`
+}
+
+// clientConfigAuthentication is one of the authentication methods of a ClientConfig. Only oidc is supported by osprey.
+type clientConfigAuthentication struct {
+	Name string            `json:"name"`
+	OIDC *clientConfigOIDC `json:"oidc"`
+}
+
+// clientConfigOIDC holds the oidc settings of a ClientConfig authentication, as used by the API server
+type clientConfigOIDC struct {
+	IssuerURI          string `json:"issuerURI"`
+	ClientID           string `json:"clientID"`
+	ClientSecret       string `json:"clientSecret"`
+	KubectlRedirectURI string `json:"kubectlRedirectURI"`
+	// Scopes is a comma-separated list of scopes
+	Scopes      string `json:"scopes"`
+	UserClaim   string `json:"userClaim"`
+	GroupsClaim string `json:"groupsClaim"`
+	// CertificateAuthorityData is the base64-encoded CA of the issuer
+	CertificateAuthorityData string `json:"certificateAuthorityData"`
+}
+
+func parseClientConfig(data []byte) (*clientConfig, error) {
+	clientConfig := &clientConfig{}
+	if err := json.Unmarshal(data, clientConfig); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+	return clientConfig, nil
+}
+
+// oidcAuthentication returns the oidc authentication with the given name, or the first oidc one if the name is empty.
+// It returns nil if the name is empty and the ClientConfig has no oidc authentication.
+func (s *clientConfigSpec) oidcAuthentication(name string) (*clientConfigAuthentication, error) {
+	var names []string
+	for i := range s.Authentication {
+		authentication := &s.Authentication[i]
+		if name == "" && authentication.OIDC != nil {
+			return authentication, nil
+		}
+		if authentication.Name == name && name != "" {
+			if authentication.OIDC == nil {
+				return nil, fmt.Errorf("the authentication %s of the GKE ClientConfig is not an oidc one", name)
+			}
+			return authentication, nil
+		}
+		names = append(names, authentication.Name)
+	}
+	if name == "" {
+		return nil, nil
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("the GKE ClientConfig has no authentication named %s, it has none", name)
+	}
+	return nil, fmt.Errorf("the GKE ClientConfig has no authentication named %s, it has %s", name, strings.Join(names, ", "))
+}
+
+// wellKnownConfigurationURL returns the URL of the OpenID discovery document of the issuer
+func (o *clientConfigOIDC) wellKnownConfigurationURL() string {
+	return strings.TrimSuffix(o.IssuerURI, "/") + "/.well-known/openid-configuration"
+}
+
+func (o *clientConfigOIDC) scopes() []string {
+	var scopes []string
+	for _, scope := range strings.Split(o.Scopes, ",") {
+		if scope = strings.TrimSpace(scope); scope != "" {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes
+}
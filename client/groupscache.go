@@ -0,0 +1,55 @@
+package client
+
+import (
+	"time"
+)
+
+// CachedGroups holds the groups resolved for the user logged in to a target, when its token has too many groups to
+// list them
+type CachedGroups struct {
+	// User is the user the groups were resolved for
+	User string `yaml:"user"`
+	// Groups are the IDs of the groups of the user
+	Groups []string `yaml:"groups"`
+	// Resolved is when the groups were resolved
+	Resolved time.Time `yaml:"resolved"`
+}
+
+// GroupsCache stores the groups resolved for the targets on login, for 'osprey user'. The groups are cached per
+// provider, profile and target. It is safe for concurrent use and a nil GroupsCache caches nothing.
+type GroupsCache struct {
+	file *stateFile
+}
+
+// NewGroupsCache returns the cache saved in the file at path.
+func NewGroupsCache(path string) *GroupsCache {
+	return &GroupsCache{file: newStateFile(path, "groups cache")}
+}
+
+// Get returns the groups cached for the user of the target logged in to with the profile, if any.
+func (c *GroupsCache) Get(target Target, profile, user string) (*CachedGroups, error) {
+	if c == nil {
+		return nil, nil
+	}
+	entries := make(map[string]*CachedGroups)
+	if err := c.file.view(&entries); err != nil {
+		return nil, err
+	}
+	groups, ok := entries[targetKey(target, profile)]
+	if !ok || groups.User != user {
+		return nil, nil
+	}
+	return groups, nil
+}
+
+// Put caches the groups resolved for the user of the target logged in to with the profile.
+func (c *GroupsCache) Put(target Target, profile string, groups *CachedGroups) error {
+	if c == nil {
+		return nil
+	}
+	entries := make(map[string]*CachedGroups)
+	return c.file.update(&entries, func() bool {
+		entries[targetKey(target, profile)] = groups
+		return true
+	})
+}
@@ -0,0 +1,155 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/SermoDigital/jose/jwt"
+)
+
+// maxMemberOfPages bounds the pages of groups followed through @odata.nextLink
+const maxMemberOfPages = 100
+
+// groupsOverage returns true if the token has too many groups to list them in its groupsClaim, along with the endpoint
+// of its _claim_sources that lists them, if any.
+func groupsOverage(claims jwt.Claims, groupsClaim string) (bool, string) {
+	if claims.Get(groupsClaim) != nil || claims.Get("_claim_names") == nil {
+		return false, ""
+	}
+	names, _ := claims.Get("_claim_names").(map[string]interface{})
+	source, ok := names[groupsClaim].(string)
+	if !ok {
+		source, _ = names["groups"].(string)
+	}
+	sources, _ := claims.Get("_claim_sources").(map[string]interface{})
+	claimSource, _ := sources[source].(map[string]interface{})
+	endpoint, _ := claimSource["endpoint"].(string)
+	return true, endpoint
+}
+
+// groupsEndpoint returns the endpoint listing the groups: the memberOf URL if set, otherwise the getMemberObjects
+// endpoint of the token's _claim_sources.
+func groupsEndpoint(memberOfURL, claimSourceEndpoint string) (string, error) {
+	if memberOfURL != "" {
+		return memberOfURL, nil
+	}
+	if claimSourceEndpoint == "" {
+		return "", errors.New("the token has no _claim_sources endpoint, set the groups-overage-url of the provider")
+	}
+	return claimSourceEndpoint, nil
+}
+
+// groupsScope returns the scope of the access tokens the groups endpoint accepts. Azure AD issues the tokens of a
+// resource for the .default scope of its URL, e.g. https://graph.microsoft.com/.default for Microsoft Graph.
+func groupsScope(endpoint string) (string, error) {
+	endpointURL, err := url.Parse(endpoint)
+	if err != nil || endpointURL.Host == "" {
+		return "", fmt.Errorf("invalid groups endpoint %q", endpoint)
+	}
+	return fmt.Sprintf("%s://%s/.default", endpointURL.Scheme, endpointURL.Host), nil
+}
+
+// resolveGroups lists the groups of the user from a Graph-compatible endpoint, with an access token of its scope. The
+// memberOf URL is queried with GET if set, otherwise the getMemberObjects endpoint of the token's _claim_sources with
+// POST.
+func resolveGroups(httpClient *http.Client, accessToken, memberOfURL, claimSourceEndpoint string) ([]string, error) {
+	method, next, body := http.MethodGet, memberOfURL, ""
+	if memberOfURL == "" {
+		method, next, body = http.MethodPost, claimSourceEndpoint, `{"securityEnabledOnly":false}`
+	}
+
+	var groups []string
+	for page := 0; next != ""; page++ {
+		if page == maxMemberOfPages {
+			return nil, fmt.Errorf("the user has more than %d pages of groups", maxMemberOfPages)
+		}
+		req, err := newMemberOfRequest(method, next, body, accessToken)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := httpClient.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list the groups: %w", err)
+		}
+		memberOf, err := consumeMemberOfResponse(resp)
+		if err != nil {
+			return nil, err
+		}
+		pageGroups, err := memberOf.groups()
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, pageGroups...)
+		// the next pages are links to GET
+		method, next, body = http.MethodGet, memberOf.NextLink, ""
+	}
+	return groups, nil
+}
+
+func newMemberOfRequest(method, url, body, accessToken string) (*http.Request, error) {
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+	req, err := http.NewRequest(method, url, reader)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create the groups request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Accept", "application/json")
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return req, nil
+}
+
+// memberOfResponse is a page of a Graph memberOf or getMemberObjects response
+type memberOfResponse struct {
+	// Value holds directory objects for memberOf, or their IDs for getMemberObjects
+	Value    []json.RawMessage `json:"value"`
+	NextLink string            `json:"@odata.nextLink"`
+}
+
+func consumeMemberOfResponse(response *http.Response) (*memberOfResponse, error) {
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error listing the groups from %s: %s", response.Request.URL.Redacted(), response.Status)
+	}
+	data, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the groups response: %w", err)
+	}
+	memberOf := &memberOfResponse{}
+	if err := json.Unmarshal(data, memberOf); err != nil {
+		return nil, fmt.Errorf("failed to parse the groups response: %w", err)
+	}
+	return memberOf, nil
+}
+
+// groups returns the IDs of the groups of the page, skipping the other directory objects like roles
+func (r *memberOfResponse) groups() ([]string, error) {
+	var groups []string
+	for _, value := range r.Value {
+		var id string
+		if err := json.Unmarshal(value, &id); err == nil {
+			groups = append(groups, id)
+			continue
+		}
+		var object struct {
+			Type string `json:"@odata.type"`
+			ID   string `json:"id"`
+		}
+		if err := json.Unmarshal(value, &object); err != nil {
+			return nil, fmt.Errorf("invalid group %s in the groups response: %w", value, err)
+		}
+		if object.Type == "" || object.Type == "#microsoft.graph.group" {
+			groups = append(groups, object.ID)
+		}
+	}
+	return groups, nil
+}
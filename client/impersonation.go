@@ -0,0 +1,46 @@
+package client
+
+import (
+	"errors"
+)
+
+// elevatedSuffix is appended to the names of the user and context of a target to name its elevated user and context
+const elevatedSuffix = "-elevated"
+
+// Impersonation is the identity the elevated context of a target acts as on the API server, written to the
+// impersonation fields of its kubeconfig user
+type Impersonation struct {
+	// User is the user to impersonate
+	User string
+	// Groups are the groups to impersonate
+	Groups []string
+	// UID is the uid to impersonate
+	UID string
+}
+
+func validateImpersonation(user string, groups []string, uid string) error {
+	if user == "" && (len(groups) > 0 || uid != "") {
+		return errors.New("impersonate-groups and impersonate-uid require impersonate-user")
+	}
+	for _, group := range groups {
+		if group == "" {
+			return errors.New("impersonate-groups must not be empty")
+		}
+	}
+	return nil
+}
+
+// impersonation returns the impersonation of the profile, or else of the target, nil if neither has one
+func impersonation(target Target, profile *ProfileEntry) *Impersonation {
+	if profile != nil && profile.ImpersonateUser != "" {
+		return &Impersonation{User: profile.ImpersonateUser, Groups: profile.ImpersonateGroups, UID: profile.ImpersonateUID}
+	}
+	if target.targetEntry.ImpersonateUser != "" {
+		return &Impersonation{
+			User:   target.targetEntry.ImpersonateUser,
+			Groups: target.targetEntry.ImpersonateGroups,
+			UID:    target.targetEntry.ImpersonateUID,
+		}
+	}
+	return nil
+}
@@ -0,0 +1,215 @@
+package client
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"syscall"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/sky-uk/osprey/v2/common"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+const knownCAsHeader = "# Known API server CAs, trusted on first use by osprey: " +
+	"<provider>[@<profile>]/<target> <api-server> <SHA256 fingerprints>"
+
+// KnownCA is the fingerprint of the API server CA of a target, recorded the first time it was fetched.
+type KnownCA struct {
+	// Key is the provider, profile and target the CA was fetched for, as <provider>[@<profile>]/<target>
+	Key string
+	// Target is the name of the target
+	Target string
+	// APIServer is the URL the CA was fetched from
+	APIServer string
+	// Fingerprint is the comma-separated list of the SHA256 fingerprints of the certs of the CA bundle
+	Fingerprint string
+}
+
+// KnownCAs is a known-hosts style store of the API server CAs that osprey fetches from kube-public.
+// A CA is trusted the first time it is fetched for a target, and later logins are refused if it changes, unless
+// the user accepts the new one. The CAs are known per provider, profile and target. It is safe for concurrent use.
+type KnownCAs struct {
+	file *stateFile
+}
+
+// NewKnownCAs returns the store of known CAs saved in the file at path.
+func NewKnownCAs(path string) *KnownCAs {
+	file := newStateFile(path, "known CAs")
+	file.marshal, file.unmarshal = marshalKnownCAs, unmarshalKnownCAs
+	return &KnownCAs{file: file}
+}
+
+// Path returns the path of the file of the store
+func (k *KnownCAs) Path() string {
+	return k.file.path
+}
+
+// List returns the known CAs sorted by key.
+func (k *KnownCAs) List() ([]KnownCA, error) {
+	knownCAs := make(map[string]KnownCA)
+	if err := k.file.view(&knownCAs); err != nil {
+		return nil, err
+	}
+	var list []KnownCA
+	for _, knownCA := range knownCAs {
+		list = append(list, knownCA)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Key < list[j].Key })
+	return list, nil
+}
+
+// Forget removes the CAs of the targets from the store, so their next CA is trusted on first use again. A target is
+// either the key of a CA, or the name of a target whose CAs are all forgotten. It returns the targets that were known.
+func (k *KnownCAs) Forget(targets ...string) ([]string, error) {
+	knownCAs := make(map[string]KnownCA)
+	var forgotten []string
+	err := k.file.update(&knownCAs, func() bool {
+		for _, target := range targets {
+			known := false
+			for key, knownCA := range knownCAs {
+				if key == target || knownCA.Target == target {
+					delete(knownCAs, key)
+					known = true
+				}
+			}
+			if known {
+				forgotten = append(forgotten, target)
+			}
+		}
+		return len(forgotten) > 0
+	})
+	if err != nil {
+		return nil, err
+	}
+	return forgotten, nil
+}
+
+// Verify checks the base64-encoded PEM CA bundle fetched for the target logged in to with the profile against the
+// known one. Unknown CAs are recorded and trusted. If the CA changed, it is only replaced when acceptNewCA is set or
+// the user accepts it on the terminal, otherwise an error is returned.
+func (k *KnownCAs) Verify(target Target, profile, apiServer, caData string, acceptNewCA bool) error {
+	caPEM, err := base64.StdEncoding.DecodeString(caData)
+	if err != nil {
+		return fmt.Errorf("failed to decode the CA of %s: %w", apiServer, err)
+	}
+	fingerprint, err := CAFingerprint(caPEM)
+	if err != nil {
+		return fmt.Errorf("invalid CA from %s: %w", apiServer, err)
+	}
+
+	key := targetKey(target, profile)
+	knownCAs := make(map[string]KnownCA)
+	var verifyErr error
+	err = k.file.update(&knownCAs, func() bool {
+		known, ok := knownCAs[key]
+		if legacy, isLegacy := knownCAs[target.Name()]; !ok && isLegacy {
+			// the CAs were known by target name only before, which is moved to the key
+			known, ok = legacy, true
+			delete(knownCAs, target.Name())
+		}
+		switch {
+		case !ok:
+			log.Infof("Trusting the CA of %s on first use: %s", key, fingerprint)
+		case known.Fingerprint == fingerprint:
+			if known.Key == key {
+				return false
+			}
+		case acceptNewCA:
+			log.Warnf("Accepting the new CA of %s: %s, it was %s", key, fingerprint, known.Fingerprint)
+		case confirmNewCA(key, known.Fingerprint, fingerprint):
+			log.Infof("Accepted the new CA of %s", key)
+		default:
+			verifyErr = fmt.Errorf("the CA of %s changed from %s to %s. If the change is expected, log in with "+
+				"--accept-new-ca or run 'osprey config known-cas forget %s'", target.Name(), known.Fingerprint, fingerprint, key)
+			return false
+		}
+		knownCAs[key] = KnownCA{Key: key, Target: target.Name(), APIServer: apiServer, Fingerprint: fingerprint}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	return verifyErr
+}
+
+// CAFingerprint returns the comma-separated SHA256 fingerprints of the certs of the PEM-encoded CA bundle.
+func CAFingerprint(caPEM []byte) (string, error) {
+	var fingerprints []string
+	for block, rest := pem.Decode(caPEM); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		if _, err := x509.ParseCertificate(block.Bytes); err != nil {
+			return "", err
+		}
+		hash := sha256.Sum256(block.Bytes)
+		fingerprints = append(fingerprints, "SHA256:"+base64.RawStdEncoding.EncodeToString(hash[:]))
+	}
+	if len(fingerprints) == 0 {
+		return "", errors.New("no certificates found")
+	}
+	sort.Strings(fingerprints)
+	return strings.Join(fingerprints, ","), nil
+}
+
+// caDataFingerprint returns the fingerprint of the base64-encoded CA, or "invalid CA" if it cannot be parsed
+func caDataFingerprint(caData string) string {
+	caPEM, err := base64.StdEncoding.DecodeString(caData)
+	if err == nil {
+		var fingerprint string
+		if fingerprint, err = CAFingerprint(caPEM); err == nil {
+			return fingerprint
+		}
+	}
+	return "invalid CA"
+}
+
+// confirmNewCA asks the user on the terminal to accept a changed CA. It returns false if there is no terminal.
+func confirmNewCA(targetName, knownFingerprint, fingerprint string) bool {
+	if !terminal.IsTerminal(int(syscall.Stdin)) {
+		return false
+	}
+	var answer string
+	err := common.WithStdin(func(reader *bufio.Reader) (err error) {
+		fmt.Fprintf(os.Stderr, "WARNING: the CA of the API server of %s changed.\n  known:    %s\n  received: %s\n",
+			targetName, knownFingerprint, fingerprint)
+		answer, err = common.Read("answer", "Accept the new CA? [y/N]: ", reader, common.Input)
+		return err
+	})
+	return err == nil && strings.EqualFold(answer, "y")
+}
+
+func unmarshalKnownCAs(data []byte, entries interface{}) error {
+	knownCAs := *entries.(*map[string]KnownCA)
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			return fmt.Errorf("line %d: expected <provider>[@<profile>]/<target> <api-server> <fingerprints>", i+1)
+		}
+		key := fields[0]
+		target := key[strings.Index(key, "/")+1:]
+		knownCAs[key] = KnownCA{Key: key, Target: target, APIServer: fields[1], Fingerprint: fields[2]}
+	}
+	return nil
+}
+
+func marshalKnownCAs(entries interface{}) ([]byte, error) {
+	lines := []string{knownCAsHeader}
+	for _, knownCA := range *entries.(*map[string]KnownCA) {
+		lines = append(lines, fmt.Sprintf("%s %s %s", knownCA.Key, knownCA.APIServer, knownCA.Fingerprint))
+	}
+	sort.Strings(lines[1:])
+	return []byte(strings.Join(lines, "\n") + "\n"), nil
+}
@@ -0,0 +1,205 @@
+package client
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+const (
+	clusterInfoKubeconfigKey   = "kubeconfig"
+	clusterInfoSignaturePrefix = "jws-kubeconfig-"
+	caCertHashPrefix           = "sha256:"
+)
+
+var (
+	bootstrapTokenPattern = regexp.MustCompile(`^([a-z0-9]{6})\.([a-z0-9]{16})$`)
+	caCertHashPattern     = regexp.MustCompile(`^sha256:[a-f0-9]{64}$`)
+
+	errClusterInfoSignature  = errors.New("cluster-info signature verification failed")
+	errClusterInfoCACertHash = errors.New("cluster-info CA verification failed")
+)
+
+// clusterInfo is the kube-public/cluster-info ConfigMap published by kubeadm, holding a kubeconfig with the API
+// server URL and CA signed by the cluster's bootstrap tokens.
+type clusterInfo struct {
+	Data map[string]string `json:"data"`
+}
+
+// validateKubeadmDiscovery checks the options of targets that discover their cluster from kubeadm's cluster-info
+func validateKubeadmDiscovery(name string, target *TargetEntry) error {
+	if !target.UseKubeadmClusterInfo {
+		if target.BootstrapToken != "" || len(target.CACertHashes) > 0 {
+			return fmt.Errorf("%s: bootstrap-token and ca-cert-hashes require use-kubeadm-cluster-info:true", name)
+		}
+		return nil
+	}
+	if target.APIServer == "" {
+		return fmt.Errorf("%s: use-kubeadm-cluster-info:true requires api-server to be set", name)
+	}
+	if target.UseGKEClientConfig {
+		return fmt.Errorf("%s: use-gke-clientconfig and use-kubeadm-cluster-info are mutually exclusive", name)
+	}
+	if target.BootstrapToken == "" && len(target.CACertHashes) == 0 {
+		return fmt.Errorf("%s: use-kubeadm-cluster-info:true requires a bootstrap-token or ca-cert-hashes to verify the cluster-info", name)
+	}
+	if target.BootstrapToken != "" && !bootstrapTokenPattern.MatchString(target.BootstrapToken) {
+		return fmt.Errorf("%s: invalid bootstrap-token: must be of the form [a-z0-9]{6}.[a-z0-9]{16}", name)
+	}
+	for _, hash := range target.CACertHashes {
+		if !caCertHashPattern.MatchString(hash) {
+			return fmt.Errorf("%s: invalid ca-cert-hash %q: must be sha256:<hex-encoded SHA-256 hash>", name, hash)
+		}
+	}
+	return nil
+}
+
+func createClusterInfoConfigMapRequest(apiServer string) (*http.Request, error) {
+	return createKubePublicRequest(apiServer, "api/v1", "configmaps", "cluster-info")
+}
+
+func consumeClusterInfoConfigMapResponse(response *http.Response) (*clusterInfo, error) {
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error fetching cluster-info ConfigMap from API Server: %s", response.Status)
+	}
+	data, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cluster-info response from API Server: %w", err)
+	}
+	return parseClusterInfo(data)
+}
+
+func parseClusterInfo(data []byte) (*clusterInfo, error) {
+	info := &clusterInfo{}
+	if err := json.Unmarshal(data, info); err != nil {
+		return nil, fmt.Errorf("failed to parse cluster-info: %w", err)
+	}
+	if info.Data[clusterInfoKubeconfigKey] == "" {
+		return nil, errors.New("cluster-info has no kubeconfig")
+	}
+	return info, nil
+}
+
+// verify checks the signature of the cluster-info's kubeconfig with the target's bootstrap token, and its CA against
+// the target's ca-cert-hashes, and returns the cluster of the kubeconfig.
+func (c *clusterInfo) verify(bootstrapToken string, caCertHashes []string) (*api.Cluster, error) {
+	kubeconfig := c.Data[clusterInfoKubeconfigKey]
+	if bootstrapToken != "" {
+		if err := c.verifySignature(kubeconfig, bootstrapToken); err != nil {
+			return nil, fmt.Errorf("%w: %v", errClusterInfoSignature, err)
+		}
+	}
+
+	config, err := clientcmd.Load([]byte(kubeconfig))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the kubeconfig of the cluster-info: %w", err)
+	}
+	if len(config.Clusters) != 1 {
+		return nil, fmt.Errorf("the kubeconfig of the cluster-info has %d clusters, expected 1", len(config.Clusters))
+	}
+	var cluster *api.Cluster
+	for _, kubeconfigCluster := range config.Clusters {
+		cluster = kubeconfigCluster
+	}
+	if cluster.Server == "" || len(cluster.CertificateAuthorityData) == 0 {
+		return nil, errors.New("the kubeconfig of the cluster-info has no server or certificate-authority-data")
+	}
+
+	if len(caCertHashes) > 0 {
+		if err := verifyCACertHashes(cluster.CertificateAuthorityData, caCertHashes); err != nil {
+			return nil, fmt.Errorf("%w: %v", errClusterInfoCACertHash, err)
+		}
+	}
+	return cluster, nil
+}
+
+// verifySignature checks the detached HS256 JWS of the kubeconfig that kubeadm signs with the token's secret
+func (c *clusterInfo) verifySignature(kubeconfig, bootstrapToken string) error {
+	token := bootstrapTokenPattern.FindStringSubmatch(bootstrapToken)
+	if token == nil {
+		return errors.New("invalid bootstrap-token")
+	}
+	tokenID, tokenSecret := token[1], token[2]
+	signature, ok := c.Data[clusterInfoSignaturePrefix+tokenID]
+	if !ok {
+		return fmt.Errorf("no signature for the token %s, it may have expired or been deleted", tokenID)
+	}
+
+	parts := strings.Split(signature, ".")
+	if len(parts) != 3 || parts[1] != "" {
+		return fmt.Errorf("the signature for the token %s is not a detached JWS", tokenID)
+	}
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return fmt.Errorf("invalid JWS header: %w", err)
+	}
+	var header struct {
+		Algorithm string `json:"alg"`
+		KeyID     string `json:"kid"`
+	}
+	if err := json.Unmarshal(headerJSON, &header); err != nil {
+		return fmt.Errorf("invalid JWS header: %w", err)
+	}
+	if header.Algorithm != "HS256" {
+		return fmt.Errorf("unsupported JWS algorithm %q", header.Algorithm)
+	}
+	if header.KeyID != "" && header.KeyID != tokenID {
+		return fmt.Errorf("the signature is for the token %s, expected %s", header.KeyID, tokenID)
+	}
+	actual, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return fmt.Errorf("invalid JWS signature: %w", err)
+	}
+
+	mac := hmac.New(sha256.New, []byte(tokenSecret))
+	mac.Write([]byte(parts[0] + "." + base64.RawURLEncoding.EncodeToString([]byte(kubeconfig))))
+	if !hmac.Equal(actual, mac.Sum(nil)) {
+		return fmt.Errorf("the kubeconfig is not signed by the token %s", tokenID)
+	}
+	return nil
+}
+
+// caCertHash returns the kubeadm hash of the certificate's public key: sha256:<hex-encoded SHA-256 of its
+// SubjectPublicKeyInfo>, as given to 'kubeadm join --discovery-token-ca-cert-hash'.
+func caCertHash(cert *x509.Certificate) string {
+	hash := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return caCertHashPrefix + hex.EncodeToString(hash[:])
+}
+
+func verifyCACertHashes(caPEM []byte, caCertHashes []string) error {
+	var actual []string
+	for block, rest := pem.Decode(caPEM); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return fmt.Errorf("invalid CA certificate: %w", err)
+		}
+		hash := caCertHash(cert)
+		for _, expected := range caCertHashes {
+			if strings.EqualFold(hash, expected) {
+				return nil
+			}
+		}
+		actual = append(actual, hash)
+	}
+	if len(actual) == 0 {
+		return errors.New("no CA certificates")
+	}
+	return fmt.Errorf("the CA %s matches none of the ca-cert-hashes", strings.Join(actual, ", "))
+}
@@ -4,9 +4,12 @@ import (
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
 
 	"github.com/sky-uk/osprey/v2/client"
 
+	"k8s.io/apimachinery/pkg/runtime"
 	kubectl "k8s.io/client-go/tools/clientcmd"
 	clientgo "k8s.io/client-go/tools/clientcmd/api"
 )
@@ -32,13 +35,18 @@ func LoadConfig(kubeconfigFile string) error {
 }
 
 // UpdateConfig loads the current kubeconfig file and applies the changes described in the tokenData. Once applied, it
-// writes the changes to disk. It will use the specified name for the names of the cluster, user and context.
-// It will create an additional context for each of the aliases provided
-func UpdateConfig(name string, aliases []string, tokenData *client.TargetInfo) error {
+// writes the changes to disk. It will use the specified names for the cluster, user and contexts, and record their
+// owner in them. It returns a CollisionError, without writing, if an existing entry has another owner, unless forced.
+func UpdateConfig(names client.KubeconfigNames, tokenData *client.TargetInfo, force bool) error {
 	config, err := GetConfig()
 	if err != nil {
 		return fmt.Errorf("failed to load existing kubeconfig at %s: %w", pathOptions.GetDefaultFilename(), err)
 	}
+	if !force {
+		if err := checkCollisions(config, names); err != nil {
+			return err
+		}
+	}
 
 	cluster := clientgo.NewCluster()
 	cluster.CertificateAuthorityData, err = base64.StdEncoding.DecodeString(tokenData.ClusterCA)
@@ -47,7 +55,13 @@ func UpdateConfig(name string, aliases []string, tokenData *client.TargetInfo) e
 	}
 
 	cluster.Server = tokenData.ClusterAPIServerURL
-	config.Clusters[name] = cluster
+	cluster.ProxyURL = tokenData.ProxyURL
+	cluster.TLSServerName = tokenData.TLSServerName
+	cluster.DisableCompression = tokenData.DisableCompression
+	if err := setOwner(cluster.Extensions, names.Owner); err != nil {
+		return err
+	}
+	config.Clusters[names.Cluster] = cluster
 	authInfo := clientgo.NewAuthInfo()
 
 	if tokenData.AccessToken != "" {
@@ -65,41 +79,84 @@ func UpdateConfig(name string, aliases []string, tokenData *client.TargetInfo) e
 			Config: authProviderConfig,
 		}
 	}
-	config.AuthInfos[name] = authInfo
+	if err := setOwner(authInfo.Extensions, names.Owner); err != nil {
+		return err
+	}
+	config.AuthInfos[names.User] = authInfo
 
-	contexts := append(aliases, name)
-	for _, alias := range contexts {
-		context := clientgo.NewContext()
-		if oldContext, ok := config.Contexts[alias]; ok {
-			oldContext.DeepCopyInto(context)
+	for _, contextName := range names.Contexts {
+		if err := updateContext(config, contextName, names.Cluster, names.User, names.Owner); err != nil {
+			return err
+		}
+	}
+
+	if names.Impersonation != nil {
+		elevatedAuthInfo := authInfo.DeepCopy()
+		elevatedAuthInfo.Impersonate = names.Impersonation.User
+		elevatedAuthInfo.ImpersonateGroups = names.Impersonation.Groups
+		elevatedAuthInfo.ImpersonateUID = names.Impersonation.UID
+		config.AuthInfos[names.ElevatedUser] = elevatedAuthInfo
+		if err := updateContext(config, names.ElevatedContext, names.Cluster, names.ElevatedUser, names.Owner); err != nil {
+			return err
 		}
-		context.Cluster = name
-		context.AuthInfo = name
-		config.Contexts[alias] = context
 	}
 
 	return kubectl.ModifyConfig(pathOptions, *config, false)
 }
 
-// Remove deletes all items related to the specified target: cluster, context, user.
+// updateContext points the context to the cluster and user, keeping its other settings, e.g. the namespace
+func updateContext(config *clientgo.Config, name, cluster, user string, owner client.KubeconfigOwner) error {
+	context := clientgo.NewContext()
+	if oldContext, ok := config.Contexts[name]; ok {
+		oldContext.DeepCopyInto(context)
+	}
+	context.Cluster = cluster
+	context.AuthInfo = user
+	if context.Extensions == nil {
+		context.Extensions = make(map[string]runtime.Object)
+	}
+	if err := setOwner(context.Extensions, owner); err != nil {
+		return err
+	}
+	config.Contexts[name] = context
+	return nil
+}
+
+// Remove deletes the tokens of the specified users.
 // Returns an error if LoadConfig() has not been called.f
-func Remove(name string) error {
+func Remove(users ...string) error {
 	config, err := GetConfig()
 	if err != nil {
 		return fmt.Errorf("failed to load existing kubeconfig at %s: %w", pathOptions.GetDefaultFilename(), err)
 	}
-	if config.AuthInfos[name] != nil {
-		if config.AuthInfos[name].Token != "" {
-			config.AuthInfos[name].Token = ""
-		}
-		if config.AuthInfos[name].AuthProvider != nil {
-			config.AuthInfos[name].AuthProvider.Config["id-token"] = ""
+	modified := false
+	for _, user := range users {
+		if config.AuthInfos[user] != nil {
+			if config.AuthInfos[user].Token != "" {
+				config.AuthInfos[user].Token = ""
+			}
+			if config.AuthInfos[user].AuthProvider != nil {
+				config.AuthInfos[user].AuthProvider.Config["id-token"] = ""
+			}
+			modified = true
 		}
+	}
+	if modified {
 		return kubectl.ModifyConfig(pathOptions, *config, false)
 	}
 	return nil
 }
 
+// CheckCollisions returns a CollisionError if an existing entry of the names has another owner.
+// Returns an error if LoadConfig() has not been called.
+func CheckCollisions(names client.KubeconfigNames) error {
+	config, err := GetConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load existing kubeconfig at %s: %w", pathOptions.GetDefaultFilename(), err)
+	}
+	return checkCollisions(config, names)
+}
+
 // GetConfig returns the currently loaded configuration via LoadConfig().
 // Returns an error if LoadConfig() has not been called.
 func GetConfig() (*clientgo.Config, error) {
@@ -112,3 +169,53 @@ func GetConfig() (*clientgo.Config, error) {
 	}
 	return config, nil
 }
+
+// UseContext sets the current context of the kubeconfig to the specified context and writes the change to disk.
+// Returns an error if the context does not exist.
+func UseContext(name string) error {
+	config, err := GetConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load existing kubeconfig at %s: %w", pathOptions.GetDefaultFilename(), err)
+	}
+	if _, ok := config.Contexts[name]; !ok {
+		return fmt.Errorf("context %q not found in %s", name, pathOptions.GetDefaultFilename())
+	}
+	config.CurrentContext = name
+	return kubectl.ModifyConfig(pathOptions, *config, false)
+}
+
+// CheckWritable checks that the kubeconfig file, or the nearest existing directory it would be created in, can be
+// written by the current user. It returns the path of the kubeconfig file.
+func CheckWritable(kubeconfigFile string) (string, error) {
+	options := kubectl.NewDefaultPathOptions()
+	if kubeconfigFile != "" {
+		options.LoadingRules.ExplicitPath = kubeconfigFile
+	}
+	filename := options.GetDefaultFilename()
+
+	if _, err := os.Stat(filename); err == nil {
+		file, err := os.OpenFile(filename, os.O_WRONLY, 0)
+		if err != nil {
+			return filename, err
+		}
+		return filename, file.Close()
+	}
+
+	dir := filepath.Dir(filename)
+	for {
+		if _, err := os.Stat(dir); err == nil {
+			break
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+	file, err := os.CreateTemp(dir, ".osprey-doctor-")
+	if err != nil {
+		return filename, fmt.Errorf("cannot create %s: %w", filename, err)
+	}
+	file.Close()
+	return filename, os.Remove(file.Name())
+}
@@ -0,0 +1,114 @@
+package kubeconfig
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/sky-uk/osprey/v2/client"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgo "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// ownerExtension is the name of the extension that records the osprey config and target of the kubeconfig entries
+// written by osprey
+const ownerExtension = "osprey"
+
+// CollisionError is returned when a kubeconfig entry to write is not managed by the osprey config and target
+// logged in to, e.g. an entry of gcloud or az, or of a target of another osprey config.
+type CollisionError struct {
+	// Kind is the kind of entry: cluster, user or context
+	Kind string
+	// Name is the name of the entry
+	Name string
+	// Owner is the osprey config and target the entry belongs to, nil if it was not written by osprey
+	Owner *client.KubeconfigOwner
+}
+
+func (e *CollisionError) Error() string {
+	if e.Owner == nil {
+		return fmt.Sprintf("the kubeconfig %s %q was not written by osprey", e.Kind, e.Name)
+	}
+	return fmt.Sprintf("the kubeconfig %s %q belongs to the target %s of the osprey config %s", e.Kind, e.Name,
+		e.Owner.Target, e.Owner.Config)
+}
+
+// ownerOf returns the osprey config and target recorded in the extensions of an entry, nil if there are none
+func ownerOf(extensions map[string]runtime.Object) *client.KubeconfigOwner {
+	extension, ok := extensions[ownerExtension].(*runtime.Unknown)
+	if !ok {
+		return nil
+	}
+	owner := &client.KubeconfigOwner{}
+	if err := json.Unmarshal(extension.Raw, owner); err != nil {
+		return nil
+	}
+	return owner
+}
+
+func setOwner(extensions map[string]runtime.Object, owner client.KubeconfigOwner) error {
+	raw, err := json.Marshal(owner)
+	if err != nil {
+		return fmt.Errorf("failed to marshal the owner of the kubeconfig entries: %w", err)
+	}
+	extensions[ownerExtension] = &runtime.Unknown{Raw: raw, ContentType: runtime.ContentTypeJSON}
+	return nil
+}
+
+// checkOwner returns a CollisionError unless the entry belongs to the owner. Entries without an owner are taken over
+// if they were written by an older osprey, which did not record the owners.
+func checkOwner(kind, name string, extensions map[string]runtime.Object, owner client.KubeconfigOwner, writtenByOsprey bool) error {
+	entryOwner := ownerOf(extensions)
+	if (entryOwner == nil && writtenByOsprey) || (entryOwner != nil && *entryOwner == owner) {
+		return nil
+	}
+	return &CollisionError{Kind: kind, Name: name, Owner: entryOwner}
+}
+
+// checkCollisions returns a CollisionError if any of the existing entries of the names does not belong to their owner
+func checkCollisions(config *clientgo.Config, names client.KubeconfigNames) error {
+	if cluster, ok := config.Clusters[names.Cluster]; ok {
+		if err := checkOwner("cluster", names.Cluster, cluster.Extensions, names.Owner, clusterWrittenByOsprey(config, names.Cluster)); err != nil {
+			return err
+		}
+	}
+	for _, user := range names.Users() {
+		if authInfo, ok := config.AuthInfos[user]; ok {
+			if err := checkOwner("user", user, authInfo.Extensions, names.Owner, userWrittenByOsprey(authInfo)); err != nil {
+				return err
+			}
+		}
+	}
+	for _, contextName := range names.AllContexts() {
+		if context, ok := config.Contexts[contextName]; ok {
+			if err := checkOwner("context", contextName, context.Extensions, names.Owner, contextWrittenByOsprey(config, context)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// userWrittenByOsprey returns true if the user only has the credentials osprey writes: an oidc auth-provider or a
+// token, or none once logged out
+func userWrittenByOsprey(authInfo *clientgo.AuthInfo) bool {
+	return authInfo.Exec == nil && authInfo.TokenFile == "" && authInfo.Username == "" && authInfo.Password == "" &&
+		authInfo.ClientCertificate == "" && len(authInfo.ClientCertificateData) == 0 &&
+		(authInfo.AuthProvider == nil || authInfo.AuthProvider.Name == "oidc")
+}
+
+// contextWrittenByOsprey returns true if the user of the context is managed or written by osprey
+func contextWrittenByOsprey(config *clientgo.Config, context *clientgo.Context) bool {
+	authInfo, ok := config.AuthInfos[context.AuthInfo]
+	return !ok || ownerOf(authInfo.Extensions) != nil || userWrittenByOsprey(authInfo)
+}
+
+// clusterWrittenByOsprey returns true if all the contexts of the cluster are managed or written by osprey
+func clusterWrittenByOsprey(config *clientgo.Config, clusterName string) bool {
+	for _, context := range config.Contexts {
+		if context.Cluster == clusterName && ownerOf(context.Extensions) == nil && !contextWrittenByOsprey(config, context) {
+			return false
+		}
+	}
+	return true
+}
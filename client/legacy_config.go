@@ -16,29 +16,149 @@ type ConfigV1 struct {
 }
 
 // ProvidersV1 Single Provider config
-// Deprecated: This format is now deprecated. Use `Providers` instead
+// Deprecated: This format is now deprecated. Use `ProviderEntry` instead
 type ProvidersV1 struct {
 	Azure  *AzureConfig  `yaml:"azure,omitempty"`
 	Osprey *OspreyConfig `yaml:"osprey,omitempty"`
 }
 
+// ConfigV2 is the v2 version of the config file
+// Deprecated: This config format is now deprecated. Use `Config` format instead
+type ConfigV2 struct {
+	// APIVersion specifies the version of osprey config file used
+	APIVersion string `yaml:"apiVersion,omitempty"`
+	// Kubeconfig specifies the path to read/write the kubeconfig file.
+	// +optional
+	Kubeconfig string `yaml:"kubeconfig,omitempty"`
+	// DefaultGroup specifies the group to log in to if none provided.
+	// +optional
+	DefaultGroup string `yaml:"default-group,omitempty"`
+	// Providers is a map of OIDC provider config
+	Providers *ProvidersV2 `yaml:"providers,omitempty"`
+}
+
+// ProvidersV2 holds the configuration structs for the supported providers
+// Deprecated: This format is now deprecated. Use `ProviderEntry` instead
+type ProvidersV2 struct {
+	Azure  []*AzureConfig  `yaml:"azure,omitempty"`
+	Osprey []*OspreyConfig `yaml:"osprey,omitempty"`
+}
+
+// AzureConfig holds the configuration for Azure
+// Deprecated: This format is now deprecated. Use `ProviderEntry` with `AzureOptions` instead
+type AzureConfig struct {
+	// Name provides a named reference to the provider. For e.g sky-azure, nbcu-azure etc. Optional field
+	Name string `yaml:"name,omitempty"`
+	// ServerApplicationID is the oidc-client-id used on the apiserver configuration
+	ServerApplicationID string `yaml:"server-application-id,omitempty"`
+	// ClientID is the oidc client id used for osprey
+	ClientID string `yaml:"client-id,omitempty"`
+	// ClientSecret is the oidc client secret used for osprey
+	ClientSecret string `yaml:"client-secret,omitempty"`
+	// CertificateAuthority is the filesystem path from which to read the CA certificate
+	CertificateAuthority string `yaml:"certificate-authority,omitempty"`
+	// CertificateAuthorityData is base64-encoded CA cert data.
+	// This will override any cert file specified in CertificateAuthority.
+	// +optional
+	CertificateAuthorityData string `yaml:"certificate-authority-data,omitempty"`
+	// RedirectURI is the redirect URI that the oidc application is configured to call back to
+	RedirectURI string `yaml:"redirect-uri,omitempty"`
+	// Scopes is the list of scopes to request when performing the oidc login request
+	Scopes []string `yaml:"scopes"`
+	// AzureTenantID is the Azure Tenant ID assigned to your organisation
+	AzureTenantID string `yaml:"tenant-id,omitempty"`
+	// IssuerURL is the URL of the OpenID server. This is mainly used for testing.
+	// +optional
+	IssuerURL string `yaml:"issuer-url,omitempty"`
+	// Targets contains a map of strings to osprey targets
+	Targets map[string]*TargetEntry `yaml:"targets"`
+}
+
+// OspreyConfig holds the configuration for Osprey
+// Deprecated: This format is now deprecated. Use `ProviderEntry` with `OspreyOptions` instead
+type OspreyConfig struct {
+	// CertificateAuthority is the path to a cert file for the certificate authority.
+	// +optional
+	CertificateAuthority string `yaml:"certificate-authority,omitempty"`
+	// CertificateAuthorityData is base64-encoded CA cert data.
+	// This will override any cert file specified in CertificateAuthority.
+	// +optional
+	CertificateAuthorityData string `yaml:"certificate-authority-data,omitempty"`
+	// Targets contains a map of strings to osprey targets
+	Targets map[string]*TargetEntry `yaml:"targets"`
+	// Provider name
+	Name string `yaml:"provider-name,omitempty"`
+}
+
 func parseLegacyConfig(configData []byte) (*Config, error) {
-	config := &Config{}
 	configV1 := &ConfigV1{}
 	err := yaml.Unmarshal(configData, configV1)
 	if err != nil {
 		return nil, err
 	}
-	config.Kubeconfig = configV1.Kubeconfig
-	config.DefaultGroup = configV1.DefaultGroup
-	config.Providers = &Providers{}
+	configV2 := &ConfigV2{
+		Kubeconfig:   configV1.Kubeconfig,
+		DefaultGroup: configV1.DefaultGroup,
+		Providers:    &ProvidersV2{},
+	}
 
-	if configV1.Providers.Azure != nil {
-		config.Providers.Azure = []*AzureConfig{configV1.Providers.Azure}
+	if configV1.Providers != nil {
+		if configV1.Providers.Azure != nil {
+			configV2.Providers.Azure = []*AzureConfig{configV1.Providers.Azure}
+		}
+		if configV1.Providers.Osprey != nil {
+			configV2.Providers.Osprey = []*OspreyConfig{configV1.Providers.Osprey}
+		}
 	}
+	return configV2.toConfig(), nil
+}
 
-	if configV1.Providers.Osprey != nil {
-		config.Providers.Osprey = []*OspreyConfig{configV1.Providers.Osprey}
+func parseV2Config(configData []byte) (*Config, error) {
+	configV2 := &ConfigV2{}
+	err := yaml.Unmarshal(configData, configV2)
+	if err != nil {
+		return nil, err
+	}
+	return configV2.toConfig(), nil
+}
+
+// toConfig converts the v2 config into the current format, preserving the order of the providers per type.
+func (c *ConfigV2) toConfig() *Config {
+	config := &Config{
+		APIVersion:   ConfigVersionV3,
+		Kubeconfig:   c.Kubeconfig,
+		DefaultGroup: c.DefaultGroup,
+	}
+	if c.Providers == nil {
+		return config
+	}
+
+	for _, azureConfig := range c.Providers.Azure {
+		config.Providers = append(config.Providers, &ProviderEntry{
+			Name:                     azureConfig.Name,
+			Type:                     AzureProviderName,
+			CertificateAuthority:     azureConfig.CertificateAuthority,
+			CertificateAuthorityData: azureConfig.CertificateAuthorityData,
+			Azure: &AzureOptions{
+				ServerApplicationID: azureConfig.ServerApplicationID,
+				ClientID:            azureConfig.ClientID,
+				ClientSecret:        azureConfig.ClientSecret,
+				RedirectURI:         azureConfig.RedirectURI,
+				Scopes:              azureConfig.Scopes,
+				AzureTenantID:       azureConfig.AzureTenantID,
+				IssuerURL:           azureConfig.IssuerURL,
+			},
+			Targets: azureConfig.Targets,
+		})
+	}
+	for _, ospreyConfig := range c.Providers.Osprey {
+		config.Providers = append(config.Providers, &ProviderEntry{
+			Name:                     ospreyConfig.Name,
+			Type:                     OspreyProviderName,
+			CertificateAuthority:     ospreyConfig.CertificateAuthority,
+			CertificateAuthorityData: ospreyConfig.CertificateAuthorityData,
+			Targets:                  ospreyConfig.Targets,
+		})
 	}
-	return config, nil
+	return config
 }
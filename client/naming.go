@@ -0,0 +1,212 @@
+package client
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+)
+
+const (
+	defaultClusterNameTemplate = "{{.Target}}"
+	defaultUserNameTemplate    = "{{.Target}}{{if .Profile}}@{{.Profile}}{{end}}"
+	defaultContextNameTemplate = "{{.Alias}}{{if .Profile}}@{{.Profile}}{{end}}"
+)
+
+// KubeconfigNames are the names of the kubeconfig entries of the logins to a target with a profile
+type KubeconfigNames struct {
+	// Cluster is the name of the cluster entry, shared by the profiles
+	Cluster string
+	// User is the name of the user entry of the profile
+	User string
+	// Contexts are the names of the context entries of the profile, for the target and each of its aliases in order
+	Contexts []string
+	// ElevatedUser is the name of the user entry that impersonates the Impersonation, empty without one
+	ElevatedUser string
+	// ElevatedContext is the name of the context entry of the ElevatedUser, empty without an Impersonation
+	ElevatedContext string
+	// Impersonation is the impersonation of the profile or target, nil if neither has one
+	Impersonation *Impersonation
+	// Owner identifies the target the entries are written for
+	Owner KubeconfigOwner
+}
+
+// KubeconfigOwner is the target of an osprey config that the kubeconfig entries written by osprey belong to
+type KubeconfigOwner struct {
+	// Config is the absolute path of the osprey config
+	Config string `json:"config"`
+	// Target is the name of the target in the osprey config
+	Target string `json:"target"`
+}
+
+// nameData is the data the name templates are executed with
+type nameData struct {
+	// Target is the name of the target
+	Target string
+	// Group is the first group of the target, if any
+	Group string
+	// Provider is the name of the target's provider, e.g. sky-azure or provider-0 if unnamed
+	Provider string
+	// ProviderType is the type of the target's provider, azure or osprey
+	ProviderType string
+	// Profile is the profile logged in with, empty for the default identity
+	Profile string
+	// Alias is the target name or the alias the context is for, empty for the cluster and user names
+	Alias string
+}
+
+// naming generates the names of the kubeconfig entries from the name templates of the config
+type naming struct {
+	cluster, user, context *template.Template
+	configPath             string
+}
+
+func (c *Config) naming() (*naming, error) {
+	cluster, err := parseNameTemplate("cluster-name-template", c.ClusterNameTemplate, defaultClusterNameTemplate)
+	if err != nil {
+		return nil, err
+	}
+	user, err := parseNameTemplate("user-name-template", c.UserNameTemplate, defaultUserNameTemplate)
+	if err != nil {
+		return nil, err
+	}
+	context, err := parseNameTemplate("context-name-template", c.ContextNameTemplate, defaultContextNameTemplate)
+	if err != nil {
+		return nil, err
+	}
+	return &naming{cluster: cluster, user: user, context: context, configPath: c.path}, nil
+}
+
+func parseNameTemplate(name, text, defaultText string) (*template.Template, error) {
+	if text == "" {
+		text = defaultText
+	}
+	parsed, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	// fails on the fields that are not in the data, which would only fail when logging in
+	if err := parsed.Execute(io.Discard, nameData{}); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	return parsed, nil
+}
+
+func (n *naming) names(target Target, providerType, profile string) (KubeconfigNames, error) {
+	data := nameData{
+		Target:       target.Name(),
+		Provider:     strings.TrimPrefix(target.ProviderName(), providerType+":"),
+		ProviderType: providerType,
+		Profile:      profile,
+	}
+	if len(target.Groups()) > 0 {
+		data.Group = target.Groups()[0]
+	}
+
+	names := KubeconfigNames{Owner: KubeconfigOwner{Config: n.configPath, Target: target.Name()}}
+	var err error
+	if names.Cluster, err = executeNameTemplate(n.cluster, data); err != nil {
+		return names, err
+	}
+	if names.User, err = executeNameTemplate(n.user, data); err != nil {
+		return names, err
+	}
+	contexts := make(map[string]string)
+	for _, alias := range append([]string{target.Name()}, target.Aliases()...) {
+		data.Alias = alias
+		context, err := executeNameTemplate(n.context, data)
+		if err != nil {
+			return names, err
+		}
+		if other, ok := contexts[context]; ok {
+			return names, fmt.Errorf("the context-name-template gives the same name %q to %s and %s, use {{.Alias}} in it",
+				context, other, alias)
+		}
+		contexts[context] = alias
+		names.Contexts = append(names.Contexts, context)
+	}
+	return names, nil
+}
+
+func executeNameTemplate(nameTemplate *template.Template, data nameData) (string, error) {
+	var name strings.Builder
+	if err := nameTemplate.Execute(&name, data); err != nil {
+		return "", fmt.Errorf("invalid %s: %w", nameTemplate.Name(), err)
+	}
+	if strings.TrimSpace(name.String()) == "" {
+		return "", fmt.Errorf("the %s gives an empty name for %s", nameTemplate.Name(), data.Target)
+	}
+	return name.String(), nil
+}
+
+// KubeconfigNames returns the names of the kubeconfig entries of the logins to the target with the profile, "" for the
+// default identity, from the name templates of the config.
+func (t *ConfigSnapshot) KubeconfigNames(target Target, profile string) (KubeconfigNames, error) {
+	if t.namingErr != nil {
+		return KubeconfigNames{}, t.namingErr
+	}
+	providerType, err := t.GetProviderType(target.ProviderName())
+	if err != nil {
+		return KubeconfigNames{}, err
+	}
+	names, err := t.naming.names(target, providerType, profile)
+	if err != nil {
+		return names, err
+	}
+	if err := names.elevate(impersonation(target, t.ProviderConfigs()[target.ProviderName()].profile(profile))); err != nil {
+		return names, err
+	}
+	if profile == "" {
+		return names, nil
+	}
+
+	// the profiles must not overwrite the user and contexts of the default identity
+	defaultNames, err := t.naming.names(target, providerType, "")
+	if err != nil {
+		return names, err
+	}
+	if names.User == defaultNames.User {
+		return names, fmt.Errorf("the user-name-template gives the same name %q to the profile %s and the default identity, use {{.Profile}} in it",
+			names.User, profile)
+	}
+	for i, context := range names.Contexts {
+		if context == defaultNames.Contexts[i] {
+			return names, fmt.Errorf("the context-name-template gives the same name %q to the profile %s and the default identity, use {{.Profile}} in it",
+				context, profile)
+		}
+	}
+	return names, nil
+}
+
+// elevate sets the impersonation and the names of the elevated user and context, which are the ones of the user and
+// target context with a -elevated suffix
+func (n *KubeconfigNames) elevate(impersonation *Impersonation) error {
+	if impersonation == nil {
+		return nil
+	}
+	n.Impersonation = impersonation
+	n.ElevatedUser = n.User + elevatedSuffix
+	n.ElevatedContext = n.Contexts[0] + elevatedSuffix
+	for _, context := range n.Contexts {
+		if context == n.ElevatedContext {
+			return fmt.Errorf("the context-name-template gives the name %q of the elevated context to another context", context)
+		}
+	}
+	return nil
+}
+
+// Users returns the names of the user and, if any, elevated user entries
+func (n KubeconfigNames) Users() []string {
+	if n.ElevatedUser == "" {
+		return []string{n.User}
+	}
+	return []string{n.User, n.ElevatedUser}
+}
+
+// AllContexts returns the names of the contexts and, if any, elevated context entries
+func (n KubeconfigNames) AllContexts() []string {
+	if n.ElevatedContext == "" {
+		return n.Contexts
+	}
+	return append(append([]string{}, n.Contexts...), n.ElevatedContext)
+}
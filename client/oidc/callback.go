@@ -0,0 +1,299 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/oauth2"
+)
+
+// CallbackServer receives the redirects of the browser logins on the loopback addresses of their redirect URIs.
+// It is shared by the logins of a login run: it routes the redirects to the logins by their state and runs the
+// logins one after another, so that providers with the same redirect URI don't fight over its port and the user
+// goes through all of them in a single browser tab. It is safe for concurrent use.
+type CallbackServer struct {
+	mu sync.Mutex
+	// servers are the webservers listening on the addresses of the redirect URIs
+	servers map[string]*http.Server
+	// ephemeral are the addresses bound for the ephemeral ports of the loopback IPs, shared by their logins
+	ephemeral map[string]string
+	// logins are the pending logins in order, the first one is in progress
+	logins []*callbackLogin
+}
+
+// serverName identifies the call-back webservers in the Server header of their responses
+const serverName = "osprey"
+
+type callbackLogin struct {
+	// oAuthConfig is the config of the client, with the redirect URI of the address listened on
+	oAuthConfig oauth2.Config
+	ctx         context.Context
+	state       string
+	address     string
+	// path is the path of the redirect URI, the only one the redirects to the login are accepted on
+	path        string
+	authURL     string
+	description string
+	// turn is closed when the login is the one in progress
+	turn chan struct{}
+	// result receives the outcome of the first redirect to the login
+	result chan tokenResponse
+	// handedOff is set when the browser tab of the previous login was redirected to this one
+	handedOff bool
+}
+
+// NewCallbackServer returns a CallbackServer, which listens on the addresses of the redirect URIs on first use.
+func NewCallbackServer() *CallbackServer {
+	return &CallbackServer{servers: make(map[string]*http.Server), ephemeral: make(map[string]string)}
+}
+
+// Close stops the webservers.
+func (s *CallbackServer) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for address, server := range s.servers {
+		_ = server.Shutdown(context.Background())
+		delete(s.servers, address)
+	}
+	s.ephemeral = make(map[string]string)
+}
+
+// login queues a login of the client redirected to redirectURL, and waits for its turn. The redirect URI sent to the
+// issuer has the port bound when redirectURL has port 0.
+func (s *CallbackServer) login(ctx context.Context, client *Client, redirectURL *url.URL, state string) (*callbackLogin, error) {
+	s.mu.Lock()
+	address, err := s.listen(redirectURL.Host)
+	if err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+	redirect := *redirectURL
+	redirect.Host = address
+	oAuthConfig := client.oAuthConfig
+	oAuthConfig.RedirectURL = redirect.String()
+	login := &callbackLogin{
+		oAuthConfig: oAuthConfig,
+		ctx:         ctx,
+		state:       state,
+		address:     address,
+		path:        redirectPath(redirectURL),
+		authURL:     oAuthConfig.AuthCodeURL(state, client.authCodeOptions...),
+		description: client.description,
+		turn:        make(chan struct{}),
+		result:      make(chan tokenResponse, 1),
+	}
+	s.logins = append(s.logins, login)
+	if len(s.logins) == 1 {
+		close(login.turn)
+	}
+	s.mu.Unlock()
+
+	select {
+	case <-login.turn:
+		return login, nil
+	case <-ctx.Done():
+		s.done(login)
+		return nil, ctx.Err()
+	}
+}
+
+// done removes the login and starts the next one
+func (s *CallbackServer) done(login *callbackLogin) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, pending := range s.logins {
+		if pending == login {
+			s.logins = append(s.logins[:i], s.logins[i+1:]...)
+			if i == 0 && len(s.logins) > 0 {
+				close(s.logins[0].turn)
+			}
+			return
+		}
+	}
+}
+
+// listen starts a webserver on the address unless there is one already, and returns the address listened on, which
+// has the ephemeral port bound for port 0. It must be called with s.mu held.
+func (s *CallbackServer) listen(address string) (string, error) {
+	if bound, ok := s.ephemeral[address]; ok {
+		address = bound
+	}
+	if _, ok := s.servers[address]; ok {
+		return address, nil
+	}
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		if errors.Is(err, syscall.EADDRINUSE) {
+			return "", fmt.Errorf("unable to start local call-back webserver: %s is already in use by %s, "+
+				"free the port of the redirect uri or use an ephemeral loopback port", address, portHolder(address))
+		}
+		return "", fmt.Errorf("unable to start local call-back webserver %w", err)
+	}
+	if _, port, _ := net.SplitHostPort(address); port == "0" {
+		bound := listener.Addr().String()
+		s.ephemeral[address] = bound
+		address = bound
+	}
+	server := &http.Server{Handler: http.HandlerFunc(s.handle)}
+	s.servers[address] = server
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Errorf("Local call-back webserver on %s failed: %v", address, err)
+		}
+	}()
+	return address, nil
+}
+
+// handle redirects the requests to the root to the authorization URL of the login in progress, and completes the
+// login of the redirects from the issuer. The requests to other paths than the redirect URIs' are not found, and the
+// ones with the state of no pending login are refused without affecting the pending logins, so that they can't be
+// aborted by forged redirects.
+func (s *CallbackServer) handle(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Server", serverName)
+	query := r.URL.Query()
+	if r.URL.Path == "/" && query.Get("state") == "" && query.Get("code") == "" && query.Get("error") == "" {
+		s.mu.Lock()
+		var authURL string
+		if len(s.logins) > 0 {
+			authURL = s.logins[0].authURL
+		}
+		s.mu.Unlock()
+		if authURL == "" {
+			http.Error(w, "no login in progress", http.StatusNotFound)
+			return
+		}
+		http.Redirect(w, r, authURL, http.StatusFound)
+		return
+	}
+
+	s.mu.Lock()
+	var login *callbackLogin
+	redirectPath := false
+	for _, pending := range s.logins {
+		if pending.path != r.URL.Path {
+			continue
+		}
+		redirectPath = true
+		if pending.state == query.Get("state") {
+			login = pending
+		}
+	}
+	s.mu.Unlock()
+
+	if !redirectPath {
+		http.NotFound(w, r)
+		return
+	}
+	if login == nil {
+		http.Error(w, "state did not match", http.StatusBadRequest)
+		return
+	}
+
+	var response tokenResponse
+	if loginError := query.Get("error"); loginError != "" {
+		response.responseError = fmt.Errorf("the issuer refused the login: %s %s", loginError, query.Get("error_description"))
+	} else if token, err := login.oAuthConfig.Exchange(login.ctx, query.Get("code")); err != nil {
+		response.responseError = fmt.Errorf("failed to exchange token: %w", err)
+	} else {
+		response.accessToken = token
+	}
+	s.writePage(w, login, response.responseError)
+	login.finish(response)
+}
+
+// writePage tells the user how the login went, and hands the browser tab off to the next login, if any
+func (s *CallbackServer) writePage(w http.ResponseWriter, login *callbackLogin, err error) {
+	s.mu.Lock()
+	var next *callbackLogin
+	for i, pending := range s.logins {
+		if pending == login && i+1 < len(s.logins) {
+			next = s.logins[i+1]
+			next.handedOff = true
+		}
+	}
+	s.mu.Unlock()
+
+	title, message := "Osprey Logged In", "Successfully logged in"
+	status := http.StatusOK
+	if err != nil {
+		title, message = "Osprey Login Failed", "Failed to log in: "+err.Error()
+		status = http.StatusInternalServerError
+	}
+	if login.description != "" {
+		message = fmt.Sprintf("%s to %s", message, login.description)
+	}
+	script := "window.onload = setTimeout(function() { window.close(); }, 1000);"
+	if next != nil {
+		message = fmt.Sprintf("%s, continuing with %s...", message, next.description)
+		script = fmt.Sprintf("window.onload = setTimeout(function() { window.location.replace(%q); }, 1000);",
+			"http://"+next.address+"/")
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	_, _ = fmt.Fprintf(w, `<html>
+<head>
+<title>%s</title>
+<script type="text/javascript">
+%s
+</script>
+</head>
+<body>
+<h1>%s</h1>
+</body>
+</html>`, title, script, html.EscapeString(message))
+}
+
+// handedOff returns true if the browser tab of the previous login was redirected to the login
+func (s *CallbackServer) handedOff(login *callbackLogin) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return login.handedOff
+}
+
+func (l *callbackLogin) finish(response tokenResponse) {
+	select {
+	case l.result <- response:
+	default:
+		// the login already got its redirect
+	}
+}
+
+// wait waits for the redirect of the login, up to the timeout
+func (l *callbackLogin) wait(loginTimeout time.Duration) (*oauth2.Token, error) {
+	ctxTimeout, cancel := context.WithTimeout(l.ctx, loginTimeout)
+	defer cancel()
+	select {
+	case <-ctxTimeout.Done():
+		return nil, fmt.Errorf("exceeded login deadline")
+	case response := <-l.result:
+		return response.accessToken, response.responseError
+	}
+}
+
+// redirectPath returns the path of the redirect URL, / if it has none
+func redirectPath(redirectURL *url.URL) string {
+	if redirectURL.Path == "" {
+		return "/"
+	}
+	return redirectURL.Path
+}
+
+// newState returns a random state, to match the redirects to the logins and protect them against forgery
+func newState() (string, error) {
+	state := make([]byte, 16)
+	if _, err := rand.Read(state); err != nil {
+		return "", fmt.Errorf("unable to generate the login state: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(state), nil
+}
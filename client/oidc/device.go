@@ -12,18 +12,46 @@ import (
 	"strings"
 	"time"
 
+	"github.com/sky-uk/osprey/v2/common"
 	"golang.org/x/net/context/ctxhttp"
 	"golang.org/x/oauth2"
 )
 
-// DeviceFlowAuth contains the response for a device code oAuth flow.
+// DeviceFlowAuth contains the response of a device authorization endpoint, see RFC 8628.
 type DeviceFlowAuth struct {
 	UserCode        string `json:"user_code" yaml:"user-code"`
 	DeviceCode      string `json:"device_code"`
-	VerificationURI string `json:"verification_uri,verification_url"`
-	Message         string `json:"message"`
-	ExpiresIn       int    `json:"expires_in,omitempty"`
-	Interval        int    `json:"interval,omitempty"`
+	VerificationURI string `json:"verification_uri"`
+	// VerificationURIComplete is the VerificationURI with the UserCode, which the user doesn't have to type in
+	VerificationURIComplete string `json:"verification_uri_complete,omitempty"`
+	// VerificationURL is the VerificationURI of the issuers that predate RFC 8628, e.g. Google's
+	VerificationURL string `json:"verification_url,omitempty"`
+	// Message are the instructions of the issuers that give them, e.g. Azure's
+	Message   string `json:"message,omitempty"`
+	ExpiresIn int    `json:"expires_in,omitempty"`
+	Interval  int    `json:"interval,omitempty"`
+}
+
+// verificationURI returns the URL the user visits to log in, with the user code if the issuer gives it
+func (d *DeviceFlowAuth) verificationURI() string {
+	if d.VerificationURIComplete != "" {
+		return d.VerificationURIComplete
+	}
+	if d.VerificationURI != "" {
+		return d.VerificationURI
+	}
+	return d.VerificationURL
+}
+
+// instructions returns the message of the issuer, or one built from the verification URI and user code
+func (d *DeviceFlowAuth) instructions() string {
+	if d.Message != "" {
+		return d.Message
+	}
+	if d.VerificationURIComplete != "" {
+		return fmt.Sprintf("To sign in, open %s and check that it shows the code %s.", d.VerificationURIComplete, d.UserCode)
+	}
+	return fmt.Sprintf("To sign in, open %s and enter the code %s.", d.verificationURI(), d.UserCode)
 }
 
 type pollResponse struct {
@@ -33,23 +61,25 @@ type pollResponse struct {
 
 // authWithDeviceFlow attempts to authorise using the device code oAuth flow.
 func (c *Client) authWithDeviceFlow(ctx context.Context, loginTimeout time.Duration) (*oauth2.Token, error) {
+	if c.deviceAuthURL == "" {
+		return nil, errors.New("the issuer has no device_authorization_endpoint, it doesn't support the device-code flow")
+	}
 	c.oAuthConfig.RedirectURL = ""
-	// potential refactor: device_authorization_endpoint is now exposed by the Azure https://login.microsoftonline.com/<tenant-id>/v2.0/.well-known/openid-configuration
-	deviceAuthURL := strings.Replace(c.oAuthConfig.AuthCodeURL(ospreyState), "/authorize", "/devicecode", 1)
 	urlParams := url.Values{"client_id": {c.oAuthConfig.ClientID}}
 	if len(c.oAuthConfig.Scopes) > 0 {
 		urlParams.Set("scope", strings.Join(c.oAuthConfig.Scopes, " "))
 	}
 
-	req, err := http.NewRequest(http.MethodPost, deviceAuthURL, strings.NewReader(urlParams.Encode()))
+	req, err := http.NewRequest(http.MethodPost, c.deviceAuthURL, strings.NewReader(urlParams.Encode()))
 	if err != nil {
 		return nil, fmt.Errorf("unable to create request: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	response, err := ctxhttp.Do(ctx, nil, req)
+	response, err := ctxhttp.Do(ctx, c.httpClient, req)
 	if err != nil {
-		return nil, fmt.Errorf("unable to post form to %s: %w", deviceAuthURL, err)
+		return nil, fmt.Errorf("unable to post form to %s: %w", c.deviceAuthURL, err)
 	}
+	defer response.Body.Close()
 
 	body, err := ioutil.ReadAll(io.LimitReader(response.Body, 1<<20))
 	if err != nil {
@@ -64,11 +94,20 @@ func (c *Client) authWithDeviceFlow(ctx context.Context, loginTimeout time.Durat
 	if err = json.Unmarshal(body, deviceAuth); err != nil {
 		return nil, fmt.Errorf("unable to unmarshal device-flow response: %w", err)
 	}
+	if deviceAuth.DeviceCode == "" || deviceAuth.verificationURI() == "" {
+		return nil, fmt.Errorf("invalid device-flow response: %s", body)
+	}
 
-	// Print the message that is obtained from the previous request. This contains the message and URL from the OIDC provider
-	fmt.Println(deviceAuth.Message)
+	if c.description != "" {
+		fmt.Fprintf(common.PromptOutput, "Logging in to %s\n", c.description)
+	}
+	fmt.Fprintln(common.PromptOutput, deviceAuth.instructions())
+	if err := printQRCode(common.PromptOutput, deviceAuth.verificationURI()); err != nil {
+		fmt.Fprintf(common.PromptOutput, "Unable to show the QR code of the verification URL: %v\n", err)
+	}
 
-	ch := make(chan *pollResponse)
+	// buffered, so the poller doesn't block on it once the deadline is exceeded
+	ch := make(chan *pollResponse, 1)
 	ctxTimeout, cancel := context.WithTimeout(ctx, loginTimeout)
 	defer cancel()
 
@@ -81,7 +120,7 @@ func (c *Client) authWithDeviceFlow(ctx context.Context, loginTimeout time.Durat
 		return nil, fmt.Errorf("exceeded device-code login deadline")
 	case deviceCodePoll := <-ch:
 		if deviceCodePoll.error != nil {
-			return nil, fmt.Errorf("failed to fetch device-flow token: %w", err)
+			return nil, fmt.Errorf("failed to fetch device-flow token: %w", deviceCodePoll.error)
 		}
 
 		c.token = deviceCodePoll.Token
@@ -90,24 +129,32 @@ func (c *Client) authWithDeviceFlow(ctx context.Context, loginTimeout time.Durat
 	}
 }
 
+// The errors of the token endpoint while polling, see https://www.rfc-editor.org/rfc/rfc8628#section-3.5
 const (
 	errAuthorizationPending = "authorization_pending"
-	errBadVerificationCode  = "bad_verification_code"
-	errAccessDenied         = "authorization_declined"
-	errExpiredToken         = "expired_token"
 	errSlowDown             = "slow_down"
+	errAccessDenied         = "access_denied"
+	errExpiredToken         = "expired_token"
+	// errAuthorizationDeclined is Azure's
+	errAuthorizationDeclined = "authorization_declined"
 )
 
 func (c *Client) poll(ctx context.Context, df *DeviceFlowAuth) *pollResponse {
 	// If no interval was provided, the client MUST use a reasonable default polling interval.
-	// See https://tools.ietf.org/html/draft-ietf-oauth-device-flow-07#section-3.5
+	// See https://www.rfc-editor.org/rfc/rfc8628#section-3.2
 	interval := df.Interval
 	if interval == 0 {
 		interval = 5
 	}
 
 	for {
-		time.Sleep(time.Duration(interval) * time.Second)
+		timer := time.NewTimer(time.Duration(interval) * time.Second)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return &pollResponse{error: ctx.Err()}
+		case <-timer.C:
+		}
 		token, err := c.oAuthConfig.Exchange(ctx, df.DeviceCode,
 			oauth2.SetAuthURLParam("grant_type", "urn:ietf:params:oauth:grant-type:device_code"),
 			oauth2.SetAuthURLParam("device_code", df.DeviceCode))
@@ -117,22 +164,19 @@ func (c *Client) poll(ctx context.Context, df *DeviceFlowAuth) *pollResponse {
 				error: nil,
 			}
 		}
-		errType := parseError(err)
-		switch errType {
-		case errAccessDenied, errExpiredToken, errBadVerificationCode:
-			return &pollResponse{
-				Token: nil,
-				error: errors.New("oauth2: " + errType),
-			}
-		case errSlowDown:
-			interval = interval + 5
+		switch errType := parseError(err); errType {
 		case errAuthorizationPending:
 			continue
+		case errSlowDown:
+			interval = interval + 5
+		case errAccessDenied, errAuthorizationDeclined:
+			return &pollResponse{error: errors.New("the login was denied")}
+		case errExpiredToken:
+			return &pollResponse{error: errors.New("the device code expired before the login was completed")}
 		case "":
-			return &pollResponse{
-				nil,
-				errors.New("invalid response from azure device-code endpoint"),
-			}
+			return &pollResponse{error: fmt.Errorf("invalid response from the token endpoint: %w", err)}
+		default:
+			return &pollResponse{error: errors.New("oauth2: " + errType)}
 		}
 	}
 }
@@ -0,0 +1,88 @@
+package oidc
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/sky-uk/osprey/v2/common"
+	"golang.org/x/oauth2"
+)
+
+// authWithManualRedirect attempts to authorise by asking the user to open the authorization URL in a browser,
+// possibly on another machine, and to paste the URL it is redirected to.
+func (c *Client) authWithManualRedirect(ctx context.Context) (*oauth2.Token, error) {
+	redirectURL, err := c.redirectURL()
+	if err != nil {
+		return nil, err
+	}
+	if c.loopbackIP != "" {
+		// nothing listens on the redirect URI, which doesn't need a port
+		redirectURL.Host = c.loopbackIP
+		if net.ParseIP(c.loopbackIP).To4() == nil {
+			redirectURL.Host = "[" + c.loopbackIP + "]"
+		}
+	}
+	oAuthConfig := c.oAuthConfig
+	oAuthConfig.RedirectURL = redirectURL.String()
+	state, err := newState()
+	if err != nil {
+		return nil, err
+	}
+
+	// the manual logins prompt one at a time
+	var pasted string
+	err = common.WithStdin(func(reader *bufio.Reader) (err error) {
+		if c.description != "" {
+			fmt.Fprintf(common.PromptOutput, "Logging in to %s\n", c.description)
+		}
+		fmt.Fprintln(common.PromptOutput, "Open this URL in a browser to authenticate:")
+		fmt.Fprintln(common.PromptOutput, oAuthConfig.AuthCodeURL(state, c.authCodeOptions...))
+		fmt.Fprintf(common.PromptOutput, "The browser is then redirected to %s, which fails to load.\n", oAuthConfig.RedirectURL)
+		pasted, err = common.Read("redirect URL", "Paste the URL of the failed page: ", reader, common.Input)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	code, err := manualCode(pasted, state)
+	if err != nil {
+		return nil, err
+	}
+	token, err := oAuthConfig.Exchange(ctx, code)
+	if err != nil {
+		return nil, fmt.Errorf("failed to exchange token: %w", err)
+	}
+	c.token = token
+	return token, nil
+}
+
+// manualCode returns the code of the redirect URL pasted by the user, after checking its state. A code pasted on
+// its own is refused, as its state can't be checked.
+func manualCode(pasted, state string) (string, error) {
+	if pasted == "" {
+		return "", errors.New("no redirect URL was pasted")
+	}
+	if !strings.Contains(pasted, "?") {
+		return "", errors.New("paste the whole URL of the failed page, not only its code, for its state to be checked")
+	}
+	redirectURL, err := url.Parse(pasted)
+	if err != nil {
+		return "", fmt.Errorf("invalid redirect URL: %w", err)
+	}
+	query := redirectURL.Query()
+	if loginError := query.Get("error"); loginError != "" {
+		return "", fmt.Errorf("the issuer refused the login: %s %s", loginError, query.Get("error_description"))
+	}
+	if query.Get("state") != state {
+		return "", errors.New("state did not match")
+	}
+	if query.Get("code") == "" {
+		return "", errors.New("the redirect URL has no code")
+	}
+	return query.Get("code"), nil
+}
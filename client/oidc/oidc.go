@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"net/url"
 	"os/exec"
@@ -11,13 +12,12 @@ import (
 	"sync"
 	"time"
 
-	log "github.com/sirupsen/logrus"
+	"github.com/sky-uk/osprey/v2/common"
 	"golang.org/x/oauth2"
 )
 
-const (
-	ospreyState = "as78*sadf$212"
-)
+// defaultCallbackPath is the path of the loopback redirect URI when RedirectURL is not set
+const defaultCallbackPath = "/auth/callback"
 
 // Client contains the details for a OIDC client
 type Client struct {
@@ -26,9 +26,15 @@ type Client struct {
 	useDeviceCode       bool
 	disableBrowserPopup bool
 	loginTimeout        time.Duration
+	httpClient          *http.Client
 	token               *oauth2.Token
 	muLogin             sync.Mutex
-	stopChan            chan tokenResponse
+	callbackServer      *CallbackServer
+	description         string
+	loopbackIP          string
+	manual              bool
+	deviceAuthURL       string
+	authCodeOptions     []oauth2.AuthCodeOption
 }
 
 // Config contains the configuration for a OIDC client
@@ -38,6 +44,23 @@ type Config struct {
 	LoginTimeout        time.Duration
 	UseDeviceCode       bool
 	DisableBrowserPopup bool
+	// HTTPClient is used for the requests to the issuer. Defaults to http.DefaultClient.
+	HTTPClient *http.Client
+	// CallbackServer receives the redirects of the browser logins, shared with the other clients of the login run.
+	// The client starts its own if nil.
+	CallbackServer *CallbackServer
+	// Description names the login to the user, e.g. the tenant being authenticated.
+	Description string
+	// LoopbackIP is the loopback IP, 127.0.0.1 or ::1, to receive the redirects of the browser login on an ephemeral
+	// port, as allowed for native apps by RFC 8252. The path of RedirectURL is kept, with its host and port replaced.
+	// The host and port of RedirectURL are used if empty.
+	LoopbackIP string
+	// Manual logs in by asking the user to paste the URL the browser is redirected to, instead of receiving it.
+	Manual bool
+	// DeviceAuthURL is the device authorization endpoint of the issuer, required for the device-code flow.
+	DeviceAuthURL string
+	// AuthCodeOptions are added to the authorization requests of the browser logins, e.g. the login_hint.
+	AuthCodeOptions []oauth2.AuthCodeOption
 }
 
 // New returns a new OIDC client
@@ -54,7 +77,13 @@ func New(config Config) *Client {
 		loginTimeout:        config.LoginTimeout,
 		useDeviceCode:       config.UseDeviceCode,
 		disableBrowserPopup: config.DisableBrowserPopup,
-		stopChan:            make(chan tokenResponse),
+		httpClient:          config.HTTPClient,
+		callbackServer:      config.CallbackServer,
+		description:         config.Description,
+		loopbackIP:          config.LoopbackIP,
+		manual:              config.Manual,
+		deviceAuthURL:       config.DeviceAuthURL,
+		authCodeOptions:     config.AuthCodeOptions,
 	}
 }
 
@@ -72,130 +101,101 @@ func (c *Client) Token(ctx context.Context) (*oauth2.Token, error) {
 		return c.token, nil
 	}
 
+	if c.httpClient != nil {
+		ctx = context.WithValue(ctx, oauth2.HTTPClient, c.httpClient)
+	}
 	if c.useDeviceCode {
 		return c.authWithDeviceFlow(ctx, c.loginTimeout)
 	}
+	if c.manual {
+		return c.authWithManualRedirect(ctx)
+	}
 
 	return c.authWithOIDCCallback(ctx, c.loginTimeout, c.disableBrowserPopup)
 }
 
 // authWithOIDCCallback attempts to authorise using a local callback
 func (c *Client) authWithOIDCCallback(ctx context.Context, loginTimeout time.Duration, disableBrowserPopup bool) (*oauth2.Token, error) {
-	redirectURL, err := url.Parse(c.oAuthConfig.RedirectURL)
+	redirectURL, err := c.redirectURL()
 	if err != nil {
-		log.Fatalf("Unable to parse oidc redirect uri: %e", err)
+		return nil, err
 	}
-
-	authURL := c.oAuthConfig.AuthCodeURL(ospreyState)
-	mux := http.NewServeMux()
-	h := &http.Server{Addr: redirectURL.Host, Handler: mux}
-
-	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		http.Redirect(w, r, authURL, http.StatusFound)
-	})
-
-	mux.HandleFunc(redirectURL.Path, c.handleRedirectURI(ctx))
-
-	ch := make(chan error)
-	ctxTimeout, cancel := context.WithTimeout(ctx, loginTimeout)
-	defer cancel()
-
-	if disableBrowserPopup {
-		err = errors.New("browser popup disabled")
-	} else {
-		switch runtime.GOOS {
-		case "linux":
-			err = exec.Command("xdg-open", authURL).Start()
-		case "windows":
-			err = exec.Command("rundll32", "url.dll,FileProtocolHandler", authURL).Start()
-		case "darwin":
-			err = exec.Command("open", authURL).Start()
-		default:
-			err = fmt.Errorf("unknown OS %q", runtime.GOOS)
-		}
+	callbackServer := c.callbackServer
+	if callbackServer == nil {
+		callbackServer = NewCallbackServer()
+		defer callbackServer.Close()
 	}
 
+	state, err := newState()
 	if err != nil {
-		fmt.Printf("Unable to open browser: %v\n", err)
-		fmt.Println("Please use this URL to authenticate:")
-	} else {
-		fmt.Println("Opening browser window to authenticate:")
-	}
-	fmt.Printf("%s\n", authURL)
-
-	go func() {
-		ch <- h.ListenAndServe()
-	}()
-
-	select {
-	case <-ctxTimeout.Done():
-		_ = h.Shutdown(ctx)
-		return nil, fmt.Errorf("exceeded login deadline")
-	case err := <-ch:
-		return nil, fmt.Errorf("unable to start local call-back webserver %w", err)
-	case resp := <-c.stopChan:
-		_ = h.Shutdown(ctx)
-		if resp.responseError != nil {
-			return nil, resp.responseError
-		}
-
-		c.token = resp.accessToken
-
-		return resp.accessToken, nil
+		return nil, err
 	}
-}
+	login, err := callbackServer.login(ctx, c, redirectURL, state)
+	if err != nil {
+		return nil, err
+	}
+	defer callbackServer.done(login)
+	authURL := login.authURL
 
-func (c *Client) handleRedirectURI(ctx context.Context) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		defer close(c.stopChan)
-		if r.URL.Query().Get("state") != ospreyState {
-			err := fmt.Errorf("state did not match")
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			c.stopChan <- tokenResponse{
-				nil,
-				err,
-			}
-			return
+	if c.description != "" {
+		fmt.Fprintf(common.PromptOutput, "Logging in to %s\n", c.description)
+	}
+	if callbackServer.handedOff(login) {
+		fmt.Fprintln(common.PromptOutput, "Continuing in the same browser window, or use this URL to authenticate:")
+	} else {
+		if disableBrowserPopup {
+			err = errors.New("browser popup disabled")
+		} else {
+			err = openBrowser(authURL)
 		}
-
-		oauth2Token, err := c.doAuthRequest(ctx, r)
 		if err != nil {
-			err := fmt.Errorf("failed to exchange token: %w", err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			c.stopChan <- tokenResponse{
-				nil,
-				err,
-			}
-			return
+			fmt.Fprintf(common.PromptOutput, "Unable to open browser: %v\n", err)
+			fmt.Fprintln(common.PromptOutput, "Please use this URL to authenticate:")
+		} else {
+			fmt.Fprintln(common.PromptOutput, "Opening browser window to authenticate:")
 		}
+	}
+	fmt.Fprintf(common.PromptOutput, "%s\n", authURL)
 
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte(`<html>
-<head>
-<title>Osprey Logged In</title>
-<script type="text/javascript">
-function closeWindow() {
-  window.close();
+	token, err := login.wait(loginTimeout)
+	if err != nil {
+		return nil, err
+	}
+	c.token = token
+	return token, nil
 }
-window.onload = setTimeout(closeWindow, 1000);
-</script>
-</head>
-<body>
-<h1>Successfully logged in...</h1>
-</body>
-</html>`))
-
-		c.stopChan <- tokenResponse{
-			oauth2Token,
-			nil,
-		}
+
+// redirectURL returns the redirect URI to listen on, with port 0 for an ephemeral loopback port
+func (c *Client) redirectURL() (*url.URL, error) {
+	redirectURL, err := url.Parse(c.oAuthConfig.RedirectURL)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse oidc redirect uri: %w", err)
 	}
+	if c.loopbackIP == "" {
+		return redirectURL, nil
+	}
+	if ip := net.ParseIP(c.loopbackIP); ip == nil || !ip.IsLoopback() {
+		return nil, fmt.Errorf("%s is not a loopback IP", c.loopbackIP)
+	}
+	redirectURL.Scheme = "http"
+	redirectURL.Host = net.JoinHostPort(c.loopbackIP, "0")
+	if redirectURL.Path == "" {
+		redirectURL.Path = defaultCallbackPath
+	}
+	return redirectURL, nil
 }
 
-func (c *Client) doAuthRequest(ctx context.Context, r *http.Request) (*oauth2.Token, error) {
-	authCode := r.URL.Query().Get("code")
-	var authCodeOptions []oauth2.AuthCodeOption
-	return c.oAuthConfig.Exchange(ctx, authCode, authCodeOptions...)
+func openBrowser(url string) error {
+	switch runtime.GOOS {
+	case "linux":
+		return exec.Command("xdg-open", url).Start()
+	case "windows":
+		return exec.Command("rundll32", "url.dll,FileProtocolHandler", url).Start()
+	case "darwin":
+		return exec.Command("open", url).Start()
+	default:
+		return fmt.Errorf("unknown OS %q", runtime.GOOS)
+	}
 }
 
 // Authenticated returns a true or false value if a given OIDC client has received a successful login
@@ -0,0 +1,142 @@
+package oidc
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// portHolder names what is listening on the address: the process holding its port when it can be found, and whether
+// it is the call-back webserver of another osprey login
+func portHolder(address string) string {
+	holder := "another process"
+	switch server := webserverOf(address); server {
+	case serverName:
+		holder = "another osprey login"
+	case "":
+	default:
+		holder = fmt.Sprintf("another process (a %s webserver)", server)
+	}
+	_, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return holder
+	}
+	if pid, command, ok := listeningProcess(port); ok {
+		return fmt.Sprintf("%s: %s (pid %d)", holder, command, pid)
+	}
+	return holder
+}
+
+// webserverOf returns the Server header of the webserver listening on the address, if any
+func webserverOf(address string) string {
+	client := &http.Client{
+		Timeout:       time.Second,
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	resp, err := client.Get("http://" + address + "/")
+	if err != nil {
+		return ""
+	}
+	_ = resp.Body.Close()
+	return resp.Header.Get("Server")
+}
+
+// listeningProcess returns the pid and command of the process listening on the TCP port, from /proc on Linux and
+// from lsof elsewhere. It returns false if the process can't be found, e.g. when it belongs to another user.
+func listeningProcess(port string) (int, string, bool) {
+	if runtime.GOOS == "linux" {
+		return procListeningProcess(port)
+	}
+	return lsofListeningProcess(port)
+}
+
+// procListeningProcess looks the listening socket of the port up in /proc/net, then the process that has it open
+func procListeningProcess(port string) (int, string, bool) {
+	portNumber, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return 0, "", false
+	}
+	inodes := make(map[string]bool)
+	for _, table := range []string{"/proc/net/tcp", "/proc/net/tcp6"} {
+		for _, inode := range listeningInodes(table, portNumber) {
+			inodes["socket:["+inode+"]"] = true
+		}
+	}
+	if len(inodes) == 0 {
+		return 0, "", false
+	}
+	fds, _ := filepath.Glob("/proc/[0-9]*/fd/*")
+	for _, fd := range fds {
+		if link, err := os.Readlink(fd); err != nil || !inodes[link] {
+			continue
+		}
+		procDir := filepath.Dir(filepath.Dir(fd))
+		pid, err := strconv.Atoi(filepath.Base(procDir))
+		if err != nil {
+			continue
+		}
+		command, err := os.ReadFile(filepath.Join(procDir, "comm"))
+		if err != nil {
+			return pid, "unknown command", true
+		}
+		return pid, strings.TrimSpace(string(command)), true
+	}
+	return 0, "", false
+}
+
+// listeningInodes returns the inodes of the sockets listening on the port in the /proc/net TCP table
+func listeningInodes(table string, port uint64) []string {
+	file, err := os.Open(table)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+	// the TCP state of listening sockets, see include/net/tcp_states.h
+	const tcpListen = "0A"
+	var inodes []string
+	scanner := bufio.NewScanner(file)
+	scanner.Scan() // the header
+	for scanner.Scan() {
+		// sl local_address rem_address st tx_queue:rx_queue tr:tm->when retrnsmt uid timeout inode ...
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 || fields[3] != tcpListen {
+			continue
+		}
+		localAddress := fields[1]
+		separator := strings.LastIndex(localAddress, ":")
+		if separator < 0 {
+			continue
+		}
+		if localPort, err := strconv.ParseUint(localAddress[separator+1:], 16, 16); err == nil && localPort == port {
+			inodes = append(inodes, fields[9])
+		}
+	}
+	return inodes
+}
+
+// lsofListeningProcess asks lsof for the process listening on the port, if lsof is installed
+func lsofListeningProcess(port string) (int, string, bool) {
+	out, err := exec.Command("lsof", "-nP", "-iTCP:"+port, "-sTCP:LISTEN", "-Fpc").Output()
+	if err != nil {
+		return 0, "", false
+	}
+	// lsof prints a field per line, prefixed by its name: p for the pid and c for the command
+	pid, command := 0, ""
+	for _, line := range strings.Split(string(out), "\n") {
+		switch {
+		case strings.HasPrefix(line, "p") && pid == 0:
+			pid, _ = strconv.Atoi(line[1:])
+		case strings.HasPrefix(line, "c") && command == "":
+			command = line[1:]
+		}
+	}
+	return pid, command, pid != 0
+}
@@ -0,0 +1,77 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context/ctxhttp"
+	"golang.org/x/oauth2"
+)
+
+// TokenForScopes redeems the refresh token of the login for an access token of other scopes, e.g. the ones of another
+// resource like Microsoft Graph, without logging in again. The login must have been done with the offline_access
+// scope for the issuer to return a refresh token.
+// See https://learn.microsoft.com/en-us/entra/identity-platform/v2-oauth2-auth-code-flow#refresh-the-access-token
+func (c *Client) TokenForScopes(ctx context.Context, token *oauth2.Token, scopes ...string) (*oauth2.Token, error) {
+	if token == nil || token.RefreshToken == "" {
+		return nil, errors.New("the issuer returned no refresh token, add the offline_access scope to the provider")
+	}
+	// the refresh requests of the oauth2 package don't send the scopes, which pick the resource of the token
+	form := url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {token.RefreshToken},
+		"client_id":     {c.oAuthConfig.ClientID},
+		"scope":         {strings.Join(scopes, " ")},
+	}
+	if c.oAuthConfig.ClientSecret != "" {
+		form.Set("client_secret", c.oAuthConfig.ClientSecret)
+	}
+	req, err := http.NewRequest(http.MethodPost, c.oAuthConfig.Endpoint.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("unable to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	response, err := ctxhttp.Do(ctx, c.httpClient, req)
+	if err != nil {
+		return nil, fmt.Errorf("unable to post form to %s: %w", c.oAuthConfig.Endpoint.TokenURL, err)
+	}
+	defer response.Body.Close()
+
+	body, err := ioutil.ReadAll(io.LimitReader(response.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the token response: %w", err)
+	}
+	if code := response.StatusCode; code < 200 || code > 299 {
+		return nil, fmt.Errorf("HTTP error %d: %s", code, body)
+	}
+
+	var tokenResponse struct {
+		AccessToken  string `json:"access_token"`
+		TokenType    string `json:"token_type"`
+		RefreshToken string `json:"refresh_token"`
+		ExpiresIn    int64  `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &tokenResponse); err != nil {
+		return nil, fmt.Errorf("unable to unmarshal the token response: %w", err)
+	}
+	if tokenResponse.AccessToken == "" {
+		return nil, fmt.Errorf("the token response has no access token: %s", body)
+	}
+	scopedToken := &oauth2.Token{
+		AccessToken:  tokenResponse.AccessToken,
+		TokenType:    tokenResponse.TokenType,
+		RefreshToken: tokenResponse.RefreshToken,
+	}
+	if tokenResponse.ExpiresIn > 0 {
+		scopedToken.Expiry = time.Now().Add(time.Duration(tokenResponse.ExpiresIn) * time.Second)
+	}
+	return scopedToken, nil
+}
@@ -21,18 +21,45 @@ func parseError(err error) string {
 }
 
 type wellKnownConfiguration struct {
-	AuthEndpoint  string `json:"authorization_endpoint"`
-	TokenEndpoint string `json:"token_endpoint"`
+	Issuer         string `json:"issuer"`
+	AuthEndpoint   string `json:"authorization_endpoint"`
+	TokenEndpoint  string `json:"token_endpoint"`
+	DeviceEndpoint string `json:"device_authorization_endpoint"`
+	JWKSURI        string `json:"jwks_uri"`
+}
+
+// Endpoints are the endpoints of an issuer, from its well-known OIDC config
+type Endpoints struct {
+	oauth2.Endpoint
+	// DeviceAuthURL is the device_authorization_endpoint, empty if the issuer doesn't support the device-code flow
+	DeviceAuthURL string
+	// Issuer is the issuer of the tokens, as in their iss claim
+	Issuer string
+	// JWKSURL is the jwks_uri serving the keys the tokens are signed with
+	JWKSURL string
 }
 
 // GetWellKnownConfig constructs a request to return the OIDC well-known config
 func GetWellKnownConfig(issuerURL string) (*oauth2.Endpoint, error) {
+	return GetWellKnownConfigWithClient(http.DefaultClient, issuerURL)
+}
+
+// GetWellKnownConfigWithClient returns the OIDC well-known config using the given client, e.g. to go through a proxy
+func GetWellKnownConfigWithClient(client *http.Client, issuerURL string) (*oauth2.Endpoint, error) {
+	endpoints, err := GetEndpointsWithClient(client, issuerURL)
+	if err != nil {
+		return nil, err
+	}
+	return &endpoints.Endpoint, nil
+}
+
+// GetEndpointsWithClient returns the endpoints of the OIDC well-known config using the given client
+func GetEndpointsWithClient(client *http.Client, issuerURL string) (*Endpoints, error) {
 	wellknownConfig := &wellKnownConfiguration{}
 	_, err := url.Parse(issuerURL)
 	if err != nil {
 		return nil, fmt.Errorf("unable to parse issuer-url: %w", err)
 	}
-	client := http.DefaultClient
 	request, err := http.NewRequest(http.MethodGet, issuerURL, nil)
 	if err != nil {
 		return nil, fmt.Errorf("unable to create request: %w", err)
@@ -49,8 +76,13 @@ func GetWellKnownConfig(issuerURL string) (*oauth2.Endpoint, error) {
 	if err := json.Unmarshal(body, wellknownConfig); err != nil {
 		return nil, fmt.Errorf("unable to unmarshal well-known configuration response: %w", err)
 	}
-	return &oauth2.Endpoint{
-		AuthURL:  wellknownConfig.AuthEndpoint,
-		TokenURL: wellknownConfig.TokenEndpoint,
+	return &Endpoints{
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  wellknownConfig.AuthEndpoint,
+			TokenURL: wellknownConfig.TokenEndpoint,
+		},
+		DeviceAuthURL: wellknownConfig.DeviceEndpoint,
+		Issuer:        wellknownConfig.Issuer,
+		JWKSURL:       wellknownConfig.JWKSURI,
 	}, nil
 }
@@ -0,0 +1,130 @@
+package oidc
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	gooidc "github.com/coreos/go-oidc"
+)
+
+// expiryLeeway is the clock skew tolerated between this machine and the issuer when checking the expiry of the tokens
+const expiryLeeway = time.Minute
+
+// VerifierConfig configures the verification of the tokens of an issuer
+type VerifierConfig struct {
+	// Issuers are the iss claims accepted, the issuer of the well-known config and any other it issues tokens as
+	Issuers []string
+	// JWKSURL is the jwks_uri of the issuer, serving the keys it signs the tokens with
+	JWKSURL string
+	// Audience must be one of the aud claims of the tokens, and AudienceName names its setting in the errors,
+	// e.g. server-application-id
+	Audience     string
+	AudienceName string
+	// UsernameClaim is the claim the API server takes the username from, which the tokens must have
+	UsernameClaim string
+	// HTTPClient is used to fetch the keys. Defaults to http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+// Verifier verifies the signature, issuer, audience and expiry of the tokens of an issuer
+type Verifier struct {
+	config VerifierConfig
+	keySet gooidc.KeySet
+}
+
+// NewVerifier returns a verifier of the tokens of an issuer, which fetches its keys on first use
+func NewVerifier(config VerifierConfig) *Verifier {
+	ctx := context.Background()
+	if config.HTTPClient != nil {
+		ctx = gooidc.ClientContext(ctx, config.HTTPClient)
+	}
+	return &Verifier{config: config, keySet: gooidc.NewRemoteKeySet(ctx, config.JWKSURL)}
+}
+
+// tokenClaims are the claims of a token that are verified
+type tokenClaims struct {
+	Issuer   string          `json:"iss"`
+	Audience json.RawMessage `json:"aud"`
+	Expiry   *float64        `json:"exp"`
+}
+
+// audiences returns the aud claim, which is a single string or a list of them
+func (c tokenClaims) audiences() []string {
+	var audience string
+	if err := json.Unmarshal(c.Audience, &audience); err == nil {
+		return []string{audience}
+	}
+	var audiences []string
+	_ = json.Unmarshal(c.Audience, &audiences)
+	return audiences
+}
+
+// Verify returns an error explaining the mismatch if the token was not issued by the issuer for the audience, has
+// expired, has no username claim, or is not signed by one of the keys of the issuer.
+func (v *Verifier) Verify(ctx context.Context, token string) error {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return fmt.Errorf("the token is not a JWT, it has %d parts instead of 3", len(parts))
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return fmt.Errorf("the token is not a JWT, its payload is not base64url-encoded: %w", err)
+	}
+	var claims tokenClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return fmt.Errorf("the token is not a JWT, its payload is not a JSON object: %w", err)
+	}
+
+	if !contains(v.config.Issuers, claims.Issuer) {
+		return fmt.Errorf("the token was issued by %q instead of %s", claims.Issuer, quoteAll(v.config.Issuers, " or "))
+	}
+	if audiences := claims.audiences(); !contains(audiences, v.config.Audience) {
+		return fmt.Errorf("the token is for the audience %s instead of the %s %q", quoteAll(audiences, ", "),
+			v.config.AudienceName, v.config.Audience)
+	}
+	if claims.Expiry == nil {
+		return errors.New("the token has no expiry")
+	}
+	if expiry := time.Unix(int64(*claims.Expiry), 0); expiry.Add(expiryLeeway).Before(time.Now()) {
+		return fmt.Errorf("the token expired at %s, check the clock of this machine", expiry.Format(time.RFC3339))
+	}
+	if v.config.UsernameClaim != "" {
+		var allClaims map[string]interface{}
+		_ = json.Unmarshal(payload, &allClaims)
+		if _, ok := allClaims[v.config.UsernameClaim]; !ok {
+			return fmt.Errorf("the token has no %q claim, set the username-claim of the provider to the one the API server uses",
+				v.config.UsernameClaim)
+		}
+	}
+	if _, err := v.keySet.VerifySignature(ctx, token); err != nil {
+		return fmt.Errorf("the token is not signed by any of the keys of the issuer at %s: %w", v.config.JWKSURL, err)
+	}
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// quoteAll formats the values as a list of quoted strings, e.g. "a" or "b"
+func quoteAll(values []string, separator string) string {
+	if len(values) == 0 {
+		return "none"
+	}
+	quoted := make([]string, len(values))
+	for i, value := range values {
+		quoted[i] = fmt.Sprintf("%q", value)
+	}
+	return strings.Join(quoted, separator)
+}
@@ -1,13 +1,16 @@
 package client
 
 import (
+	"context"
 	"encoding/base64"
 	"errors"
 	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/SermoDigital/jose/jws"
 	log "github.com/sirupsen/logrus"
+	"github.com/sky-uk/osprey/v2/client/oidc"
 	"github.com/sky-uk/osprey/v2/common/pb"
 	webClient "github.com/sky-uk/osprey/v2/common/web"
 	"k8s.io/client-go/tools/clientcmd/api"
@@ -16,27 +19,55 @@ import (
 // OspreyProviderName is the constant string value for the osprey provider
 const OspreyProviderName = "osprey"
 
-// OspreyConfig holds the configuration for Osprey
-type OspreyConfig struct {
-	// CertificateAuthority is the path to a cert file for the certificate authority.
+// ospreyUsernameClaim is the claim of the id tokens of the osprey servers the username is taken from by default
+const ospreyUsernameClaim = "email"
+
+// OspreyOptions holds the options specific to providers of type osprey
+type OspreyOptions struct {
+	// ClientCertificate is the path to the PEM-encoded certificate presented to osprey servers that require
+	// client certificates. Targets may override it.
+	// +optional
+	ClientCertificate string `yaml:"client-certificate,omitempty"`
+	// ClientKey is the path to the PEM-encoded private key of the ClientCertificate.
+	// +optional
+	ClientKey string `yaml:"client-key,omitempty"`
+	// IssuerURL is the issuer the id tokens returned by the osprey servers must be issued by. The login is refused if
+	// an osprey server names another issuer, instead of verifying the tokens against the issuer it names. Targets may
+	// override it.
 	// +optional
-	CertificateAuthority string `yaml:"certificate-authority,omitempty"`
-	// CertificateAuthorityData is base64-encoded CA cert data.
-	// This will override any cert file specified in CertificateAuthority.
+	IssuerURL string `yaml:"issuer-url,omitempty"`
+	// ClientID is the client id the id tokens returned by the osprey servers must be issued for. Targets may override
+	// it.
 	// +optional
-	CertificateAuthorityData string `yaml:"certificate-authority-data,omitempty"`
-	// AzureTenantID is the Azure Tenant ID assigned to your organisation
-	Targets map[string]*TargetEntry `yaml:"targets"`
-	// Provider name
-	Name string `yaml:"provider-name,omitempty"`
+	ClientID string `yaml:"client-id,omitempty"`
+	// IssuerCAData is the base64-encoded CA of the issuer, trusted instead of the one named by the osprey servers.
+	// Targets may override it.
+	// +optional
+	IssuerCAData string `yaml:"issuer-ca-data,omitempty"`
 }
 
-// ValidateConfig checks that the required configuration has been provided for Osprey
-func (oc *OspreyConfig) ValidateConfig() error {
-	if len(oc.Targets) == 0 {
+func (oo *OspreyOptions) validate(targets map[string]*TargetEntry) error {
+	if len(targets) == 0 {
 		return errors.New("at least one target server should be present for osprey")
 	}
-	for name, target := range oc.Targets {
+	if oo != nil && (oo.ClientCertificate == "") != (oo.ClientKey == "") {
+		return errors.New("client-certificate and client-key must be set together")
+	}
+	if oo != nil {
+		if _, err := base64.StdEncoding.DecodeString(oo.IssuerCAData); err != nil {
+			return fmt.Errorf("invalid issuer-ca-data: %w", err)
+		}
+	}
+	for name, target := range targets {
+		if (target.ClientCertificate == "") != (target.ClientKey == "") {
+			return fmt.Errorf("%s: client-certificate and client-key must be set together", name)
+		}
+		if _, err := base64.StdEncoding.DecodeString(target.IssuerCAData); err != nil {
+			return fmt.Errorf("%s: invalid issuer-ca-data: %w", name, err)
+		}
+		if target.UseKubeadmClusterInfo {
+			return fmt.Errorf("%s: Osprey targets may not use the kubeadm cluster-info", name)
+		}
 		if target.APIServer != "" {
 			return fmt.Errorf("%s: Osprey targets may not fetch the CA from the API Server", name)
 		}
@@ -49,10 +80,28 @@ func (oc *OspreyConfig) ValidateConfig() error {
 
 // NewOspreyRetriever creates new osprey client
 func NewOspreyRetriever(provider *ProviderConfig, options RetrieverOptions) (Retriever, error) {
+	profile := provider.profile(options.Profile)
+	username := options.Username
+	if username == "" && profile != nil {
+		username = profile.Username
+	}
+	usernameClaim := provider.usernameClaim
+	if usernameClaim == "" {
+		usernameClaim = ospreyUsernameClaim
+	}
+	groupsClaim := provider.groupsClaim
+	if groupsClaim == "" {
+		groupsClaim = defaultGroupsClaim
+	}
 	return &ospreyRetriever{
 		serverCertificateAuthorityData: provider.certificateAuthorityData,
+		options:                        provider.osprey,
+		profile:                        options.Profile,
+		profileEntry:                   profile,
+		usernameClaim:                  usernameClaim,
+		groupsClaim:                    groupsClaim,
 		credentials: &LoginCredentials{
-			Username: options.Username,
+			Username: username,
 			Password: options.Password,
 		},
 	}, nil
@@ -60,10 +109,65 @@ func NewOspreyRetriever(provider *ProviderConfig, options RetrieverOptions) (Ret
 
 type ospreyRetriever struct {
 	serverCertificateAuthorityData string
-	credentials                    *LoginCredentials
+	options                        *OspreyOptions
+	// profile is the profile the user logs in with, "" for the default one, and profileEntry its configuration
+	profile      string
+	profileEntry *ProfileEntry
+	credentials  *LoginCredentials
+	// usernameClaim and groupsClaim are the claims of the id tokens the username and groups are taken from
+	usernameClaim string
+	groupsClaim   string
+}
+
+// clientCertificateFor returns the paths of the client certificate and key of the profile, or else of the target, or
+// else of the provider
+func (oo *OspreyOptions) clientCertificateFor(target Target, profile *ProfileEntry) (string, string) {
+	if profile != nil && profile.ClientCertificate != "" {
+		return profile.ClientCertificate, profile.ClientKey
+	}
+	if target.ClientCertificate() != "" || oo == nil {
+		return target.ClientCertificate(), target.ClientKey()
+	}
+	return oo.ClientCertificate, oo.ClientKey
 }
 
-func (r *ospreyRetriever) RetrieveUserDetails(target Target, authInfo api.AuthInfo) (*UserInfo, error) {
+// pinnedIssuer returns the issuer URL, client id and base64-encoded issuer CA pinned for the id tokens of the target,
+// by the target or else the provider. They are empty when not pinned.
+func (oo *OspreyOptions) pinnedIssuer(target Target) (string, string, string) {
+	issuerURL, clientID, issuerCAData := target.IssuerURL(), target.ClientID(), target.IssuerCAData()
+	if oo == nil {
+		return issuerURL, clientID, issuerCAData
+	}
+	if issuerURL == "" {
+		issuerURL = oo.IssuerURL
+	}
+	if clientID == "" {
+		clientID = oo.ClientID
+	}
+	if issuerCAData == "" {
+		issuerCAData = oo.IssuerCAData
+	}
+	return issuerURL, clientID, issuerCAData
+}
+
+// checkPinnedIssuer refuses the issuer and client id named by the osprey server if they differ from the pinned ones,
+// and trusts the pinned issuer CA instead of the one it named. Otherwise the id token could only be verified against
+// the issuer named by the same server that returned it.
+func (r *ospreyRetriever) checkPinnedIssuer(target Target, targetInfo *TargetInfo) error {
+	issuerURL, clientID, issuerCAData := r.options.pinnedIssuer(target)
+	if issuerURL != "" && strings.TrimSuffix(targetInfo.IssuerURL, "/") != strings.TrimSuffix(issuerURL, "/") {
+		return fmt.Errorf("the osprey server named the issuer %q instead of the issuer-url %q", targetInfo.IssuerURL, issuerURL)
+	}
+	if clientID != "" && targetInfo.ClientID != clientID {
+		return fmt.Errorf("the osprey server named the client id %q instead of the client-id %q", targetInfo.ClientID, clientID)
+	}
+	if issuerCAData != "" {
+		targetInfo.IssuerCA = issuerCAData
+	}
+	return nil
+}
+
+func (r *ospreyRetriever) RetrieveUserDetails(target Target, _ string, authInfo api.AuthInfo) (*UserInfo, error) {
 	if authInfo.AuthProvider == nil {
 		return nil, fmt.Errorf("no authprovider configured, please 'osprey user login'")
 	}
@@ -85,14 +189,8 @@ func (r *ospreyRetriever) RetrieveUserDetails(target Target, authInfo api.AuthIn
 		return nil, fmt.Errorf("failed to parse user token for %s: %w", target.Name(), err)
 	}
 
-	user := jwt.Claims().Get("email")
-	claimedGroups := jwt.Claims().Get("groups")
-	var groups []string
-	if claimedGroups != nil {
-		for _, group := range claimedGroups.([]interface{}) {
-			groups = append(groups, group.(string))
-		}
-	}
+	user := jwt.Claims().Get(r.usernameClaim)
+	groups, _ := claimGroups(jwt.Claims().Get(r.groupsClaim))
 
 	return &UserInfo{
 		Username: fmt.Sprintf("%s", user),
@@ -101,7 +199,16 @@ func (r *ospreyRetriever) RetrieveUserDetails(target Target, authInfo api.AuthIn
 }
 
 func (r *ospreyRetriever) RetrieveClusterDetailsAndAuthTokens(target Target) (*TargetInfo, error) {
-	httpClient, err := webClient.NewTLSClient(target.ShouldSkipTLSVerify(), r.serverCertificateAuthorityData, target.CertificateAuthorityData())
+	clientCertificate, clientKey := r.options.clientCertificateFor(target, r.profileEntry)
+	httpClient, err := webClient.NewClient(webClient.ClientOptions{
+		SkipVerify:        target.ShouldSkipTLSVerify(),
+		CACerts:           []string{r.serverCertificateAuthorityData, target.CertificateAuthorityData()},
+		ProxyURL:          target.ProxyURL(),
+		IPFamily:          target.IPFamily(),
+		PinnedPublicKeys:  target.PinnedPublicKeys(),
+		ClientCertificate: clientCertificate,
+		ClientKey:         clientKey,
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -126,7 +233,7 @@ func (r *ospreyRetriever) RetrieveClusterDetailsAndAuthTokens(target Target) (*T
 	if err != nil {
 		return nil, err
 	}
-	return &TargetInfo{
+	targetInfo := &TargetInfo{
 		Username:            accessToken.User.Username,
 		ClientID:            accessToken.Provider.ClientID,
 		ClientSecret:        accessToken.Provider.ClientSecret,
@@ -136,11 +243,54 @@ func (r *ospreyRetriever) RetrieveClusterDetailsAndAuthTokens(target Target) (*T
 		ClusterName:         accessToken.Cluster.Name,
 		ClusterAPIServerURL: accessToken.Cluster.ApiServerURL,
 		ClusterCA:           accessToken.Cluster.ApiServerCA,
-	}, nil
+		ProxyURL:            target.ProxyURL(),
+		TLSServerName:       target.TLSServerName(),
+		DisableCompression:  target.DisableCompression(),
+	}
+	if target.ShouldUseStaticClusterDetails() {
+		targetInfo.ClusterAPIServerURL = target.APIServerURL()
+		targetInfo.ClusterCA = target.APIServerCAData()
+	}
+	if err := r.checkPinnedIssuer(target, targetInfo); err != nil {
+		return nil, fmt.Errorf("failed to verify the id token of %s: %w", target.Name(), err)
+	}
+	if err := r.verifyIDToken(target, targetInfo); err != nil {
+		return nil, fmt.Errorf("failed to verify the id token of %s: %w", target.Name(), err)
+	}
+	return targetInfo, nil
+}
+
+// verifyIDToken verifies the id token returned by the osprey server with the keys of its issuer, for its client id
+func (r *ospreyRetriever) verifyIDToken(target Target, targetInfo *TargetInfo) error {
+	httpClient, err := webClient.NewClient(webClient.ClientOptions{
+		CACerts:  []string{targetInfo.IssuerCA},
+		ProxyURL: target.ProxyURL(),
+		IPFamily: target.IPFamily(),
+	})
+	if err != nil {
+		return fmt.Errorf("unable to create the issuer client: %w", err)
+	}
+	wellKnownURL := strings.TrimSuffix(targetInfo.IssuerURL, "/") + "/.well-known/openid-configuration"
+	endpoints, err := oidc.GetEndpointsWithClient(httpClient, wellKnownURL)
+	if err != nil {
+		return fmt.Errorf("unable to query well-known oidc config: %w", err)
+	}
+	if endpoints.JWKSURL == "" {
+		return fmt.Errorf("the well-known oidc config %s has no jwks_uri to verify the tokens with", wellKnownURL)
+	}
+	verifier := oidc.NewVerifier(oidc.VerifierConfig{
+		Issuers:       []string{targetInfo.IssuerURL},
+		JWKSURL:       endpoints.JWKSURL,
+		Audience:      targetInfo.ClientID,
+		AudienceName:  "client id of the osprey server",
+		UsernameClaim: r.usernameClaim,
+		HTTPClient:    httpClient,
+	})
+	return verifier.Verify(context.Background(), targetInfo.IDToken)
 }
 
-func (r *ospreyRetriever) GetAuthInfo(config *api.Config, target Target) *api.AuthInfo {
-	authInfo := config.AuthInfos[target.Name()]
+func (r *ospreyRetriever) GetAuthInfo(config *api.Config, user string) *api.AuthInfo {
+	authInfo := config.AuthInfos[user]
 	if authInfo == nil || authInfo.AuthProvider == nil {
 		return nil
 	}
@@ -0,0 +1,96 @@
+package client
+
+import (
+	"fmt"
+	"regexp"
+)
+
+var profileNamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]*$`)
+
+// ProfileEntry is an identity the user logs in to the targets of a provider with, selected with --profile, in
+// addition to their default one. Each profile has its own kubeconfig users and contexts, e.g. prod.cluster@admin.
+type ProfileEntry struct {
+	// Name of the profile, appended to the names of the kubeconfig users and contexts of its logins by default.
+	Name string `yaml:"name" jsonschema:"required"`
+	// Username is the user logging in to the osprey servers with the profile, instead of the one asked for.
+	// +optional
+	Username string `yaml:"username,omitempty"`
+	// ClientCertificate is the path to the PEM-encoded certificate presented to the osprey servers with the profile,
+	// instead of the one of the target or provider.
+	// +optional
+	ClientCertificate string `yaml:"client-certificate,omitempty"`
+	// ClientKey is the path to the PEM-encoded private key of the ClientCertificate.
+	// +optional
+	ClientKey string `yaml:"client-key,omitempty"`
+	// LoginHint is the account of the azure logins of the profile. Defaults to the account the user last logged in
+	// with to the provider with the profile.
+	// +optional
+	LoginHint string `yaml:"login-hint,omitempty"`
+	// DomainHint is the domain hint of the azure logins of the profile, instead of the one of the provider.
+	// +optional
+	DomainHint string `yaml:"domain-hint,omitempty"`
+	// Prompt is the prompt of the azure logins of the profile, instead of the one of the provider.
+	// +optional
+	Prompt string `yaml:"prompt,omitempty" jsonschema:"enum=select_account|login|consent"`
+	// ImpersonateUser is the user the elevated contexts of the profile impersonate, instead of the one of the target.
+	// +optional
+	ImpersonateUser string `yaml:"impersonate-user,omitempty"`
+	// ImpersonateGroups are the groups the elevated contexts of the profile impersonate. Requires ImpersonateUser.
+	// +optional
+	ImpersonateGroups []string `yaml:"impersonate-groups,omitempty"`
+	// ImpersonateUID is the uid the elevated contexts of the profile impersonate. Requires ImpersonateUser.
+	// +optional
+	ImpersonateUID string `yaml:"impersonate-uid,omitempty"`
+}
+
+func validateProfiles(providerType string, profiles []*ProfileEntry) error {
+	names := make(map[string]bool)
+	for i, profile := range profiles {
+		if profile == nil {
+			return fmt.Errorf("profile %d is empty", i)
+		}
+		if !profileNamePattern.MatchString(profile.Name) {
+			return fmt.Errorf("invalid profile name %q: must be letters, digits, '.', '_' or '-'", profile.Name)
+		}
+		if names[profile.Name] {
+			return fmt.Errorf("duplicate profile %q", profile.Name)
+		}
+		names[profile.Name] = true
+		if err := validateImpersonation(profile.ImpersonateUser, profile.ImpersonateGroups, profile.ImpersonateUID); err != nil {
+			return fmt.Errorf("profile %s: %w", profile.Name, err)
+		}
+
+		switch providerType {
+		case AzureProviderName:
+			if profile.Username != "" || profile.ClientCertificate != "" || profile.ClientKey != "" {
+				return fmt.Errorf("profile %s: username, client-certificate and client-key are only supported for osprey providers", profile.Name)
+			}
+			if err := validatePrompt(profile.Prompt); err != nil {
+				return fmt.Errorf("profile %s: %w", profile.Name, err)
+			}
+		case OspreyProviderName:
+			if profile.LoginHint != "" || profile.DomainHint != "" || profile.Prompt != "" {
+				return fmt.Errorf("profile %s: login-hint, domain-hint and prompt are only supported for azure providers", profile.Name)
+			}
+			if (profile.ClientCertificate == "") != (profile.ClientKey == "") {
+				return fmt.Errorf("profile %s: client-certificate and client-key must be set together", profile.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// profileKey returns the key of the profile of a provider: the provider name itself for the default profile, "", or
+// else <provider>@<profile>.
+func profileKey(providerName, profile string) string {
+	if profile == "" {
+		return providerName
+	}
+	return providerName + "@" + profile
+}
+
+// targetKey returns the key of a target logged in to with a profile, unique across the providers and their profiles:
+// <provider>/<target> for the default profile, or else <provider>@<profile>/<target>.
+func targetKey(target Target, profile string) string {
+	return profileKey(target.ProviderName(), profile) + "/" + target.Name()
+}
@@ -1,16 +1,52 @@
 package client
 
-// ProviderConfig is a super struct i.e many fields don't apply for osprey config/setup. Maybe there's a better way :shrug:
+const (
+	// IDTokenType writes the id tokens to the kubeconfig
+	IDTokenType = "id"
+	// AccessTokenType writes the access tokens to the kubeconfig
+	AccessTokenType = "access"
+	// defaultGroupsClaim is the claim the groups are taken from unless the provider sets one
+	defaultGroupsClaim = "groups"
+)
+
+// ProviderConfig is the configuration of a single provider as seen by its retriever.
+// Only the options block matching providerType is set.
 type ProviderConfig struct {
 	name                     string
-	serverApplicationID      string
-	clientID                 string
-	clientSecret             string
+	providerType             string
 	certificateAuthority     string
 	certificateAuthorityData string
-	redirectURI              string
-	scopes                   []string
-	azureTenantID            string
-	issuerURL                string
-	providerType             string
+	proxyURL                 string
+	azure                    *AzureOptions
+	osprey                   *OspreyOptions
+	profiles                 []*ProfileEntry
+	// usernameClaim, groupsClaim and tokenType are the ones set on the provider, empty for the defaults
+	usernameClaim string
+	groupsClaim   string
+	tokenType     string
+}
+
+// Profiles returns the names of the profiles of the provider, in the order they are configured
+func (p *ProviderConfig) Profiles() []string {
+	var names []string
+	for _, profile := range p.profiles {
+		names = append(names, profile.Name)
+	}
+	return names
+}
+
+// HasProfile returns true if the provider has a profile of the given name, or the name is the one of the default
+// profile, ""
+func (p *ProviderConfig) HasProfile(name string) bool {
+	return name == "" || p.profile(name) != nil
+}
+
+// profile returns the profile of the given name, nil for the default profile, "", or if the provider has none
+func (p *ProviderConfig) profile(name string) *ProfileEntry {
+	for _, profile := range p.profiles {
+		if profile.Name == name {
+			return profile
+		}
+	}
+	return nil
 }
@@ -3,6 +3,7 @@ package client
 import (
 	"time"
 
+	"github.com/sky-uk/osprey/v2/client/oidc"
 	clientgo "k8s.io/client-go/tools/clientcmd/api"
 )
 
@@ -26,8 +27,15 @@ type TargetInfo struct {
 	ClusterAPIServerURL string
 	// ClusterCA base64 encoded CA of the cluster that can be accessed with the IDToken
 	ClusterCA string
-	// AccessToken is the JWT token for the user when using a cloud IDP
+	// AccessToken is the bearer token written for the user when using a cloud IDP, its access or id token as set by the
+	// token-type of the provider
 	AccessToken string
+	// ProxyURL URL of the proxy used to reach the apiserver of the cluster, empty to connect directly
+	ProxyURL string
+	// TLSServerName the server name used to verify the certificate of the apiserver, empty to use its host
+	TLSServerName string
+	// DisableCompression true if clients should not request compressed responses from the apiserver
+	DisableCompression bool
 }
 
 // UserInfo contains data about a user
@@ -40,12 +48,13 @@ type UserInfo struct {
 
 // Retriever is used to authenticate and generate the configuration
 type Retriever interface {
-	// GetAuthInfo returns the AuthInfo from the kubeconfig for a given target. Returns an AuthInfo if the user is logged in.
-	GetAuthInfo(*clientgo.Config, Target) *clientgo.AuthInfo
+	// GetAuthInfo returns the AuthInfo of the given user from the kubeconfig. Returns an AuthInfo if the user is logged in.
+	GetAuthInfo(*clientgo.Config, string) *clientgo.AuthInfo
 	// RetrieveClusterDetailsAndAuthTokens returns an access token that is required to authenticate user access against a kubernetes cluster.
 	RetrieveClusterDetailsAndAuthTokens(Target) (*TargetInfo, error)
-	// RetrieveUserDetails returns the user email address and groups, if available.
-	RetrieveUserDetails(Target, clientgo.AuthInfo) (*UserInfo, error)
+	// RetrieveUserDetails returns the user email address and groups, if available, of the target logged in to with the
+	// profile.
+	RetrieveUserDetails(Target, string, clientgo.AuthInfo) (*UserInfo, error)
 	// SetUseDeviceCode is a flag that when set to false, creates non-interactive login requests to auth providers (e.g. device flow)
 	SetUseDeviceCode(bool)
 }
@@ -57,4 +66,24 @@ type RetrieverOptions struct {
 	DisableBrowserPopup bool
 	Username            string
 	Password            string
+	// Manual logs in by asking the user to paste the URL the browser is redirected to, for sessions without a browser
+	Manual bool
+	// LoginHint, DomainHint and Prompt override the ones of the providers, see AzureOptions
+	LoginHint  string
+	DomainHint string
+	Prompt     string
+	// Profile is the profile of the providers the user logs in with, "" for their default one
+	Profile string
+	// Accounts remembers the accounts the user logged in with, to hint them on the next logins. Not remembered if nil.
+	Accounts *Accounts
+	// KnownCAs records the API server CAs fetched from kube-public, trusted on first use. Not checked if nil.
+	KnownCAs *KnownCAs
+	// AcceptNewCA replaces the known CAs that changed instead of failing the login
+	AcceptNewCA bool
+	// ClusterCache caches the discovered cluster details, used when the discovery fails. Not cached if nil.
+	ClusterCache *ClusterCache
+	// GroupsCache caches the groups resolved for the users whose token has too many to list them. Not cached if nil.
+	GroupsCache *GroupsCache
+	// CallbackServer receives the redirects of the browser logins of all the providers. Each login starts its own if nil.
+	CallbackServer *oidc.CallbackServer
 }
@@ -0,0 +1,116 @@
+package client
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+const jsonSchemaDraft = "http://json-schema.org/draft-07/schema#"
+
+// ConfigSchema generates the JSON Schema for the current Config format, for use by editors to validate
+// and complete osprey config files.
+// Property names are taken from the yaml tags. The jsonschema tag can mark a property as "required" and
+// restrict its values with "enum=a|b". An enum property marked "discriminator" selects the properties marked
+// "when=a", which are only allowed, and only required if marked so, when the discriminator is a.
+func ConfigSchema() ([]byte, error) {
+	schema := schemaFor(reflect.TypeOf(Config{}))
+	schema["$schema"] = jsonSchemaDraft
+	schema["title"] = "Osprey configuration"
+	return json.MarshalIndent(schema, "", "  ")
+}
+
+func schemaFor(t reflect.Type) map[string]interface{} {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return schemaFor(t.Elem())
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Slice:
+		return map[string]interface{}{"type": "array", "items": schemaFor(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": schemaFor(t.Elem())}
+	case reflect.Struct:
+		properties := make(map[string]interface{})
+		var required []string
+		var discriminator string
+		var discriminatorValues []string
+		whenProperties := make(map[string][]string)
+		requiredWhen := make(map[string][]string)
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name := strings.Split(field.Tag.Get("yaml"), ",")[0]
+			if name == "" || name == "-" {
+				continue
+			}
+			property := schemaFor(field.Type)
+			var isRequired bool
+			var when string
+			for _, option := range strings.Split(field.Tag.Get("jsonschema"), ",") {
+				switch {
+				case option == "required":
+					isRequired = true
+				case option == "discriminator":
+					discriminator = name
+				case strings.HasPrefix(option, "enum="):
+					property["enum"] = strings.Split(strings.TrimPrefix(option, "enum="), "|")
+				case strings.HasPrefix(option, "when="):
+					when = strings.TrimPrefix(option, "when=")
+				}
+			}
+			switch {
+			case when != "":
+				whenProperties[when] = append(whenProperties[when], name)
+				if isRequired {
+					requiredWhen[when] = append(requiredWhen[when], name)
+				}
+			case isRequired:
+				required = append(required, name)
+			}
+			if name == discriminator {
+				discriminatorValues, _ = property["enum"].([]string)
+			}
+			properties[name] = property
+		}
+		schema := map[string]interface{}{
+			"type":                 "object",
+			"properties":           properties,
+			"additionalProperties": false,
+		}
+		if len(required) > 0 {
+			schema["required"] = required
+		}
+		if discriminator != "" {
+			schema["oneOf"] = discriminatedSchemas(discriminator, discriminatorValues, whenProperties, requiredWhen)
+		}
+		return schema
+	default:
+		return map[string]interface{}{}
+	}
+}
+
+// discriminatedSchemas returns a schema per value of the discriminator, which allows the properties of that value
+// only and requires the ones marked so.
+func discriminatedSchemas(discriminator string, values []string, whenProperties, requiredWhen map[string][]string) []interface{} {
+	var schemas []interface{}
+	for _, value := range values {
+		properties := map[string]interface{}{discriminator: map[string]interface{}{"const": value}}
+		for when, names := range whenProperties {
+			if when == value {
+				continue
+			}
+			for _, name := range names {
+				properties[name] = false
+			}
+		}
+		schemas = append(schemas, map[string]interface{}{
+			"properties": properties,
+			"required":   append([]string{discriminator}, requiredWhen[value]...),
+		})
+	}
+	return schemas
+}
@@ -0,0 +1,104 @@
+package client
+
+import (
+	"fmt"
+	"path"
+
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// TargetSelector selects targets from the configuration.
+// The targets of the Groups, the Targets patterns and All are combined, and the result is then narrowed down by the
+// LabelSelector. When none of Groups, Targets or All are set, the LabelSelector selects among all the targets if it is
+// set, and the default group is selected otherwise.
+type TargetSelector struct {
+	// Groups selects the targets belonging to any of the groups.
+	Groups []string
+	// Targets selects the targets whose name or any of its aliases match one of the glob patterns, e.g. prod-*.
+	Targets []string
+	// LabelSelector is a Kubernetes label selector the selected targets must match, e.g. env=prod,region!=us.
+	LabelSelector string
+	// All selects every target in the configuration.
+	All bool
+}
+
+// GroupNotFoundError is returned when selecting a group that is not defined in the configuration.
+type GroupNotFoundError struct {
+	Name string
+}
+
+func (e *GroupNotFoundError) Error() string {
+	return fmt.Sprintf("group not found: %q", e.Name)
+}
+
+// Select returns the targets matching the selector as a Group.
+// It fails if a group does not exist, or a target pattern or the label selector do not match any target.
+func (t *ConfigSnapshot) Select(selector TargetSelector) (Group, error) {
+	labelSelector, err := labels.Parse(selector.LabelSelector)
+	if err != nil {
+		return Group{}, fmt.Errorf("invalid label selector %q: %w", selector.LabelSelector, err)
+	}
+
+	if !selector.All && len(selector.Groups) == 0 && len(selector.Targets) == 0 {
+		if labelSelector.Empty() {
+			selector.Groups = []string{t.defaultGroupName}
+		} else {
+			selector.All = true
+		}
+	}
+
+	var candidates []Target
+	if selector.All {
+		candidates = t.Targets()
+	}
+	for _, groupName := range selector.Groups {
+		group, ok := t.GetGroup(groupName)
+		if !ok {
+			return Group{}, &GroupNotFoundError{Name: groupName}
+		}
+		candidates = append(candidates, group.Targets()...)
+	}
+	for _, pattern := range selector.Targets {
+		matches, err := t.matchTargets(pattern)
+		if err != nil {
+			return Group{}, err
+		}
+		candidates = append(candidates, matches...)
+	}
+
+	selection := Group{targetsByProvider: make(map[string][]Target)}
+	selected := make(map[string]bool)
+	for _, target := range candidates {
+		key := target.providerName + "/" + target.name
+		if selected[key] || !labelSelector.Matches(labels.Set(target.Labels())) {
+			continue
+		}
+		selected[key] = true
+		selection.targetsByProvider[target.providerName] = append(selection.targetsByProvider[target.providerName], target)
+	}
+	if len(candidates) > 0 && len(selected) == 0 && !labelSelector.Empty() {
+		return Group{}, fmt.Errorf("no targets match the label selector %q", selector.LabelSelector)
+	}
+	return selection, nil
+}
+
+func (t *ConfigSnapshot) matchTargets(pattern string) ([]Target, error) {
+	var matches []Target
+	for _, target := range t.Targets() {
+		names := append([]string{target.Name()}, target.Aliases()...)
+		for _, name := range names {
+			match, err := path.Match(pattern, name)
+			if err != nil {
+				return nil, fmt.Errorf("invalid target pattern %q: %w", pattern, err)
+			}
+			if match {
+				matches = append(matches, target)
+				break
+			}
+		}
+	}
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("no targets match %q", pattern)
+	}
+	return matches, nil
+}
@@ -0,0 +1,90 @@
+package client
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"gopkg.in/yaml.v2"
+)
+
+// stateFile is a file osprey keeps entries in between its runs, e.g. the known CAs or the cluster cache. It is only
+// readable by the user and safe for concurrent use. A nil stateFile reads as empty and writes nothing.
+type stateFile struct {
+	path string
+	// description names the file in the errors, e.g. cluster cache
+	description string
+	// marshal and unmarshal encode the entries, in YAML by default
+	marshal   func(interface{}) ([]byte, error)
+	unmarshal func([]byte, interface{}) error
+	mu        sync.Mutex
+}
+
+func newStateFile(path, description string) *stateFile {
+	return &stateFile{path: path, description: description, marshal: yaml.Marshal, unmarshal: yaml.Unmarshal}
+}
+
+// view reads the entries of the file into entries, which are left untouched if there is no file yet.
+func (f *stateFile) view(entries interface{}) error {
+	if f == nil {
+		return nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.readEntries(entries)
+}
+
+// update reads the entries of the file into entries, and writes them back if change returns true.
+func (f *stateFile) update(entries interface{}, change func() bool) error {
+	if f == nil {
+		return nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.readEntries(entries); err != nil {
+		return err
+	}
+	if !change() {
+		return nil
+	}
+	data, err := f.marshal(entries)
+	if err != nil {
+		return fmt.Errorf("failed to marshal the %s: %w", f.description, err)
+	}
+	return f.write(data)
+}
+
+func (f *stateFile) readEntries(entries interface{}) error {
+	data, err := f.read()
+	if err != nil || data == nil {
+		return err
+	}
+	if err := f.unmarshal(data, entries); err != nil {
+		return fmt.Errorf("invalid %s %s: %w", f.description, f.path, err)
+	}
+	return nil
+}
+
+// read returns the content of the file, nil if there is no file yet. The caller holds the lock.
+func (f *stateFile) read() ([]byte, error) {
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read the %s: %w", f.description, err)
+	}
+	return data, nil
+}
+
+// write replaces the content of the file, creating its directory if needed. The caller holds the lock.
+func (f *stateFile) write(data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(f.path), 0700); err != nil {
+		return fmt.Errorf("failed to create the %s directory: %w", f.description, err)
+	}
+	if err := os.WriteFile(f.path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write the %s: %w", f.description, err)
+	}
+	return nil
+}
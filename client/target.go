@@ -2,12 +2,17 @@ package client
 
 import (
 	"sort"
+
+	"github.com/sky-uk/osprey/v2/common/web"
 )
 
+const systemCASource = "system"
+
 // Target has the information of an TargetEntry target server
 type Target struct {
-	name        string
-	targetEntry *TargetEntry
+	name         string
+	targetEntry  *TargetEntry
+	providerName string
 }
 
 // Aliases returns the list of aliases of the Target alphabetically sorted
@@ -26,6 +31,21 @@ func (m *Target) Name() string {
 	return m.name
 }
 
+// Groups returns the list of groups the Target belongs to
+func (m *Target) Groups() []string {
+	return m.targetEntry.Groups
+}
+
+// Labels returns the labels of the Target
+func (m *Target) Labels() map[string]string {
+	return m.targetEntry.Labels
+}
+
+// ProviderName returns the name of the provider the Target is configured for
+func (m *Target) ProviderName() string {
+	return m.providerName
+}
+
 // Server returns the server of the Target
 func (m *Target) Server() string {
 	return m.targetEntry.Server
@@ -43,6 +63,28 @@ func (m *Target) ShouldConfigureForGKE() bool {
 	return m.targetEntry.UseGKEClientConfig
 }
 
+// GKEAuthentication returns the name of the authentication of the GKE ClientConfig used to log in, empty for the
+// first oidc one
+func (m *Target) GKEAuthentication() string {
+	return m.targetEntry.GKEAuthentication
+}
+
+// ShouldUseKubeadmClusterInfo returns true iff the API server URL and CA should be fetched from the kube-public
+// cluster-info ConfigMap published by kubeadm clusters, verified with the target's bootstrap token or CA hashes
+func (m *Target) ShouldUseKubeadmClusterInfo() bool {
+	return m.targetEntry.UseKubeadmClusterInfo
+}
+
+// BootstrapToken returns the kubeadm bootstrap token used to verify the cluster-info, if any
+func (m *Target) BootstrapToken() string {
+	return m.targetEntry.BootstrapToken
+}
+
+// CACertHashes returns the hashes of the public keys of the CA expected in the cluster-info, if any
+func (m *Target) CACertHashes() []string {
+	return m.targetEntry.CACertHashes
+}
+
 // ShouldSkipTLSVerify returns true iff the configured target should not have TLS certs verified
 func (m *Target) ShouldSkipTLSVerify() bool {
 	return m.targetEntry.SkipTLSVerify
@@ -54,11 +96,103 @@ func (m *Target) ShouldFetchCAFromAPIServer() bool {
 	return m.targetEntry.APIServer != ""
 }
 
+// discoveryEndpoint returns the server the Target's cluster details are discovered from
+func (m *Target) discoveryEndpoint() string {
+	if m.ShouldFetchCAFromAPIServer() {
+		return m.targetEntry.APIServer
+	}
+	return m.targetEntry.Server
+}
+
+// ShouldUseStaticClusterDetails returns true iff the API server URL and CA are set in the config file instead of
+// being discovered from the osprey server or the API server
+func (m *Target) ShouldUseStaticClusterDetails() bool {
+	return m.targetEntry.APIServerURL != ""
+}
+
+// APIServerURL returns the static URL of the Target's API server, if any
+func (m *Target) APIServerURL() string {
+	return m.targetEntry.APIServerURL
+}
+
+// APIServerCAData returns the base64-encoded static CA of the Target's API server, if any
+func (m *Target) APIServerCAData() string {
+	return m.targetEntry.APIServerCAData
+}
+
+// TLSServerName returns the server name used to verify the certificate of the Target's API server, if any
+func (m *Target) TLSServerName() string {
+	return m.targetEntry.TLSServerName
+}
+
+// DisableCompression returns true iff kubectl should not request compressed responses from the Target's API server
+func (m *Target) DisableCompression() bool {
+	return m.targetEntry.DisableCompression
+}
+
+// ProxyURL returns the URL of the proxy used to reach the Target, or the empty string to connect directly
+func (m *Target) ProxyURL() string {
+	return m.targetEntry.ProxyURL
+}
+
+// ClientCertificate returns the path of the client certificate presented to the Target's osprey server, if any
+func (m *Target) ClientCertificate() string {
+	return m.targetEntry.ClientCertificate
+}
+
+// ClientKey returns the path of the private key of the Target's client certificate, if any
+func (m *Target) ClientKey() string {
+	return m.targetEntry.ClientKey
+}
+
+// IssuerURL returns the issuer pinned for the id tokens of the Target's osprey server, if any
+func (m *Target) IssuerURL() string {
+	return m.targetEntry.IssuerURL
+}
+
+// ClientID returns the client id pinned for the id tokens of the Target's osprey server, if any
+func (m *Target) ClientID() string {
+	return m.targetEntry.ClientID
+}
+
+// IssuerCAData returns the base64-encoded CA pinned for the issuer of the Target's osprey server, if any
+func (m *Target) IssuerCAData() string {
+	return m.targetEntry.IssuerCAData
+}
+
+// PinnedPublicKeys returns the pins of the public keys trusted for the Target's server
+func (m *Target) PinnedPublicKeys() []string {
+	return m.targetEntry.PinnedPublicKeys
+}
+
+// IPFamily returns the IP version used to connect to the Target's servers
+func (m *Target) IPFamily() web.IPFamily {
+	family, _ := web.ParseIPFamily(m.targetEntry.IPFamily)
+	return family
+}
+
 // CertificateAuthorityData returns the CertificateAuthorityData of the Target
 func (m *Target) CertificateAuthorityData() string {
 	return m.targetEntry.CertificateAuthorityData
 }
 
+// CASource describes where the CA used to verify the Target's server certificate comes from
+func (m *Target) CASource() string {
+	if m.targetEntry.SkipTLSVerify {
+		return "none (skip-tls-verify)"
+	}
+	if m.ShouldUseStaticClusterDetails() && m.targetEntry.Server == "" {
+		return m.targetEntry.apiServerCASource
+	}
+	if m.targetEntry.UseKubeadmClusterInfo {
+		return "none (kubeadm cluster-info verified instead)"
+	}
+	if m.ShouldFetchCAFromAPIServer() || m.targetEntry.caSource == "" {
+		return systemCASource
+	}
+	return m.targetEntry.caSource
+}
+
 func sortTargets(targets []Target) []Target {
 	sort.Slice(targets, func(i, j int) bool {
 		return targets[i].name < targets[j].name
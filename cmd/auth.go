@@ -27,6 +27,8 @@ var (
 	issuerPath       string
 	issuerCA         string
 	serveClusterInfo bool
+	ipFamily         string
+	clientCA         string
 )
 
 func init() {
@@ -44,6 +46,8 @@ func init() {
 	authCmd.Flags().StringVarP(&tlsCert, "tls-cert", "C", "", "path to the x509 cert file to present when serving TLS")
 	authCmd.Flags().StringVarP(&tlsKey, "tls-key", "K", "", "path to the private key for the TLS cert")
 	authCmd.Flags().BoolVarP(&serveClusterInfo, "serve-cluster-info", "", false, "listen for requests on the /cluster-info endpoint to return the api-server URL and CA")
+	authCmd.Flags().StringVar(&clientCA, "client-ca", "", "path to the root certificate authorities of the client certificates required by /access-token. Requires tls-cert")
+	authCmd.Flags().StringVar(&ipFamily, "ip-family", string(webClient.IPFamilyAuto), "IP version used to connect to the OpenId Connect issuer: auto, ipv4 or ipv6")
 }
 
 func auth(cmd *cobra.Command, args []string) {
@@ -59,7 +63,15 @@ func auth(cmd *cobra.Command, args []string) {
 		log.Fatalf("Failed to load tls-cert: %v", err)
 	}
 
-	httpClient, err = webClient.NewTLSClient(false, issuerCAData, tlsCertData)
+	family, err := webClient.ParseIPFamily(ipFamily)
+	if err != nil {
+		log.Fatalf("Invalid ip-family: %v", err)
+	}
+
+	httpClient, err = webClient.NewClient(webClient.ClientOptions{
+		CACerts:  []string{issuerCAData, tlsCertData},
+		IPFamily: family,
+	})
 	if err != nil {
 		log.Fatal("Failed to create http client")
 	}
@@ -70,6 +82,11 @@ func auth(cmd *cobra.Command, args []string) {
 	}
 
 	s := webServer.NewServer(port, tlsCert, tlsKey, shutdownGracePeriod, serveClusterInfo, true)
+	if clientCA != "" {
+		if err := s.RequireClientCertificates(clientCA); err != nil {
+			log.Fatalf("Failed to require client certificates: %v", err)
+		}
+	}
 	s.RegisterService(service)
 	err = s.Start()
 	if err != nil {
@@ -90,4 +107,8 @@ func checkServeAuthParams(cmd *cobra.Command, args []string) {
 	checkURL(issuerURL, "issuerURL")
 	checkURL(redirectURL, "redirectURL")
 	checkCerts()
+	if clientCA != "" {
+		checkRequired(tlsCert, "tls-cert")
+		checkFile(clientCA, "client-ca")
+	}
 }
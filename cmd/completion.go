@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/sky-uk/osprey/v2/client"
+	"github.com/spf13/cobra"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var completionCmd = &cobra.Command{
+	Use:   "completion bash|zsh|fish",
+	Short: "Generate the shell completion script for osprey",
+	Long: `Generates the shell completion script for osprey, which also completes the groups, targets and aliases
+of the osprey configuration. The configuration is read locally on every completion, without any network calls.
+
+To load the completions in the current shell:
+  bash: source <(osprey completion bash)
+  zsh:  source <(osprey completion zsh)
+  fish: osprey completion fish | source
+`,
+	ValidArgs:             []string{"bash", "zsh", "fish"},
+	Args:                  cobra.ExactValidArgs(1),
+	DisableFlagsInUseLine: true,
+	Run:                   completion,
+}
+
+func init() {
+	RootCmd.AddCommand(completionCmd)
+}
+
+func completion(_ *cobra.Command, args []string) {
+	var err error
+	switch args[0] {
+	case "bash":
+		err = RootCmd.GenBashCompletionV2(os.Stdout, true)
+	case "zsh":
+		err = RootCmd.GenZshCompletion(os.Stdout)
+	case "fish":
+		err = RootCmd.GenFishCompletion(os.Stdout, true)
+	}
+	if err != nil {
+		log.Fatalf("Failed to generate the %s completion script: %v", args[0], err)
+	}
+}
+
+// registerSelectorCompletion completes the target selection flags of the command with the groups, targets and aliases
+// of the osprey configuration.
+func registerSelectorCompletion(cmd *cobra.Command) {
+	cobra.CheckErr(cmd.RegisterFlagCompletionFunc("group", completeGroups))
+	cobra.CheckErr(cmd.RegisterFlagCompletionFunc("target", completeTargets))
+}
+
+// completionSnapshot reads the osprey configuration for shell completion. It neither validates the configuration nor
+// loads the CA files, to keep completion fast. It returns nil if the configuration cannot be read.
+func completionSnapshot() *client.ConfigSnapshot {
+	configFile := ospreyconfigFile
+	if configFile == "" {
+		configFile = defaultConfigFile()
+	}
+	if configFile == "" {
+		return nil
+	}
+	config, _, err := client.ReadConfig(configFile)
+	if err != nil {
+		return nil
+	}
+	return config.Snapshot()
+}
+
+// completeGroups completes the last group of the comma-separated list of groups.
+func completeGroups(_ *cobra.Command, _ []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	snapshot := completionSnapshot()
+	if snapshot == nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	previous := ""
+	if i := strings.LastIndex(toComplete, ","); i >= 0 {
+		previous, toComplete = toComplete[:i+1], toComplete[i+1:]
+	}
+
+	selected := make(map[string]bool)
+	for _, group := range strings.Split(previous, ",") {
+		selected[group] = true
+	}
+
+	var completions []string
+	for _, group := range snapshot.Groups() {
+		if !selected[group.Name()] && strings.HasPrefix(group.Name(), toComplete) {
+			completions = append(completions, fmt.Sprintf("%s%s\ttargets: %d", previous, group.Name(), len(group.Targets())))
+		}
+	}
+	return completions, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeTargets completes the names and aliases of the targets.
+func completeTargets(_ *cobra.Command, _ []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	snapshot := completionSnapshot()
+	if snapshot == nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	var completions []string
+	for _, target := range snapshot.Targets() {
+		if strings.HasPrefix(target.Name(), toComplete) {
+			description := target.ProviderName()
+			if len(target.Groups()) > 0 {
+				description = fmt.Sprintf("%s, groups: %s", description, strings.Join(target.Groups(), ","))
+			}
+			completions = append(completions, fmt.Sprintf("%s\t%s", target.Name(), description))
+		}
+		for _, alias := range target.Aliases() {
+			if strings.HasPrefix(alias, toComplete) {
+				completions = append(completions, fmt.Sprintf("%s\talias of %s", alias, target.Name()))
+			}
+		}
+	}
+	return completions, cobra.ShellCompDirectiveNoFileComp
+}
@@ -14,5 +14,8 @@ func init() {
 	RootCmd.AddCommand(configCmd)
 	persistentFlags := configCmd.PersistentFlags()
 	persistentFlags.StringVarP(&ospreyconfigFile, "ospreyconfig", "o", "", "osprey targets configuration. Defaults to $HOME/.osprey/config or $HOME/.config/osprey/config.")
-	persistentFlags.StringVarP(&targetGroup, "group", "g", "", "show only the specified group")
+	persistentFlags.StringVarP(&targetGroup, "group", "g", "", "show only the specified group. Accepts a comma-separated list of groups.")
+	persistentFlags.StringArrayVar(&targetPatterns, "target", nil, "show only the targets matching the name, alias or glob pattern. May be repeated.")
+	persistentFlags.StringVarP(&labelSelector, "selector", "l", "", "label selector to filter the targets on, e.g. env=prod,region!=us")
+	registerSelectorCompletion(configCmd)
 }
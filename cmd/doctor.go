@@ -0,0 +1,179 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/sky-uk/osprey/v2/client"
+	"github.com/sky-uk/osprey/v2/client/kubeconfig"
+	"github.com/spf13/cobra"
+
+	log "github.com/sirupsen/logrus"
+	clientgo "k8s.io/client-go/tools/clientcmd/api"
+)
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Diagnose problems logging in to the targets",
+	Long: `Doctor checks, for each of the selected targets, the DNS resolution of its server, the TCP connection to it,
+the TLS chain against the configured CA and the health of the osprey server, or the access to the kube-public
+resources of the API server. It also checks the discovery document of the issuers, the local clock against the
+servers' Date header and that the kubeconfig file is writable.
+
+It finishes with hints to fix the checks that failed, and exits with an error if any did.
+The checks only read from the servers, no login is attempted.`,
+	PersistentPreRun: checkClientParams,
+	Run:              doctor,
+}
+
+func init() {
+	RootCmd.AddCommand(doctorCmd)
+	flags := doctorCmd.Flags()
+	flags.StringVarP(&ospreyconfigFile, "ospreyconfig", "o", "", "osprey targets configuration. Defaults to $HOME/.osprey/config or $HOME/.config/osprey/config.")
+	flags.StringVarP(&targetGroup, "group", "g", "", "name of the group to diagnose. Accepts a comma-separated list of groups.")
+	flags.StringArrayVar(&targetPatterns, "target", nil, "name, alias or glob pattern of the targets to diagnose. May be repeated.")
+	flags.StringVarP(&labelSelector, "selector", "l", "", "label selector to filter the targets on, e.g. env=prod,region!=us")
+	flags.BoolVar(&allTargets, "all", false, "diagnose all the targets in the configuration")
+	registerSelectorCompletion(doctorCmd)
+}
+
+// checkResult is the result of a single diagnostic check
+type checkResult struct {
+	Check  string `json:"check" yaml:"check"`
+	Status string `json:"status" yaml:"status"`
+	Detail string `json:"detail,omitempty" yaml:"detail,omitempty"`
+	Hint   string `json:"hint,omitempty" yaml:"hint,omitempty"`
+}
+
+// diagnosisResult groups the checks of the kubeconfig, a provider or a target
+type diagnosisResult struct {
+	Name   string        `json:"name" yaml:"name"`
+	Checks []checkResult `json:"checks" yaml:"checks"`
+}
+
+// doctorResult is the result of the doctor command
+type doctorResult struct {
+	Kubeconfig diagnosisResult   `json:"kubeconfig" yaml:"kubeconfig"`
+	Providers  []diagnosisResult `json:"providers,omitempty" yaml:"providers,omitempty"`
+	Targets    []diagnosisResult `json:"targets,omitempty" yaml:"targets,omitempty"`
+	Hints      []string          `json:"hints,omitempty" yaml:"hints,omitempty"`
+	Success    bool              `json:"success" yaml:"success"`
+}
+
+func doctor(_ *cobra.Command, _ []string) {
+	ospreyconfig, err := client.LoadConfig(ospreyconfigFile)
+	if err != nil {
+		log.Fatalf("Failed to load ospreyconfig file %s: %v", ospreyconfigFile, err)
+	}
+
+	snapshot := ospreyconfig.Snapshot()
+	group := selectTargets(snapshot)
+	displaySelection(ospreyconfig.DefaultGroup)
+
+	result := doctorResult{Kubeconfig: diagnoseKubeconfig(ospreyconfig.Kubeconfig)}
+	var config *clientgo.Config
+	if err := kubeconfig.LoadConfig(ospreyconfig.Kubeconfig); err == nil {
+		config, _ = kubeconfig.GetConfig()
+	}
+
+	var providerNames []string
+	for providerName := range group.TargetsForProvider() {
+		providerNames = append(providerNames, providerName)
+	}
+	sort.Strings(providerNames)
+	for _, providerName := range providerNames {
+		if checks := snapshot.DiagnoseProvider(providerName); len(checks) > 0 {
+			result.Providers = append(result.Providers, newDiagnosisResult(providerName, checks))
+		}
+	}
+
+	targets := group.Targets()
+	result.Targets = make([]diagnosisResult, len(targets))
+	var wg sync.WaitGroup
+	for i, target := range targets {
+		wg.Add(1)
+		go func(i int, target client.Target) {
+			defer wg.Done()
+			result.Targets[i] = newDiagnosisResult(target.Name(), snapshot.DiagnoseTarget(target, config))
+		}(i, target)
+	}
+	wg.Wait()
+
+	result.Success = true
+	for _, diagnosis := range append(append([]diagnosisResult{result.Kubeconfig}, result.Providers...), result.Targets...) {
+		for _, check := range diagnosis.Checks {
+			if check.Status == string(client.DiagnosticFailed) {
+				result.Success = false
+			}
+			if check.Hint != "" {
+				result.Hints = append(result.Hints, fmt.Sprintf("%s %s: %s", diagnosis.Name, check.Check, check.Hint))
+			}
+		}
+	}
+
+	if structuredOutput() {
+		printResult(result)
+	} else {
+		displayDiagnosis(result)
+	}
+	if !result.Success {
+		os.Exit(1)
+	}
+}
+
+func diagnoseKubeconfig(kubeconfigFile string) diagnosisResult {
+	check := checkResult{Check: "writable", Status: string(client.DiagnosticOK)}
+	filename, err := kubeconfig.CheckWritable(kubeconfigFile)
+	if err != nil {
+		check.Status = string(client.DiagnosticFailed)
+		check.Detail = err.Error()
+		check.Hint = "fix the permissions of the kubeconfig file, or set another path with kubeconfig in the osprey config"
+	} else {
+		check.Detail = fmt.Sprintf("%s is writable", filename)
+	}
+	return diagnosisResult{Name: "kubeconfig", Checks: []checkResult{check}}
+}
+
+func newDiagnosisResult(name string, diagnostics []client.Diagnostic) diagnosisResult {
+	result := diagnosisResult{Name: name}
+	for _, diagnostic := range diagnostics {
+		result.Checks = append(result.Checks, checkResult{
+			Check:  diagnostic.Check,
+			Status: string(diagnostic.Status),
+			Detail: diagnostic.Detail,
+			Hint:   diagnostic.Hint,
+		})
+	}
+	return result
+}
+
+func displayDiagnosis(result doctorResult) {
+	var outputLines []string
+	outputLines = append(outputLines, displayChecks(result.Kubeconfig)...)
+	for _, provider := range result.Providers {
+		provider.Name = "provider " + provider.Name
+		outputLines = append(outputLines, displayChecks(provider)...)
+	}
+	for _, target := range result.Targets {
+		target.Name = "target " + target.Name
+		outputLines = append(outputLines, displayChecks(target)...)
+	}
+	if len(result.Hints) > 0 {
+		outputLines = append(outputLines, "Hints:")
+		for _, hint := range result.Hints {
+			outputLines = append(outputLines, fmt.Sprintf("  - %s", hint))
+		}
+	}
+	fmt.Println(strings.Join(outputLines, "\n"))
+}
+
+func displayChecks(diagnosis diagnosisResult) []string {
+	outputLines := []string{diagnosis.Name + ":"}
+	for _, check := range diagnosis.Checks {
+		outputLines = append(outputLines, fmt.Sprintf("  %-9s %-20s %s", "["+check.Status+"]", check.Check, check.Detail))
+	}
+	return outputLines
+}
@@ -0,0 +1,157 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sky-uk/osprey/v2/client"
+	"github.com/spf13/cobra"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var knownCAsCmd = &cobra.Command{
+	Use:   "known-cas",
+	Short: "List the API server CAs trusted on first use",
+	Long: `Lists the CAs of the API servers that osprey fetched from kube-public, with their SHA256 fingerprints.
+A CA is trusted the first time it is fetched for a target, and later logins are refused if it changes,
+unless the new one is accepted on the terminal or with 'osprey user login --accept-new-ca'.`,
+	Run: listKnownCAs,
+}
+
+var forgetKnownCAsCmd = &cobra.Command{
+	Use:   "forget [target...]",
+	Short: "Forget the trusted API server CAs of the targets",
+	Long: `Forgets the trusted CAs of the targets, so the next CA fetched for them is trusted on first use.
+A target is either a target name, whose CAs are forgotten for all the providers and profiles, or the
+<provider>[@<profile>]/<target> key of a single CA, as listed by 'osprey config known-cas'.`,
+	Run:               forgetKnownCAs,
+	ValidArgsFunction: completeKnownCAs,
+}
+
+var forgetAllKnownCAs bool
+
+// knownCAResult describes a CA trusted on first use
+type knownCAResult struct {
+	Key         string `json:"key" yaml:"key"`
+	Target      string `json:"target" yaml:"target"`
+	APIServer   string `json:"apiServer" yaml:"apiServer"`
+	Fingerprint string `json:"fingerprint" yaml:"fingerprint"`
+}
+
+func init() {
+	configCmd.AddCommand(knownCAsCmd)
+	knownCAsCmd.AddCommand(forgetKnownCAsCmd)
+	forgetKnownCAsCmd.Flags().BoolVar(&forgetAllKnownCAs, "all", false, "forget the CAs of all the targets")
+}
+
+func loadKnownCAs() *client.KnownCAs {
+	ospreyconfig, err := client.LoadConfig(ospreyconfigFile)
+	if err != nil {
+		log.Fatalf("Failed to load ospreyconfig file %s: %v", ospreyconfigFile, err)
+	}
+	return client.NewKnownCAs(ospreyconfig.KnownCAs)
+}
+
+func listKnownCAs(_ *cobra.Command, _ []string) {
+	knownCAs := loadKnownCAs()
+	list, err := knownCAs.List()
+	if err != nil {
+		log.Fatalf("Failed to list the known CAs: %v", err)
+	}
+
+	results := []knownCAResult{}
+	for _, knownCA := range list {
+		results = append(results, knownCAResult{Key: knownCA.Key, Target: knownCA.Target, APIServer: knownCA.APIServer,
+			Fingerprint: knownCA.Fingerprint})
+	}
+	if structuredOutput() {
+		printResult(results)
+		return
+	}
+
+	outputLines := []string{fmt.Sprintf("Known CAs (%s):", knownCAs.Path())}
+	for _, result := range results {
+		outputLines = append(outputLines, fmt.Sprintf("  %s %s %s", result.Key, result.APIServer, result.Fingerprint))
+	}
+	fmt.Println(strings.Join(outputLines, "\n"))
+}
+
+func forgetKnownCAs(_ *cobra.Command, args []string) {
+	if len(args) == 0 && !forgetAllKnownCAs {
+		log.Fatal("Specify the targets to forget, or --all")
+	}
+	knownCAs := loadKnownCAs()
+	targets := args
+	if forgetAllKnownCAs {
+		list, err := knownCAs.List()
+		if err != nil {
+			log.Fatalf("Failed to list the known CAs: %v", err)
+		}
+		for _, knownCA := range list {
+			targets = append(targets, knownCA.Key)
+		}
+	}
+
+	forgotten, err := knownCAs.Forget(targets...)
+	if err != nil {
+		log.Fatalf("Failed to forget the known CAs: %v", err)
+	}
+	for _, target := range forgotten {
+		log.Infof("Forgot the CA of %s", target)
+	}
+	if unknown := unknownTargets(args, forgotten); len(unknown) > 0 {
+		log.Errorf("No known CA for %s", strings.Join(unknown, ", "))
+		os.Exit(1)
+	}
+}
+
+// completeKnownCAs completes the targets of the known CAs that are not already in the arguments.
+func completeKnownCAs(_ *cobra.Command, args []string, _ string) ([]string, cobra.ShellCompDirective) {
+	configFile := ospreyconfigFile
+	if configFile == "" {
+		configFile = defaultConfigFile()
+	}
+	if configFile == "" {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	config, _, err := client.ReadConfig(configFile)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	knownCAsFile := config.KnownCAs
+	if knownCAsFile == "" {
+		knownCAsFile = filepath.Join(filepath.Dir(configFile), "known_cas")
+	}
+	list, err := client.NewKnownCAs(knownCAsFile).List()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	forgotten := map[string]bool{}
+	for _, arg := range args {
+		forgotten[arg] = true
+	}
+	var completions []string
+	for _, knownCA := range list {
+		if !forgotten[knownCA.Key] {
+			completions = append(completions, fmt.Sprintf("%s\t%s", knownCA.Key, knownCA.APIServer))
+		}
+	}
+	return completions, cobra.ShellCompDirectiveNoFileComp
+}
+
+func unknownTargets(targets, forgotten []string) []string {
+	known := map[string]bool{}
+	for _, target := range forgotten {
+		known[target] = true
+	}
+	var unknown []string
+	for _, target := range targets {
+		if !known[target] {
+			unknown = append(unknown, target)
+		}
+	}
+	return unknown
+}
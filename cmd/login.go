@@ -1,20 +1,25 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
-	"os"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/sky-uk/osprey/v2/client"
 	"github.com/sky-uk/osprey/v2/client/kubeconfig"
+	"github.com/sky-uk/osprey/v2/client/oidc"
 	"github.com/spf13/cobra"
 	"golang.org/x/sync/errgroup"
 
 	log "github.com/sirupsen/logrus"
 )
 
+// clusterRefreshTimeout is how long the login waits for the background refreshes of the cluster details it used from
+// the cache
+const clusterRefreshTimeout = 10 * time.Second
+
 var loginCmd = &cobra.Command{
 	Use:   "login",
 	Short: "Login to one or more Kubernetes clusters",
@@ -32,16 +37,25 @@ The connection to the osprey servers is via HTTPS.
 
 var (
 	useDeviceCode       bool
+	manual              bool
 	loginTimeout        time.Duration
 	disableBrowserPopup bool
 	username            string
 	password            string
+	acceptNewCA         bool
+	force               bool
+	loginHint           string
+	domainHint          string
+	prompt              string
 )
 
 func init() {
 	userCmd.AddCommand(loginCmd)
 	loginCmd.Flags().BoolVarP(&useDeviceCode, "use-device-code", "", false,
 		"set to true to use a device-code flow for authorisation")
+	loginCmd.Flags().BoolVar(&manual, "manual", false,
+		"print the authorisation URL and read the URL the browser is redirected to from stdin")
+	loginCmd.MarkFlagsMutuallyExclusive("use-device-code", "manual")
 	loginCmd.Flags().DurationVar(&loginTimeout, "login-timeout", 90*time.Second,
 		"set to override the login timeout when using local callback or device-code flow for authorisation")
 	loginCmd.Flags().BoolVarP(&disableBrowserPopup, "disable-browser-popup", "", false,
@@ -50,6 +64,16 @@ func init() {
 		"username for authenticating with the osprey server")
 	loginCmd.Flags().StringVarP(&password, "password", "p", "",
 		"password for authenticating with the osprey server")
+	loginCmd.Flags().StringVar(&loginHint, "login-hint", "",
+		"account to log in with to the azure providers, instead of their login-hint or the account last logged in with")
+	loginCmd.Flags().StringVar(&domainHint, "domain-hint", "",
+		"domain of the account to log in with to the azure providers, e.g. contoso.com")
+	loginCmd.Flags().StringVar(&prompt, "prompt", "",
+		"prompt of the azure browser logins: select_account, login or consent")
+	loginCmd.Flags().BoolVar(&acceptNewCA, "accept-new-ca", false,
+		"accept the API server CAs fetched from kube-public that changed since they were first trusted")
+	loginCmd.Flags().BoolVar(&force, "force", false,
+		"overwrite the kubeconfig entries of the same names that were not written for the targets by this osprey config")
 }
 
 func login(_ *cobra.Command, _ []string) {
@@ -63,21 +87,34 @@ func login(_ *cobra.Command, _ []string) {
 		log.Fatalf("Failed to initialise kubeconfig: %v", err)
 	}
 
-	groupName := ospreyconfig.GroupOrDefault(targetGroup)
 	snapshot := ospreyconfig.Snapshot()
-	group, ok := snapshot.GetGroup(groupName)
-	if !ok {
-		log.Errorf("Group not found: %q", groupName)
-		os.Exit(1)
+	group := selectTargets(snapshot)
+	checkProfile(snapshot, group)
+	displaySelection(ospreyconfig.DefaultGroup)
+	var clusterCache *client.ClusterCache
+	if clusterCacheTTL, _ := ospreyconfig.ClusterCacheDuration(); clusterCacheTTL > 0 {
+		clusterCache = client.NewClusterCache(ospreyconfig.ClusterCache, clusterCacheTTL)
 	}
-
-	displayActiveGroup(targetGroup, ospreyconfig.DefaultGroup)
+	// the browser logins of all the providers share the redirect ports and the browser tab
+	callbackServer := oidc.NewCallbackServer()
+	defer callbackServer.Close()
 	retrieverOptions := client.RetrieverOptions{
 		UseDeviceCode:       useDeviceCode,
+		Manual:              manual,
+		LoginHint:           loginHint,
+		DomainHint:          domainHint,
+		Prompt:              prompt,
+		Profile:             profile,
+		Accounts:            client.NewAccounts(ospreyconfig.Accounts),
 		LoginTimeout:        loginTimeout,
 		DisableBrowserPopup: disableBrowserPopup,
 		Username:            username,
 		Password:            password,
+		KnownCAs:            client.NewKnownCAs(ospreyconfig.KnownCAs),
+		AcceptNewCA:         acceptNewCA,
+		ClusterCache:        clusterCache,
+		GroupsCache:         client.NewGroupsCache(ospreyconfig.GroupsCache),
+		CallbackServer:      callbackServer,
 	}
 
 	retrievers, err := ospreyconfig.GetRetrievers(snapshot.ProviderConfigs(), retrieverOptions)
@@ -87,6 +124,7 @@ func login(_ *cobra.Command, _ []string) {
 
 	var g errgroup.Group
 	var muKubeconfig sync.Mutex
+	var results []loginResult
 
 	for providerName, targets := range group.TargetsForProvider() {
 		retriever, ok := retrievers[providerName]
@@ -98,37 +136,88 @@ func login(_ *cobra.Command, _ []string) {
 			target := target
 
 			g.Go(func() error {
-				targetData, err := retriever.RetrieveClusterDetailsAndAuthTokens(target)
+				result := loginResult{Target: target.Name(), Aliases: target.Aliases(), Provider: target.ProviderName(), Profile: profile}
+				defer func() {
+					muKubeconfig.Lock()
+					results = append(results, result)
+					muKubeconfig.Unlock()
+				}()
+
+				// the names are checked before logging in, so that the user does not log in to be refused
+				muKubeconfig.Lock()
+				names, err := kubeconfigNames(snapshot, target)
+				muKubeconfig.Unlock()
 				if err != nil {
 					log.Errorf("Failed to log in to %s: %v", target.Name(), err)
+					result.Error = err.Error()
+					return err
+				}
 
+				targetData, err := retriever.RetrieveClusterDetailsAndAuthTokens(target)
+				if err != nil {
+					log.Errorf("Failed to log in to %s: %v", target.Name(), err)
+					result.Error = err.Error()
 					return err
 				}
+				result.Username = targetData.Username
+				result.APIServerURL = targetData.ClusterAPIServerURL
+				result.ElevatedContext = names.ElevatedContext
 
 				muKubeconfig.Lock()
-				updateKubeconfig(target, targetData)
+				err = updateKubeconfig(names, targetData)
 				muKubeconfig.Unlock()
 
-				return nil
+				result.Success = err == nil
+				result.Error = errorString(err)
+				return err
 			})
 		}
 	}
 
-	if err := g.Wait(); err != nil {
+	err = g.Wait()
+	if !clusterCache.WaitForRefreshes(clusterRefreshTimeout) {
+		log.Warnf("Gave up refreshing the cached cluster details after %v", clusterRefreshTimeout)
+	}
+	if structuredOutput() {
+		printResult(sortLoginResults(results))
+	}
+	if err != nil {
 		log.Fatal("Failed to update credentials for some targets.")
 	}
 }
 
+// kubeconfigNames returns the names of the kubeconfig entries of the target, unless they collide with entries that
+// were not written for the target by this osprey config
+func kubeconfigNames(snapshot *client.ConfigSnapshot, target client.Target) (client.KubeconfigNames, error) {
+	names, err := snapshot.KubeconfigNames(target, profile)
+	if err == nil && !force {
+		err = collisionHint(kubeconfig.CheckCollisions(names))
+	}
+	return names, err
+}
+
+func collisionHint(err error) error {
+	var collision *kubeconfig.CollisionError
+	if errors.As(err, &collision) {
+		return fmt.Errorf("%w, change the name templates of the osprey config or log in with --force to overwrite it", err)
+	}
+	return err
+}
+
 // updateKubeconfig modifies the loaded kubeconfig file with the client ID and access token required for access
-func updateKubeconfig(target client.Target, tokenData *client.TargetInfo) {
-	err := kubeconfig.UpdateConfig(target.Name(), target.Aliases(), tokenData)
+func updateKubeconfig(names client.KubeconfigNames, tokenData *client.TargetInfo) error {
+	err := collisionHint(kubeconfig.UpdateConfig(names, tokenData, force))
 	if err != nil {
-		log.Errorf("Failed to update config for %s: %v", target.Name(), err)
-		return
+		log.Errorf("Failed to update config for %s: %v", names.Contexts[0], err)
+		return err
 	}
 	aliases := ""
-	if target.HasAliases() {
-		aliases = fmt.Sprintf(" | %s", strings.Join(target.Aliases(), " | "))
+	if len(names.Contexts) > 1 {
+		aliases = fmt.Sprintf(" | %s", strings.Join(names.Contexts[1:], " | "))
+	}
+	log.Infof("Logged in to: %s %s", names.Contexts[0], aliases)
+	if names.ElevatedContext != "" {
+		log.Infof("Elevated context: %s", names.ElevatedContext)
 	}
-	log.Infof("Logged in to: %s %s", target.Name(), aliases)
+	return nil
 }
@@ -5,8 +5,6 @@ import (
 	"github.com/sky-uk/osprey/v2/client/kubeconfig"
 	"github.com/spf13/cobra"
 
-	"os"
-
 	log "github.com/sirupsen/logrus"
 )
 
@@ -32,27 +30,33 @@ func logout(_ *cobra.Command, _ []string) {
 		log.Fatalf("Failed to initialise kubeconfig: %v", err)
 	}
 
-	groupName := ospreyconfig.GroupOrDefault(targetGroup)
 	snapshot := ospreyconfig.Snapshot()
-	group, ok := snapshot.GetGroup(groupName)
-	if !ok {
-		log.Errorf("Group not found: %q", groupName)
-		os.Exit(1)
-	}
-
-	displayActiveGroup(targetGroup, ospreyconfig.DefaultGroup)
+	group := selectTargets(snapshot)
+	checkProfile(snapshot, group)
+	displaySelection(ospreyconfig.DefaultGroup)
 
 	success := true
+	var results []logoutResult
 	for _, target := range group.Targets() {
-		err = kubeconfig.Remove(target.Name())
+		name := target.Name()
+		var names client.KubeconfigNames
+		names, err = snapshot.KubeconfigNames(target, profile)
+		if err == nil {
+			name = names.Contexts[0]
+			err = kubeconfig.Remove(names.Users()...)
+		}
 		if err != nil {
-			log.Errorf("Failed to remove %s from kubeconfig: %v", target.Name(), err)
+			log.Errorf("Failed to remove %s from kubeconfig: %v", name, err)
 			success = false
 		} else {
-			log.Infof("Logged out from %s", target.Name())
+			log.Infof("Logged out from %s", name)
 		}
+		results = append(results, logoutResult{Target: target.Name(), Profile: profile, Success: err == nil, Error: errorString(err)})
 	}
 
+	if structuredOutput() {
+		printResult(results)
+	}
 	if !success {
 		log.Fatal("Failed to update credentials for some targets.")
 	}
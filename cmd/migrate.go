@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/sky-uk/osprey/v2/client"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var migrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Rewrites a v1 or v2 osprey configuration in the v3 format.",
+	Long: `Migrate converts the osprey configuration to the v3 format, keeping the providers, targets, aliases, groups
+and CA settings. The original file is kept with a .bak suffix.
+
+Comments in the original file are not preserved.`,
+	Run: migrate,
+}
+
+var dryRun bool
+
+func init() {
+	configCmd.AddCommand(migrateCmd)
+	migrateCmd.Flags().BoolVarP(&dryRun, "dry-run", "", false, "print the migrated configuration instead of writing it")
+}
+
+func migrate(_ *cobra.Command, _ []string) {
+	ospreyconfig, version, err := client.ReadConfig(ospreyconfigFile)
+	if err != nil {
+		log.Fatalf("Failed to load ospreyconfig file %s: %v", ospreyconfigFile, err)
+	}
+
+	if version == client.ConfigVersionV3 && !dryRun {
+		log.Infof("%s is already in the %s format", ospreyconfigFile, client.ConfigVersionV3)
+		return
+	}
+
+	out, err := yaml.Marshal(ospreyconfig)
+	if err != nil {
+		log.Fatalf("Failed to marshal migrated config: %v", err)
+	}
+
+	if dryRun {
+		fmt.Print(string(out))
+		return
+	}
+
+	info, err := os.Stat(ospreyconfigFile)
+	if err != nil {
+		log.Fatalf("Failed to read ospreyconfig file %s: %v", ospreyconfigFile, err)
+	}
+	original, err := os.ReadFile(ospreyconfigFile)
+	if err != nil {
+		log.Fatalf("Failed to read ospreyconfig file %s: %v", ospreyconfigFile, err)
+	}
+	backupFile := ospreyconfigFile + ".bak"
+	if err = os.WriteFile(backupFile, original, info.Mode()); err != nil {
+		log.Fatalf("Failed to back up ospreyconfig file to %s: %v", backupFile, err)
+	}
+	if err = os.WriteFile(ospreyconfigFile, out, info.Mode()); err != nil {
+		log.Fatalf("Failed to write migrated config to %s: %v", ospreyconfigFile, err)
+	}
+	log.Infof("Migrated %s from %s to %s, the original is kept at %s", ospreyconfigFile, version, client.ConfigVersionV3, backupFile)
+}
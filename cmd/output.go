@@ -0,0 +1,144 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/sky-uk/osprey/v2/client"
+	"gopkg.in/yaml.v2"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+	outputYAML  = "yaml"
+)
+
+var outputFormat string
+
+// targetResult describes a configured target
+type targetResult struct {
+	Name         string            `json:"name" yaml:"name"`
+	Aliases      []string          `json:"aliases,omitempty" yaml:"aliases,omitempty"`
+	Groups       []string          `json:"groups,omitempty" yaml:"groups,omitempty"`
+	Labels       map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"`
+	Provider     string            `json:"provider" yaml:"provider"`
+	ProviderType string            `json:"providerType" yaml:"providerType"`
+	Server       string            `json:"server,omitempty" yaml:"server,omitempty"`
+	APIServer    string            `json:"apiServer,omitempty" yaml:"apiServer,omitempty"`
+	CASource     string            `json:"caSource" yaml:"caSource"`
+	Default      bool              `json:"default" yaml:"default"`
+}
+
+// groupResult describes a configured group and, optionally, its targets
+type groupResult struct {
+	Name    string         `json:"name" yaml:"name"`
+	Default bool           `json:"default" yaml:"default"`
+	Targets []targetResult `json:"targets,omitempty" yaml:"targets,omitempty"`
+}
+
+// targetsResult is the result of the targets command
+type targetsResult struct {
+	Groups  []groupResult  `json:"groups,omitempty" yaml:"groups,omitempty"`
+	Targets []targetResult `json:"targets,omitempty" yaml:"targets,omitempty"`
+}
+
+// loginResult is the result of logging in to a single target
+type loginResult struct {
+	Target          string   `json:"target" yaml:"target"`
+	Aliases         []string `json:"aliases,omitempty" yaml:"aliases,omitempty"`
+	Provider        string   `json:"provider" yaml:"provider"`
+	Profile         string   `json:"profile,omitempty" yaml:"profile,omitempty"`
+	Username        string   `json:"username,omitempty" yaml:"username,omitempty"`
+	APIServerURL    string   `json:"apiServerURL,omitempty" yaml:"apiServerURL,omitempty"`
+	ElevatedContext string   `json:"elevatedContext,omitempty" yaml:"elevatedContext,omitempty"`
+	Success         bool     `json:"success" yaml:"success"`
+	Error           string   `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// logoutResult is the result of logging out from a single target
+type logoutResult struct {
+	Target  string `json:"target" yaml:"target"`
+	Profile string `json:"profile,omitempty" yaml:"profile,omitempty"`
+	Success bool   `json:"success" yaml:"success"`
+	Error   string `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// userResult describes the user logged in to a single target
+type userResult struct {
+	Target   string   `json:"target" yaml:"target"`
+	Provider string   `json:"provider" yaml:"provider"`
+	Profile  string   `json:"profile,omitempty" yaml:"profile,omitempty"`
+	LoggedIn bool     `json:"loggedIn" yaml:"loggedIn"`
+	Username string   `json:"username,omitempty" yaml:"username,omitempty"`
+	Roles    []string `json:"roles,omitempty" yaml:"roles,omitempty"`
+	Error    string   `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+func checkOutputFormat() {
+	switch outputFormat {
+	case outputTable, outputJSON, outputYAML:
+	default:
+		log.Fatalf("Unsupported output format %q, must be one of %s, %s or %s", outputFormat, outputTable, outputJSON, outputYAML)
+	}
+}
+
+// structuredOutput returns true if the results should be printed as json or yaml instead of the
+// human-readable output.
+func structuredOutput() bool {
+	return outputFormat != outputTable
+}
+
+// printResult prints the result to stdout in the selected structured format.
+func printResult(result interface{}) {
+	var out []byte
+	var err error
+	switch outputFormat {
+	case outputJSON:
+		out, err = json.MarshalIndent(result, "", "  ")
+		out = append(out, '\n')
+	case outputYAML:
+		out, err = yaml.Marshal(result)
+	default:
+		return
+	}
+	if err != nil {
+		log.Fatalf("Failed to marshal %s output: %v", outputFormat, err)
+	}
+	fmt.Fprint(os.Stdout, string(out))
+}
+
+func newTargetResult(snapshot *client.ConfigSnapshot, target client.Target) targetResult {
+	providerType, _ := snapshot.GetProviderType(target.ProviderName())
+	defaultGroup := snapshot.DefaultGroup()
+	return targetResult{
+		Name:         target.Name(),
+		Aliases:      target.Aliases(),
+		Groups:       target.Groups(),
+		Labels:       target.Labels(),
+		Provider:     target.ProviderName(),
+		ProviderType: providerType,
+		Server:       target.Server(),
+		APIServer:    target.APIServer(),
+		CASource:     target.CASource(),
+		Default:      defaultGroup.Contains(target),
+	}
+}
+
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+func sortLoginResults(results []loginResult) []loginResult {
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Target < results[j].Target
+	})
+	return results
+}
@@ -7,6 +7,7 @@ import (
 	"net/url"
 
 	log "github.com/sirupsen/logrus"
+	"github.com/sky-uk/osprey/v2/common"
 	"github.com/spf13/cobra"
 )
 
@@ -37,12 +38,20 @@ func init() {
 	cobra.OnInitialize(initLogs)
 	RootCmd.Version = fmt.Sprintf("%s (%s)", version, buildTime)
 	RootCmd.PersistentFlags().BoolVarP(&debugLogging, "debug", "X", false, "enable debug logging")
+	// no -o shorthand, as it has always been the one of --ospreyconfig and renaming it would break the scripts using it
+	RootCmd.PersistentFlags().StringVar(&outputFormat, "output", outputTable,
+		"output format of the client commands: table, json or yaml. It has no -o shorthand, which is --ospreyconfig's")
 }
 
 func initLogs() {
 	if debugLogging {
 		log.SetLevel(log.DebugLevel)
 	}
+	checkOutputFormat()
+	if structuredOutput() {
+		// keep stdout for the results
+		common.PromptOutput = os.Stderr
+	}
 }
 
 func checkFile(value, flagName string) {
@@ -0,0 +1,32 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/sky-uk/osprey/v2/client"
+	"github.com/spf13/cobra"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var schemaCmd = &cobra.Command{
+	Use:   "schema",
+	Short: "Prints the JSON Schema of the osprey configuration.",
+	Long: `Schema prints the JSON Schema of the v3 osprey configuration, which editors can use to validate and
+complete the configuration file.`,
+	// the schema does not depend on any existing configuration
+	PersistentPreRun: func(_ *cobra.Command, _ []string) {},
+	Run:              schema,
+}
+
+func init() {
+	configCmd.AddCommand(schemaCmd)
+}
+
+func schema(_ *cobra.Command, _ []string) {
+	out, err := client.ConfigSchema()
+	if err != nil {
+		log.Fatalf("Failed to generate the config schema: %v", err)
+	}
+	fmt.Println(string(out))
+}
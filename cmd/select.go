@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+	"strings"
+
+	"github.com/sky-uk/osprey/v2/client"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	targetPatterns []string
+	labelSelector  string
+	allTargets     bool
+)
+
+// targetSelector builds the selector from the --group, --target, --selector and --all flags.
+func targetSelector() client.TargetSelector {
+	var groups []string
+	if targetGroup != "" {
+		groups = strings.Split(targetGroup, ",")
+	}
+	return client.TargetSelector{
+		Groups:        groups,
+		Targets:       targetPatterns,
+		LabelSelector: labelSelector,
+		All:           allTargets,
+	}
+}
+
+// selectTargets returns the targets selected with the command flags, all the targets matching the label selector if
+// only --selector is set, or the default group if none are set.
+func selectTargets(snapshot *client.ConfigSnapshot) client.Group {
+	group, err := snapshot.Select(targetSelector())
+	if err != nil {
+		var groupNotFound *client.GroupNotFoundError
+		if errors.As(err, &groupNotFound) {
+			log.Errorf("Group not found: %q", groupNotFound.Name)
+		} else {
+			log.Errorf("Invalid target selection: %v", err)
+		}
+		os.Exit(1)
+	}
+	return group
+}
+
+func displaySelection(defaultGroup string) {
+	switch {
+	case allTargets, labelSelector != "" && targetGroup == "" && len(targetPatterns) == 0:
+		log.Info("Active selection: all targets")
+	case len(targetPatterns) > 0:
+		selection := append(append([]string{}, targetPatterns...), targetSelector().Groups...)
+		log.Infof("Active selection: %s", strings.Join(selection, ", "))
+	default:
+		displayActiveGroup(targetGroup, defaultGroup)
+	}
+	if labelSelector != "" {
+		log.Infof("Label selector: %s", labelSelector)
+	}
+}
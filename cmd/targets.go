@@ -28,7 +28,7 @@ func init() {
 	configCmd.AddCommand(targetsCommand)
 	flags := targetsCommand.Flags()
 	flags.BoolVarP(&byGroups, "by-groups", "b", false, "list targets by group")
-	flags.BoolVarP(&listGroups, "list-groups", "l", false, "list groups only")
+	flags.BoolVar(&listGroups, "list-groups", false, "list groups only")
 }
 
 func targets(_ *cobra.Command, _ []string) {
@@ -38,48 +38,114 @@ func targets(_ *cobra.Command, _ []string) {
 	}
 
 	snapshot := ospreyconfig.Snapshot()
+	filter := targetFilter(snapshot)
+
+	if structuredOutput() {
+		printResult(buildTargetsResult(snapshot, filter))
+		return
+	}
 
 	var outputLines []string
 	if listGroups {
 		outputLines = append(outputLines, "Configured groups:")
-		outputLines = append(outputLines, displayGroups(snapshot, false)...)
+		outputLines = append(outputLines, displayGroups(snapshot, false, filter)...)
 	} else {
 		outputLines = append(outputLines, "Configured targets:")
 		if byGroups {
-			outputLines = append(outputLines, displayGroups(snapshot, true)...)
+			outputLines = append(outputLines, displayGroups(snapshot, true, filter)...)
 		} else {
-			outputLines = append(outputLines, displayTargets(snapshot)...)
+			outputLines = append(outputLines, displayTargets(snapshot, filter)...)
 		}
 	}
 	fmt.Println(strings.Join(outputLines, "\n"))
 
 }
 
-func displayGroups(snapshot *client.ConfigSnapshot, listTargets bool) []string {
+// targetFilter returns the targets selected with --target or --selector, or nil if all the targets should be displayed.
+func targetFilter(snapshot *client.ConfigSnapshot) *client.Group {
+	if len(targetPatterns) == 0 && labelSelector == "" {
+		return nil
+	}
+	selection := selectTargets(snapshot)
+	return &selection
+}
+
+func filterTargets(targets []client.Target, filter *client.Group) []client.Target {
+	if filter == nil {
+		return targets
+	}
+	var filtered []client.Target
+	for _, target := range targets {
+		if filter.Contains(target) {
+			filtered = append(filtered, target)
+		}
+	}
+	return filtered
+}
+
+func displayGroups(snapshot *client.ConfigSnapshot, listTargets bool, filter *client.Group) []string {
 	var outputLines []string
+	for _, group := range selectedGroups(snapshot, filter) {
+		outputLines = append(outputLines, displayGroup(group, listTargets, filter)...)
+	}
+	return outputLines
+}
+
+// selectedGroups returns the groups selected with --group, or all of them starting with the ungrouped targets.
+// Groups without any target matching the filter are left out.
+func selectedGroups(snapshot *client.ConfigSnapshot, filter *client.Group) []client.Group {
 	var groups []client.Group
-	if targetGroup == "" {
-		if ungrouped, ok := snapshot.GetGroup(targetGroup); ok {
-			outputLines = displayGroup(ungrouped, listTargets)
+	if targetGroup != "" {
+		groupNames := strings.Split(targetGroup, ",")
+		for _, groupName := range groupNames {
+			group, ok := snapshot.GetGroup(groupName)
+			if !ok {
+				log.Errorf("Group not found: %q", groupName)
+				os.Exit(1)
+			}
+			groups = append(groups, group)
 		}
-		groups = snapshot.Groups()
+		log.Infof("Active group: %s", strings.Join(groupNames, ", "))
 	} else {
-		group, ok := snapshot.GetGroup(targetGroup)
-		if !ok {
-			log.Errorf("Group not found: %q", targetGroup)
-			os.Exit(1)
+		if ungrouped, ok := snapshot.GetGroup(targetGroup); ok {
+			groups = append(groups, ungrouped)
 		}
-		log.Infof("Active group: %s", group.Name())
-		groups = []client.Group{group}
+		groups = append(groups, snapshot.Groups()...)
 	}
 
+	if filter == nil {
+		return groups
+	}
+	var filtered []client.Group
 	for _, group := range groups {
-		outputLines = append(outputLines, displayGroup(group, listTargets)...)
+		if len(filterTargets(group.Targets(), filter)) > 0 {
+			filtered = append(filtered, group)
+		}
 	}
-	return outputLines
+	return filtered
+}
+
+func buildTargetsResult(snapshot *client.ConfigSnapshot, filter *client.Group) targetsResult {
+	var result targetsResult
+	if !listGroups && !byGroups {
+		for _, target := range filterTargets(snapshot.Targets(), filter) {
+			result.Targets = append(result.Targets, newTargetResult(snapshot, target))
+		}
+		return result
+	}
+	for _, group := range selectedGroups(snapshot, filter) {
+		groupResult := groupResult{Name: group.Name(), Default: group.IsDefault()}
+		if byGroups && !listGroups {
+			for _, target := range filterTargets(group.Targets(), filter) {
+				groupResult.Targets = append(groupResult.Targets, newTargetResult(snapshot, target))
+			}
+		}
+		result.Groups = append(result.Groups, groupResult)
+	}
+	return result
 }
 
-func displayGroup(group client.Group, listTargets bool) []string {
+func displayGroup(group client.Group, listTargets bool, filter *client.Group) []string {
 	var outputLines []string
 	highlight := " "
 	if group.IsDefault() {
@@ -91,7 +157,7 @@ func displayGroup(group client.Group, listTargets bool) []string {
 	}
 	outputLines = append(outputLines, fmt.Sprintf("%s %s", highlight, name))
 	if listTargets {
-		for _, target := range group.Targets() {
+		for _, target := range filterTargets(group.Targets(), filter) {
 			aliases := ""
 			if target.HasAliases() {
 				aliases = fmt.Sprintf(" | %s", strings.Join(target.Aliases(), " | "))
@@ -102,11 +168,10 @@ func displayGroup(group client.Group, listTargets bool) []string {
 	return outputLines
 }
 
-func displayTargets(snapshot *client.ConfigSnapshot) []string {
-	allTargets := snapshot.Targets()
+func displayTargets(snapshot *client.ConfigSnapshot, filter *client.Group) []string {
 	defaultGroup := snapshot.DefaultGroup()
 	var outputLines []string
-	for _, target := range allTargets {
+	for _, target := range filterTargets(snapshot.Targets(), filter) {
 		highlight := " "
 		if defaultGroup.Contains(target) {
 			highlight = "*"
@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"github.com/sky-uk/osprey/v2/client"
+	"github.com/sky-uk/osprey/v2/client/kubeconfig"
+	"github.com/spf13/cobra"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var elevated bool
+
+var useCmd = &cobra.Command{
+	Use:   "use <target>",
+	Short: "Switch the current kubeconfig context to a target",
+	Long: `Use sets the current context of the kubeconfig file to the context of the target, by its name or any of its
+aliases. The user must have logged in to the target, with the --profile if given. With --elevated, it switches to
+the elevated context of the target, which impersonates the impersonate-user and impersonate-groups of the profile or
+target.`,
+	Args:              cobra.ExactArgs(1),
+	PersistentPreRun:  checkClientParams,
+	ValidArgsFunction: completeUseArgs,
+	Run:               use,
+}
+
+func init() {
+	RootCmd.AddCommand(useCmd)
+	useCmd.Flags().StringVarP(&ospreyconfigFile, "ospreyconfig", "o", "", "osprey targets configuration. Defaults to $HOME/.osprey/config or $HOME/.config/osprey/config.")
+	useCmd.Flags().StringVar(&profile, "profile", "", "profile of the provider to use instead of the default identity, e.g. admin")
+	useCmd.Flags().BoolVar(&elevated, "elevated", false, "switch to the elevated context of the target, which impersonates its impersonate-user")
+}
+
+func use(_ *cobra.Command, args []string) {
+	ospreyconfig, err := client.LoadConfig(ospreyconfigFile)
+	if err != nil {
+		log.Fatalf("Failed to load ospreyconfig file %s: %v", ospreyconfigFile, err)
+	}
+
+	snapshot := ospreyconfig.Snapshot()
+	target, ok := findTargetOrAlias(snapshot, args[0])
+	if !ok {
+		log.Fatalf("Target not found: %q", args[0])
+	}
+	if !snapshot.ProviderConfigs()[target.ProviderName()].HasProfile(profile) {
+		log.Fatalf("Profile %q is not defined for provider %s", profile, target.ProviderName())
+	}
+	names, err := snapshot.KubeconfigNames(target, profile)
+	if err != nil {
+		log.Fatalf("Failed to switch to %s: %v", args[0], err)
+	}
+	// the contexts are named after the target and then each of its aliases
+	name := names.Contexts[0]
+	for i, alias := range target.Aliases() {
+		if alias == args[0] {
+			name = names.Contexts[i+1]
+		}
+	}
+	if elevated {
+		if names.Impersonation == nil {
+			log.Fatalf("Failed to switch to %s: no impersonate-user is set for the target or profile", args[0])
+		}
+		name = names.ElevatedContext
+	}
+
+	err = kubeconfig.LoadConfig(ospreyconfig.Kubeconfig)
+	if err != nil {
+		log.Fatalf("Failed to initialise kubeconfig: %v", err)
+	}
+	if err := kubeconfig.UseContext(name); err != nil {
+		log.Fatalf("Failed to switch to %s, log in to it first: %v", name, err)
+	}
+	log.Infof("Switched to context %s", name)
+}
+
+// findTargetOrAlias returns the target of the given name or alias
+func findTargetOrAlias(snapshot *client.ConfigSnapshot, name string) (client.Target, bool) {
+	for _, target := range snapshot.Targets() {
+		if target.Name() == name {
+			return target, true
+		}
+		for _, alias := range target.Aliases() {
+			if alias == name {
+				return target, true
+			}
+		}
+	}
+	return client.Target{}, false
+}
+
+func completeUseArgs(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	return completeTargets(cmd, args, toComplete)
+}
@@ -3,10 +3,12 @@ package cmd
 import (
 	"os"
 	"path/filepath"
+	"sort"
 
 	"github.com/sky-uk/osprey/v2/client"
 	"github.com/sky-uk/osprey/v2/client/kubeconfig"
 	"github.com/spf13/cobra"
+	clientgo "k8s.io/client-go/tools/clientcmd/api"
 
 	log "github.com/sirupsen/logrus"
 )
@@ -23,16 +25,31 @@ var userCmd = &cobra.Command{
 	Run:              user,
 }
 
+var userStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the user of every profile of the targets",
+	Long: `Status returns the details of the user logged in to the targets with the default profile, and with each of the
+profiles of their provider.`,
+	Run: userStatus,
+}
+
 var (
 	ospreyconfigFile string
 	targetGroup      string
+	profile          string
 )
 
 func init() {
 	RootCmd.AddCommand(userCmd)
 	persistentFlags := userCmd.PersistentFlags()
 	persistentFlags.StringVarP(&ospreyconfigFile, "ospreyconfig", "o", "", "osprey targets configuration. Defaults to $HOME/.osprey/config")
-	persistentFlags.StringVarP(&targetGroup, "group", "g", "", "name of the group to log in to.")
+	persistentFlags.StringVarP(&targetGroup, "group", "g", "", "name of the group to log in to. Accepts a comma-separated list of groups.")
+	persistentFlags.StringArrayVar(&targetPatterns, "target", nil, "name, alias or glob pattern of the targets to log in to. May be repeated.")
+	persistentFlags.StringVarP(&labelSelector, "selector", "l", "", "label selector to filter the targets on, e.g. env=prod,region!=us")
+	persistentFlags.BoolVar(&allTargets, "all", false, "select all the targets in the configuration")
+	persistentFlags.StringVar(&profile, "profile", "", "profile of the providers to use instead of the default identity, e.g. admin")
+	registerSelectorCompletion(userCmd)
+	userCmd.AddCommand(userStatusCmd)
 }
 
 func user(_ *cobra.Command, _ []string) {
@@ -46,66 +63,142 @@ func user(_ *cobra.Command, _ []string) {
 		log.Fatalf("Failed to initialise kubeconfig: %v", err)
 	}
 
-	groupName := ospreyconfig.GroupOrDefault(targetGroup)
 	snapshot := ospreyconfig.Snapshot()
-	group, ok := snapshot.GetGroup(groupName)
-	if !ok {
-		log.Errorf("Group not found: %q", groupName)
-		os.Exit(1)
-	}
-
-	displayActiveGroup(targetGroup, ospreyconfig.DefaultGroup)
+	group := selectTargets(snapshot)
+	checkProfile(snapshot, group)
+	displaySelection(ospreyconfig.DefaultGroup)
 
 	config, err := kubeconfig.GetConfig()
 	if err != nil {
 		log.Fatalf("failed to load existing kubeconfig at %s: %v", kubeconfig.GetPathOptions().GetDefaultFilename(), err)
 	}
 
-	retrievers, err := ospreyconfig.GetRetrievers(snapshot.ProviderConfigs(), client.RetrieverOptions{})
+	retrievers, err := ospreyconfig.GetRetrievers(snapshot.ProviderConfigs(), client.RetrieverOptions{
+		Profile:     profile,
+		GroupsCache: client.NewGroupsCache(ospreyconfig.GroupsCache),
+	})
 	if err != nil {
 		log.Errorf("Unable to initialise providers: %v", err)
 	}
 
+	var results []userResult
 	for providerName, targets := range group.TargetsForProvider() {
 		for _, target := range targets {
-			retriever := retrievers[providerName]
-			authInfo := retriever.GetAuthInfo(config, target)
-			if authInfo != nil {
-				userInfo, err := retriever.RetrieveUserDetails(target, *authInfo)
-				if err != nil {
-					log.Errorf("%s: %v", target.Name(), err)
-					continue
-				}
-				provider, err := snapshot.GetProviderType(providerName)
-				if err != nil {
-					log.Errorf("%s: %v", target.Name(), err)
-					continue
-				}
-				if provider == client.OspreyProviderName {
-					log.Infof("%s: %s %s", target.Name(), userInfo.Username, userInfo.Roles)
-				} else {
-					log.Infof("%s: %s", target.Name(), userInfo.Username)
-				}
-			} else {
-				log.Infof("%s: none", target.Name())
-			}
+			results = append(results, userDetails(snapshot, config, retrievers[providerName], target, profile))
 		}
 	}
+
+	if structuredOutput() {
+		printResult(sortUserResults(results))
+	}
 }
 
-func checkClientParams(_ *cobra.Command, _ []string) {
-	if ospreyconfigFile == "" {
-		home, err := os.UserHomeDir()
+func userStatus(_ *cobra.Command, _ []string) {
+	ospreyconfig, err := client.LoadConfig(ospreyconfigFile)
+	if err != nil {
+		log.Fatalf("Failed to load ospreyconfig file %s: %v", ospreyconfigFile, err)
+	}
+
+	err = kubeconfig.LoadConfig(ospreyconfig.Kubeconfig)
+	if err != nil {
+		log.Fatalf("Failed to initialise kubeconfig: %v", err)
+	}
+
+	snapshot := ospreyconfig.Snapshot()
+	group := selectTargets(snapshot)
+	displaySelection(ospreyconfig.DefaultGroup)
+
+	config, err := kubeconfig.GetConfig()
+	if err != nil {
+		log.Fatalf("failed to load existing kubeconfig at %s: %v", kubeconfig.GetPathOptions().GetDefaultFilename(), err)
+	}
+
+	var results []userResult
+	for providerName, targets := range group.TargetsForProvider() {
+		providerConfig := snapshot.ProviderConfigs()[providerName]
+		// the user details don't depend on the profile's login options, so its targets share the provider's retriever
+		retrievers, err := ospreyconfig.GetRetrievers(map[string]*client.ProviderConfig{providerName: providerConfig},
+			client.RetrieverOptions{GroupsCache: client.NewGroupsCache(ospreyconfig.GroupsCache)})
 		if err != nil {
-			panic(err)
+			log.Errorf("Unable to initialise providers: %v", err)
 		}
-		for _, defaultConfig := range defaultConfigLocations {
-			defaultConfig = filepath.Join(home, defaultConfig)
-			if _, err := os.Stat(defaultConfig); err == nil {
-				ospreyconfigFile = defaultConfig
-				break
+		for _, providerProfile := range append([]string{""}, providerConfig.Profiles()...) {
+			for _, target := range targets {
+				results = append(results, userDetails(snapshot, config, retrievers[providerName], target, providerProfile))
 			}
 		}
+	}
+
+	if structuredOutput() {
+		printResult(sortUserResults(results))
+	}
+}
+
+// userDetails logs and returns the details of the user logged in to the target with the profile
+func userDetails(snapshot *client.ConfigSnapshot, config *clientgo.Config, retriever client.Retriever, target client.Target, profile string) userResult {
+	result := userResult{Target: target.Name(), Provider: target.ProviderName(), Profile: profile}
+	names, err := snapshot.KubeconfigNames(target, profile)
+	if err != nil {
+		log.Errorf("%s: %v", target.Name(), err)
+		result.Error = err.Error()
+		return result
+	}
+	name := names.Contexts[0]
+	if retriever == nil {
+		log.Infof("%s: none", name)
+		return result
+	}
+	authInfo := retriever.GetAuthInfo(config, names.User)
+	if authInfo == nil {
+		log.Infof("%s: none", name)
+		return result
+	}
+	result.LoggedIn = true
+	userInfo, err := retriever.RetrieveUserDetails(target, profile, *authInfo)
+	if err != nil {
+		log.Errorf("%s: %v", name, err)
+		result.Error = err.Error()
+		return result
+	}
+	provider, err := snapshot.GetProviderType(target.ProviderName())
+	if err != nil {
+		log.Errorf("%s: %v", name, err)
+		result.Error = err.Error()
+		return result
+	}
+	result.Username = userInfo.Username
+	result.Roles = userInfo.Roles
+	// the groups of azure users are only known if their token lists them, or if they were resolved on login
+	if provider == client.OspreyProviderName || len(userInfo.Roles) > 0 {
+		log.Infof("%s: %s %s", name, userInfo.Username, userInfo.Roles)
+	} else {
+		log.Infof("%s: %s", name, userInfo.Username)
+	}
+	return result
+}
+
+func sortUserResults(results []userResult) []userResult {
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Target != results[j].Target {
+			return results[i].Target < results[j].Target
+		}
+		return results[i].Profile < results[j].Profile
+	})
+	return results
+}
+
+// checkProfile exits if the --profile is not one of the profiles of the providers of the selected targets
+func checkProfile(snapshot *client.ConfigSnapshot, group client.Group) {
+	for providerName := range group.TargetsForProvider() {
+		if !snapshot.ProviderConfigs()[providerName].HasProfile(profile) {
+			log.Fatalf("Profile %q is not defined for provider %s", profile, providerName)
+		}
+	}
+}
+
+func checkClientParams(_ *cobra.Command, _ []string) {
+	if ospreyconfigFile == "" {
+		ospreyconfigFile = defaultConfigFile()
 		if ospreyconfigFile == "" {
 			log.Fatalf("No osprey configuration found in %v", defaultConfigLocations)
 		}
@@ -113,3 +206,18 @@ func checkClientParams(_ *cobra.Command, _ []string) {
 
 	checkFile(ospreyconfigFile, "ospreyconfig")
 }
+
+// defaultConfigFile returns the first of the defaultConfigLocations that exists in the user's home, or "" if none do.
+func defaultConfigFile() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		panic(err)
+	}
+	for _, defaultConfig := range defaultConfigLocations {
+		defaultConfig = filepath.Join(home, defaultConfig)
+		if _, err := os.Stat(defaultConfig); err == nil {
+			return defaultConfig
+		}
+	}
+	return ""
+}
@@ -3,12 +3,33 @@ package common
 import (
 	"bufio"
 	"fmt"
+	"io"
+	"os"
 	"strings"
+	"sync"
 )
 
+// PromptOutput is where the prompts and login links are written: stdout, unless the results of the command are
+// written there as json or yaml.
+var PromptOutput io.Writer = os.Stdout
+
+// stdin is read by all the prompts through the same buffered reader, so that none of them loses the input buffered
+// by another one
+var stdin = struct {
+	sync.Mutex
+	reader *bufio.Reader
+}{reader: bufio.NewReader(os.Stdin)}
+
+// WithStdin calls prompt with the reader of stdin shared by the prompts, one prompt at a time.
+func WithStdin(prompt func(reader *bufio.Reader) error) error {
+	stdin.Lock()
+	defer stdin.Unlock()
+	return prompt(stdin.reader)
+}
+
 // Read is a helper function to read input from stdin
 func Read(name, prompt string, reader *bufio.Reader, inputFunc func(string, *bufio.Reader) (string, error)) (string, error) {
-	fmt.Print(prompt)
+	fmt.Fprint(PromptOutput, prompt)
 	return inputFunc(name, reader)
 }
 
@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"time"
 )
 
@@ -25,9 +26,109 @@ func LoadTLSCert(path string) (string, error) {
 	return certData, nil
 }
 
+// ClientOptions holds the connection settings of the http.Client created by NewClient.
+type ClientOptions struct {
+	// SkipVerify disables the verification of the server's certificate.
+	SkipVerify bool
+	// CACerts are base64-encoded CA certs trusted in addition to the system certs.
+	CACerts []string
+	// ProxyURL is the URL of an HTTP, HTTPS or SOCKS5 proxy to connect through, with optional user:password credentials.
+	// The proxy environment variables are used if empty.
+	ProxyURL string
+	// IPFamily restricts the connections to IPv4 or IPv6. Defaults to both.
+	IPFamily IPFamily
+	// ClientCertificate is the path to the PEM-encoded certificate presented to servers that require client
+	// certificates. It requires ClientKey.
+	ClientCertificate string
+	// ClientKey is the path to the PEM-encoded private key of the ClientCertificate.
+	ClientKey string
+	// PinnedPublicKeys are the sha256/<base64> hashes of the public keys trusted for the server. If set, the
+	// server's chain must contain one of them, on top of the CA verification.
+	PinnedPublicKeys []string
+	// ServerName is the name used to verify the server's certificate. Defaults to the host of the request.
+	ServerName string
+}
+
 // NewTLSClient creates a new http.Client configured for TLS. It uses the system
 // certs by default if possible and appends all of the provided certs.
 func NewTLSClient(skipVerify bool, caCerts ...string) (*http.Client, error) {
+	return NewClient(ClientOptions{SkipVerify: skipVerify, CACerts: caCerts})
+}
+
+// NewClient creates a new http.Client configured for TLS with the given options.
+func NewClient(options ClientOptions) (*http.Client, error) {
+	certPool, err := NewCertPool(options.CACerts...)
+	if err != nil {
+		return nil, err
+	}
+
+	clientCertificates, err := LoadClientCertificates(options.ClientCertificate, options.ClientKey)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := NewTransport(options.IPFamily)
+	transport.TLSClientConfig = &tls.Config{
+		RootCAs:            certPool,
+		InsecureSkipVerify: options.SkipVerify,
+		Certificates:       clientCertificates,
+		ServerName:         options.ServerName,
+	}
+	if len(options.PinnedPublicKeys) > 0 {
+		if err := ParsePublicKeyPins(options.PinnedPublicKeys); err != nil {
+			return nil, err
+		}
+		transport.TLSClientConfig.VerifyPeerCertificate = verifyPeerPublicKeys(options.PinnedPublicKeys)
+	}
+	transport.ExpectContinueTimeout = 5 * time.Second
+	transport.TLSHandshakeTimeout = 7 * time.Second
+	if options.ProxyURL != "" {
+		proxyURL, err := ParseProxyURL(options.ProxyURL)
+		if err != nil {
+			return nil, err
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	return &http.Client{Transport: transport}, nil
+}
+
+// LoadClientCertificates loads the client certificate and its key from the PEM-encoded files.
+// It returns no certificates if both paths are empty.
+func LoadClientCertificates(certFile, keyFile string) ([]tls.Certificate, error) {
+	if certFile == "" && keyFile == "" {
+		return nil, nil
+	}
+	if certFile == "" || keyFile == "" {
+		return nil, errors.New("client-certificate and client-key must be set together")
+	}
+	certificate, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load client certificate %s: %w", certFile, err)
+	}
+	return []tls.Certificate{certificate}, nil
+}
+
+// ParseProxyURL parses and validates the URL of an HTTP, HTTPS or SOCKS5 proxy.
+func ParseProxyURL(proxyURL string) (*url.URL, error) {
+	parsed, err := url.Parse(proxyURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy-url: %w", err)
+	}
+	switch parsed.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, fmt.Errorf("invalid proxy-url %q: the scheme must be one of http, https or socks5", proxyURL)
+	}
+	if parsed.Host == "" {
+		return nil, fmt.Errorf("invalid proxy-url %q: the host is required", proxyURL)
+	}
+	return parsed, nil
+}
+
+// NewCertPool returns a pool with the system certs, if possible, and all of the provided
+// base64-encoded certs.
+func NewCertPool(caCerts ...string) (*x509.CertPool, error) {
 	certPool, err := x509.SystemCertPool()
 	if err != nil {
 		if len(caCerts) == 0 {
@@ -47,11 +148,5 @@ func NewTLSClient(skipVerify bool, caCerts ...string) (*http.Client, error) {
 			}
 		}
 	}
-
-	transport := DefaultTransport()
-	transport.TLSClientConfig = &tls.Config{RootCAs: certPool, InsecureSkipVerify: skipVerify}
-	transport.ExpectContinueTimeout = 5 * time.Second
-	transport.TLSHandshakeTimeout = 7 * time.Second
-
-	return &http.Client{Transport: transport}, nil
+	return certPool, nil
 }
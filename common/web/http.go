@@ -2,22 +2,66 @@ package web
 
 import (
 	"context"
+	"fmt"
 	"net"
 	"net/http"
 	"time"
 )
 
-// DefaultTransport returns a default http.Transport and forces ipv4.
+// IPFamily selects the IP versions used to connect to servers.
+type IPFamily string
+
+const (
+	// IPFamilyAuto connects over IPv4 and IPv6. When a host has addresses in both families, the connections race
+	// and the first one to succeed wins (Happy Eyeballs, RFC 6555).
+	IPFamilyAuto IPFamily = "auto"
+	// IPFamilyIPv4 only connects over IPv4.
+	IPFamilyIPv4 IPFamily = "ipv4"
+	// IPFamilyIPv6 only connects over IPv6.
+	IPFamilyIPv6 IPFamily = "ipv6"
+)
+
+// ParseIPFamily returns the IPFamily for one of auto, ipv4 or ipv6. It defaults to IPFamilyAuto if empty.
+func ParseIPFamily(value string) (IPFamily, error) {
+	switch family := IPFamily(value); family {
+	case "":
+		return IPFamilyAuto, nil
+	case IPFamilyAuto, IPFamilyIPv4, IPFamilyIPv6:
+		return family, nil
+	default:
+		return "", fmt.Errorf("invalid ip-family %q: must be one of auto, ipv4 or ipv6", value)
+	}
+}
+
+// Network returns the network name to dial for the IPFamily: tcp, tcp4 or tcp6.
+func (f IPFamily) Network() string {
+	switch f {
+	case IPFamilyIPv4:
+		return "tcp4"
+	case IPFamilyIPv6:
+		return "tcp6"
+	default:
+		return "tcp"
+	}
+}
+
+// DefaultTransport returns a default http.Transport that connects over IPv4 and IPv6.
 func DefaultTransport() *http.Transport {
+	return NewTransport(IPFamilyAuto)
+}
+
+// NewTransport returns a default http.Transport that only connects over the given IPFamily.
+func NewTransport(family IPFamily) *http.Transport {
 	dialer := net.Dialer{
 		Timeout:   10 * time.Second,
 		KeepAlive: 30 * time.Second,
 	}
+	network := family.Network()
 
 	return &http.Transport{
 		Proxy: http.ProxyFromEnvironment,
-		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
-			return dialer.DialContext(ctx, "tcp4", addr)
+		DialContext: func(ctx context.Context, _, addr string) (net.Conn, error) {
+			return dialer.DialContext(ctx, network, addr)
 		},
 		ForceAttemptHTTP2:     true,
 		MaxIdleConns:          100,
@@ -0,0 +1,76 @@
+package web
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const publicKeyPinPrefix = "sha256/"
+
+// PublicKeyPin returns the pin of the certificate's public key: sha256/ followed by the base64-encoded
+// SHA-256 hash of its DER-encoded SubjectPublicKeyInfo.
+func PublicKeyPin(cert *x509.Certificate) string {
+	hash := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return publicKeyPinPrefix + base64.StdEncoding.EncodeToString(hash[:])
+}
+
+// ParsePublicKeyPins validates the format of the pins, sha256/<base64 SHA-256 hash>.
+func ParsePublicKeyPins(pins []string) error {
+	for _, pin := range pins {
+		if !strings.HasPrefix(pin, publicKeyPinPrefix) {
+			return fmt.Errorf("invalid pinned public key %q: must start with %s", pin, publicKeyPinPrefix)
+		}
+		hash, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(pin, publicKeyPinPrefix))
+		if err != nil || len(hash) != sha256.Size {
+			return fmt.Errorf("invalid pinned public key %q: must be a base64-encoded SHA-256 hash", pin)
+		}
+	}
+	return nil
+}
+
+// VerifyPublicKeyPins checks that the public key of at least one of the certificates of the chain matches one of
+// the pins. Listing more than one pin allows backup keys, e.g. for the next rotation. The error names the pins of
+// the chain when none matches.
+func VerifyPublicKeyPins(pins []string, chain []*x509.Certificate) error {
+	var chainPins []string
+	for _, cert := range chain {
+		pin := PublicKeyPin(cert)
+		for _, pinned := range pins {
+			if pin == pinned {
+				return nil
+			}
+		}
+		chainPins = append(chainPins, fmt.Sprintf("%s (%s)", pin, cert.Subject.String()))
+	}
+	return fmt.Errorf("public key pinning failed: the server's keys %s match none of the pinned public keys",
+		strings.Join(chainPins, ", "))
+}
+
+// verifyPeerPublicKeys returns a tls.Config.VerifyPeerCertificate function that checks the pins against the
+// verified chains or, when the verification is skipped, against the server's own certificate only. The other
+// certificates sent by an unverified server prove nothing, as anyone can send the pinned CA along with their own.
+func verifyPeerPublicKeys(pins []string) func([][]byte, [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+		if len(verifiedChains) == 0 {
+			if len(rawCerts) == 0 {
+				return errors.New("public key pinning failed: the server sent no certificate")
+			}
+			leaf, err := x509.ParseCertificate(rawCerts[0])
+			if err != nil {
+				return fmt.Errorf("public key pinning failed: %w", err)
+			}
+			return VerifyPublicKeyPins(pins, []*x509.Certificate{leaf})
+		}
+		var err error
+		for _, chain := range verifiedChains {
+			if err = VerifyPublicKeyPins(pins, chain); err == nil {
+				return nil
+			}
+		}
+		return err
+	}
+}
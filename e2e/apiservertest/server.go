@@ -2,7 +2,12 @@ package apiservertest
 
 import (
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/x509"
 	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
 	"fmt"
 	"net/http"
 	"strings"
@@ -12,16 +17,24 @@ import (
 
 const rootCaRequestPath = "/api/v1/namespaces/kube-public/configmaps/kube-root-ca.crt"
 const clientConfigRequestPath = "/apis/authentication.gke.io/v2alpha1/namespaces/kube-public/clientconfigs/default"
+const clusterInfoRequestPath = "/api/v1/namespaces/kube-public/configmaps/cluster-info"
 
 // Server holds the interface to a mocked API server
 type Server interface {
 	RequestCount(endpoint string) int
+	// SetUnavailable makes the kube-public endpoints answer 503 Service Unavailable until Reset
+	SetUnavailable(unavailable bool)
 	Reset()
 	Stop()
 }
 
 func (m *mockAPIServer) Reset() {
 	m.requestCount = initialiseRequestStates()
+	m.unavailable = false
+}
+
+func (m *mockAPIServer) SetUnavailable(unavailable bool) {
+	m.unavailable = unavailable
 }
 
 func (m *mockAPIServer) RequestCount(endpoint string) int {
@@ -34,6 +47,7 @@ type mockAPIServer struct {
 	httpServer   *http.Server
 	requestCount map[string]int
 	mux          *http.ServeMux
+	unavailable  bool
 }
 
 func setup(m *mockAPIServer) *http.Server {
@@ -48,6 +62,7 @@ func initialiseRequestStates() map[string]int {
 	endpoints := []string{
 		rootCaRequestPath,
 		clientConfigRequestPath,
+		clusterInfoRequestPath,
 	}
 	requestStates := make(map[string]int)
 
@@ -73,6 +88,7 @@ func Start(host string, port int32) (Server, error) {
 
 	server.mux.Handle(rootCaRequestPath, handleRootCaRequest(server))
 	server.mux.Handle(clientConfigRequestPath, handleClientConfigRequest(server))
+	server.mux.Handle(clusterInfoRequestPath, handleClusterInfoRequest(server))
 
 	go func() {
 		if err := server.httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
@@ -91,20 +107,66 @@ func (m *mockAPIServer) Stop() {
 func handleRootCaRequest(m *mockAPIServer) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		defer r.Body.Close()
-		_, _ = w.Write([]byte(caConfigMapResponse))
 		m.requestCount[r.URL.Path]++
+		if m.unavailable {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(caConfigMapResponse))
 	}
 }
 
 func handleClientConfigRequest(m *mockAPIServer) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		defer r.Body.Close()
+		m.requestCount[r.URL.Path]++
+		if m.unavailable {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
 		_, _ = w.Write([]byte(clientConfigResponse))
+	}
+}
+
+func handleClusterInfoRequest(m *mockAPIServer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
 		m.requestCount[r.URL.Path]++
+		if m.unavailable {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(clusterInfoResponse))
+	}
+}
+
+// signClusterInfo returns the detached JWS of the kubeconfig signed with the bootstrap token, as kubeadm does
+func signClusterInfo(kubeconfig, bootstrapToken string) string {
+	token := strings.Split(bootstrapToken, ".")
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","kid":"` + token[0] + `"}`))
+	mac := hmac.New(sha256.New, []byte(token[1]))
+	mac.Write([]byte(header + "." + base64.RawURLEncoding.EncodeToString([]byte(kubeconfig))))
+	return header + ".." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// KubeadmCACertHash returns the kubeadm ca-cert-hash of the CA in the cluster-info ConfigMap
+func KubeadmCACertHash() string {
+	block, _ := pem.Decode([]byte(CaCert2Pem))
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		panic(err)
 	}
+	hash := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return "sha256:" + hex.EncodeToString(hash[:])
 }
 
 const (
+	// BootstrapToken is the kubeadm bootstrap token that signs the cluster-info ConfigMap
+	BootstrapToken = "abcdef.0123456789abcdef"
+
+	// KubeadmAPIServerURL is the API server URL in the kubeconfig of the kubeadm cluster-info ConfigMap
+	KubeadmAPIServerURL = "https://10.10.10.11:6443"
+
 	// CaCert1Pem is used in the kube-root-ca.crt ConfigMap response
 	CaCert1Pem = `-----BEGIN CERTIFICATE-----
 MIIGhjCCBW6gAwIBAgITZgAEN7n0RPnqTqxkKAABAAQ3uTANBgkqhkiG9w0BAQsF
@@ -185,6 +247,17 @@ lyVgLSFHid1LbnPN/klDPw==
 
 	// InternalAPIServerURL is the API server URL returned in the GKE ClientConfig resource, representing the Envoy proxy for OIDC requests
 	InternalAPIServerURL = "https://10.10.10.10:443"
+
+	// GKEIssuerURI is the issuer of the oidc authentications of the GKE ClientConfig, served by the oidctest server
+	GKEIssuerURI = "http://localhost:14980/v2.0"
+	// GKEClientID is the client ID of the first oidc authentication of the GKE ClientConfig
+	GKEClientID = "gke-client-id"
+	// GKERedirectURI is the redirect URI of the first oidc authentication of the GKE ClientConfig
+	GKERedirectURI = "http://localhost:65525/auth/callback"
+	// GKEAdminAuthentication is the name of the second oidc authentication of the GKE ClientConfig
+	GKEAdminAuthentication = "azure-ad-admin"
+	// GKEAdminRedirectURI is the redirect URI of the GKEAdminAuthentication
+	GKEAdminRedirectURI = "http://localhost:65526/callback"
 )
 
 var (
@@ -206,8 +279,64 @@ var (
   "apiVersion": "authentication.gke.io/v2alpha1",
   "kind": "ClientConfig",
   "spec": {
+    "authentication": [
+      {
+        "name": "ldap",
+        "ldap": {
+          "host": "ldap.example.com:636"
+        }
+      },
+      {
+        "name": "azure-ad",
+        "oidc": {
+          "clientID": "` + GKEClientID + `",
+          "clientSecret": "gke-client-secret",
+          "issuerURI": "` + GKEIssuerURI + `",
+          "kubectlRedirectURI": "` + GKERedirectURI + `",
+          "scopes": "openid,email",
+          "userClaim": "email",
+          "groupsClaim": "groups"
+        }
+      },
+      {
+        "name": "` + GKEAdminAuthentication + `",
+        "oidc": {
+          "clientID": "gke-admin-client-id",
+          "issuerURI": "` + GKEIssuerURI + `",
+          "kubectlRedirectURI": "` + GKEAdminRedirectURI + `",
+          "scopes": "openid",
+          "userClaim": "email",
+          "groupsClaim": "roles"
+        }
+      }
+    ],
     "certificateAuthorityData": "` + base64.StdEncoding.EncodeToString([]byte(CaCert2Pem)) + `",
     "server": "` + InternalAPIServerURL + `"
   }
+}`
+	clusterInfoKubeconfig = `apiVersion: v1
+kind: Config
+clusters:
+- cluster:
+    certificate-authority-data: ` + base64.StdEncoding.EncodeToString([]byte(CaCert2Pem)) + `
+    server: ` + KubeadmAPIServerURL + `
+  name: ""
+contexts: null
+current-context: ""
+preferences: {}
+users: null
+`
+	clusterInfoResponse = `
+{
+  "kind": "ConfigMap",
+  "apiVersion": "v1",
+  "metadata": {
+    "name": "cluster-info",
+    "namespace": "kube-public"
+  },
+  "data": {
+    "jws-kubeconfig-abcdef": "` + signClusterInfo(clusterInfoKubeconfig, BootstrapToken) + `",
+    "kubeconfig": "` + strings.NewReplacer("\n", `\n`, `"`, `\"`).Replace(clusterInfoKubeconfig) + `"
+  }
 }`
 )
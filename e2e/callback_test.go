@@ -0,0 +1,63 @@
+package e2e
+
+import (
+	"fmt"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/sky-uk/osprey/v2/client"
+	"github.com/sky-uk/osprey/v2/client/kubeconfig"
+	. "github.com/sky-uk/osprey/v2/e2e/ospreytest"
+)
+
+var _ = Describe("Shared call-back webserver", func() {
+	const secondTarget = "tenant-b.cluster"
+	var userLoginArgs []string
+
+	BeforeEach(func() {
+		resetDefaults()
+		apiServerURL = fmt.Sprintf("http://localhost:%d", apiServerPort)
+		setupClientForEnvironments(azureProviderName, map[string][]string{"local": {}}, oidcClientID, apiServerURL, false)
+		userLoginArgs = []string{"user", "login", ospreyconfigFlag, "--disable-browser-popup"}
+
+		// a second tenant with the same redirect URI
+		first := ospreyconfig.Providers[0]
+		first.Name = "tenant-a"
+		first.Azure.AzureTenantID = "tenant-a"
+		secondOptions := *first.Azure
+		secondOptions.AzureTenantID = "tenant-b"
+		ospreyconfig.Providers = append(ospreyconfig.Providers, &client.ProviderEntry{
+			Name:    "tenant-b",
+			Type:    client.AzureProviderName,
+			Azure:   &secondOptions,
+			Targets: map[string]*client.TargetEntry{secondTarget: {APIServer: apiServerURL}},
+		})
+		Expect(SaveConfig(ospreyconfig.Config, ospreyconfig.ConfigFile)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		oidcTestServer.Reset()
+		apiTestServer.Reset()
+		cleanup()
+	})
+
+	It("logs in to providers with the same redirect URI one after another", func() {
+		login := loginCommand(ospreyBinary, userLoginArgs...)
+		for i := 0; i < 2; i++ {
+			_, err := doOIDCMockRequest("/v2.0/authorize", oidcClientID, oidcRedirectURI, []string{"api://some-dummy-scope"})
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		login.AssertSuccess()
+		Expect(oidcTestServer.RequestCount("/v2.0/authorize")).To(Equal(2))
+		Expect(login.GetOutput()).To(ContainSubstring("Logging in to azure:tenant-a (tenant tenant-a)"))
+		Expect(login.GetOutput()).To(ContainSubstring("Logging in to azure:tenant-b (tenant tenant-b)"))
+		Expect(login.GetOutput()).To(ContainSubstring("Continuing in the same browser window"))
+
+		Expect(kubeconfig.LoadConfig(ospreyconfig.Kubeconfig)).To(Succeed())
+		generatedConfig, err := kubeconfig.GetConfig()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(generatedConfig.AuthInfos[OspreyconfigTargetName("local")].Token).NotTo(BeEmpty())
+		Expect(generatedConfig.AuthInfos[secondTarget].Token).NotTo(BeEmpty())
+	})
+})
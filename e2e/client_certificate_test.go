@@ -0,0 +1,124 @@
+package e2e
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/sky-uk/osprey/v2/e2e/clitest"
+	"github.com/sky-uk/osprey/v2/e2e/dextest"
+	. "github.com/sky-uk/osprey/v2/e2e/ospreytest"
+	"github.com/sky-uk/osprey/v2/e2e/ssltest"
+)
+
+var _ = Describe("Client certificates", func() {
+	const (
+		dexPort    = int32(13982)
+		ospreyPort = int32(13983)
+	)
+
+	var (
+		mtlsDex        *dextest.TestDex
+		mtlsOsprey     *TestOsprey
+		certsDir       string
+		trustedCert    string
+		trustedKey     string
+		untrustedCert  string
+		untrustedKey   string
+		configFile     string
+		kubeconfigFile string
+	)
+
+	BeforeEach(func() {
+		var err error
+		mtlsDex, err = dextest.Start(testDir, dexPort, "mtls", ldapServer)
+		Expect(err).ToNot(HaveOccurred(), "mtls dex should start")
+
+		certsDir = filepath.Join(testDir, "mtls", "clients")
+		trustedCert, trustedKey = ssltest.CreateClientCertificates("trusted", certsDir)
+		untrustedCert, untrustedKey = ssltest.CreateClientCertificates("untrusted", certsDir)
+
+		mtlsOsprey = StartWithOptions(testDir, true, ospreyPort, mtlsDex, ServerOptions{ClientCA: trustedCert})
+		time.Sleep(100 * time.Millisecond)
+		mtlsOsprey.AssertStillRunning()
+
+		configFile = filepath.Join(testDir, "mtls-config")
+		kubeconfigFile = filepath.Join(testDir, "mtls-kubeconfig")
+	})
+
+	AfterEach(func() {
+		mtlsOsprey.Stop()
+		mtlsOsprey.AssertStoppedRunning()
+		dextest.Stop(mtlsDex)
+		os.Remove(kubeconfigFile)
+	})
+
+	writeConfig := func(providerOptions, targetOptions string) {
+		config := fmt.Sprintf(`apiVersion: v3
+kubeconfig: %s
+providers:
+  - type: osprey
+    certificate-authority: %s
+%s    targets:
+      mtls:
+        server: %s
+%s`, kubeconfigFile, mtlsOsprey.CertFile, providerOptions, mtlsOsprey.URL, targetOptions)
+		Expect(ioutil.WriteFile(configFile, []byte(config), 0644)).To(Succeed())
+	}
+
+	loginCommand := func() clitest.TestCommand {
+		return Client("user", "login", "--ospreyconfig="+configFile, "--username=jane", "--password=foo")
+	}
+
+	It("logs in with the provider's client certificate", func() {
+		writeConfig(fmt.Sprintf("    osprey:\n      client-certificate: %s\n      client-key: %s\n", trustedCert, trustedKey), "")
+
+		loginCommand().RunAndAssertSuccess()
+		Expect(kubeconfigFile).To(BeAnExistingFile())
+		Expect(mtlsOsprey.GetOutput()).To(ContainSubstring(`with client certificate \"CN=trusted\"`))
+	})
+
+	It("logs in with the target's client certificate", func() {
+		writeConfig(fmt.Sprintf("    osprey:\n      client-certificate: %s\n      client-key: %s\n", untrustedCert, untrustedKey),
+			fmt.Sprintf("        client-certificate: %s\n        client-key: %s\n", trustedCert, trustedKey))
+
+		loginCommand().RunAndAssertSuccess()
+	})
+
+	It("fails to log in without a client certificate", func() {
+		writeConfig("", "")
+
+		login := loginCommand()
+		login.RunAndAssertFailure()
+		Expect(login.GetOutput()).To(ContainSubstring("a valid client certificate is required"))
+		Expect(mtlsOsprey.GetOutput()).To(ContainSubstring("without a valid client certificate"))
+	})
+
+	It("fails to log in with an untrusted client certificate", func() {
+		writeConfig("", fmt.Sprintf("        client-certificate: %s\n        client-key: %s\n", untrustedCert, untrustedKey))
+
+		login := loginCommand()
+		login.RunAndAssertFailure()
+		Expect(login.GetOutput()).To(ContainSubstring("failed to retrieve access-token"))
+	})
+
+	It("rejects a client certificate without its key", func() {
+		writeConfig("", fmt.Sprintf("        client-certificate: %s\n", trustedCert))
+
+		login := loginCommand()
+		login.RunAndAssertFailure()
+		Expect(login.GetOutput()).To(ContainSubstring("client-certificate and client-key must be set together"))
+	})
+
+	It("keeps the health check open to clients without certificates", func() {
+		resp, err := mtlsOsprey.CallHealthcheck()
+
+		Expect(err).To(BeNil(), "called healthcheck")
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+	})
+})
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"os"
 	"os/exec"
 	"sync"
 	"syscall"
@@ -17,6 +18,12 @@ func NewAsyncCommand(name string, args ...string) AsyncTestCommand {
 	return &asyncCommandWrapper{Name: name, Args: args}
 }
 
+// NewAsyncCommandWithStdin returns an instance of an AsyncTestCommand that reads its stdin from the given file,
+// e.g. the read end of an os.Pipe written to while the command runs.
+func NewAsyncCommandWithStdin(stdin *os.File, name string, args ...string) AsyncTestCommand {
+	return &asyncCommandWrapper{Name: name, Args: args, stdin: stdin}
+}
+
 // AsyncTestCommand defines the behaviour of a long running command.
 type AsyncTestCommand interface {
 	// Run starts the wrapped command on a new goroutine and waits for it to finish.
@@ -56,7 +63,8 @@ type asyncCommandWrapper struct {
 	cmd          *exec.Cmd
 	finished     bool  // guarded by mutex
 	error        error // guarded by mutex
-	output       io.Reader
+	output       *safeBuffer
+	stdin        io.Reader
 	stopFlag     sync.WaitGroup
 	finishedFlag sync.WaitGroup
 	sync.Mutex
@@ -68,6 +76,7 @@ func (c *asyncCommandWrapper) Run() {
 	c.output = &buf
 	c.cmd.Stdout = &buf
 	c.cmd.Stderr = &buf
+	c.cmd.Stdin = c.stdin
 	buf.Write([]byte("*** ASYNC COMMAND STARTED\n"))
 	buf.Write([]byte(fmt.Sprintf("%s\n", c.cmd.Args)))
 	err := c.cmd.Start()
@@ -161,10 +170,7 @@ func (c *asyncCommandWrapper) Failed() bool {
 }
 
 func (c *asyncCommandWrapper) GetOutput() string {
-	var buf bytes.Buffer
-	_, err := buf.ReadFrom(c.output)
-	gomega.Expect(err).To(gomega.BeNil())
-	return fmt.Sprintf("%s\n", string(buf.Bytes()))
+	return fmt.Sprintf("%s\n", c.output.String())
 }
 
 func (c *asyncCommandWrapper) PrintOutput() {
@@ -190,8 +196,9 @@ func (s *safeBuffer) Write(p []byte) (n int, err error) {
 	return s.buf.Write(p)
 }
 
-func (s *safeBuffer) Read(p []byte) (n int, err error) {
+// String returns the output written so far, without consuming it
+func (s *safeBuffer) String() string {
 	s.Lock()
 	defer s.Unlock()
-	return s.buf.Read(p)
+	return s.buf.String()
 }
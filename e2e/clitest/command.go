@@ -22,6 +22,8 @@ type TestCommand interface {
 	Failed() bool
 	// GetOutput returns the stdout and stderr of the command.
 	GetOutput() string
+	// GetStdout returns only the stdout of the command.
+	GetStdout() string
 	// PrintOutput prints the output of the command to standard output.
 	PrintOutput()
 	// Error returns the error for the command if one exists.
@@ -70,6 +72,10 @@ func (c *commandWrapper) GetOutput() string {
 	return fmt.Sprintf("%s\n%s", c.output, c.stderr)
 }
 
+func (c *commandWrapper) GetStdout() string {
+	return c.output
+}
+
 func (c *commandWrapper) PrintOutput() {
 	fmt.Println("--- Output ---")
 	fmt.Println(c.cmd)
@@ -0,0 +1,157 @@
+package e2e
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/sky-uk/osprey/v2/client"
+	"github.com/sky-uk/osprey/v2/client/kubeconfig"
+	"github.com/sky-uk/osprey/v2/e2e/apiservertest"
+	"github.com/sky-uk/osprey/v2/e2e/clitest"
+	. "github.com/sky-uk/osprey/v2/e2e/ospreytest"
+	"gopkg.in/yaml.v2"
+)
+
+var _ = Describe("Cluster details cache", func() {
+	var userLoginArgs []string
+
+	BeforeEach(func() {
+		resetDefaults()
+		apiServerURL = fmt.Sprintf("http://localhost:%d", apiServerPort)
+		setupClientForEnvironments(azureProviderName, environmentsToUse, oidcClientID, apiServerURL, useGKEClientConfig)
+		userLoginArgs = []string{"user", "login", ospreyconfigFlag, "--disable-browser-popup"}
+	})
+
+	AfterEach(func() {
+		oidcTestServer.Reset()
+		apiTestServer.Reset()
+		cleanup()
+	})
+
+	login := func() clitest.AsyncTestCommand {
+		login := loginCommand(ospreyBinary, userLoginArgs...)
+		_, err := doOIDCMockRequest("/v2.0/authorize", oidcClientID, oidcRedirectURI, []string{"api://some-dummy-scope"})
+		Expect(err).NotTo(HaveOccurred())
+		return login
+	}
+
+	cacheKey := func() string {
+		return fmt.Sprintf("%s:provider-0/%s", azureProviderName, OspreyconfigTargetName("local"))
+	}
+
+	writeCache := func(cache map[string]*client.CachedCluster) {
+		data, err := yaml.Marshal(cache)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ioutil.WriteFile(clusterCacheFile(), data, 0600)).To(Succeed())
+	}
+
+	readCache := func() map[string]*client.CachedCluster {
+		data, err := ioutil.ReadFile(clusterCacheFile())
+		Expect(err).NotTo(HaveOccurred())
+		cache := map[string]*client.CachedCluster{}
+		Expect(yaml.Unmarshal(data, &cache)).To(Succeed())
+		return cache
+	}
+
+	It("caches the discovered cluster details", func() {
+		login().AssertSuccess()
+
+		cache := readCache()
+		Expect(cache).To(HaveKey(cacheKey()))
+		cached := cache[cacheKey()]
+		Expect(cached.Endpoint).To(Equal(apiServerURL))
+		Expect(cached.APIServerURL).To(Equal(apiServerURL))
+		Expect(cached.CertificateAuthorityData).To(Equal(base64.StdEncoding.EncodeToString([]byte(apiservertest.CaCert1Pem))))
+	})
+
+	It("uses the cached cluster details when the discovery endpoint is down", func() {
+		login().AssertSuccess()
+		apiTestServer.SetUnavailable(true)
+
+		login := login()
+		// the login waits for the background refresh of the cached details to give up
+		login.EventuallyAssertSuccess(15*time.Second, 100*time.Millisecond)
+		Expect(login.GetOutput()).To(ContainSubstring("Using the cluster details of " + OspreyconfigTargetName("local") + " cached on"))
+		Expect(login.GetOutput()).To(ContainSubstring("503 Service Unavailable"))
+
+		Expect(kubeconfig.LoadConfig(ospreyconfig.Kubeconfig)).To(Succeed())
+		generatedConfig, err := kubeconfig.GetConfig()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(generatedConfig.Clusters[OspreyconfigTargetName("local")].CertificateAuthorityData).To(Equal([]byte(apiservertest.CaCert1Pem)))
+	})
+
+	It("refreshes the cached cluster details in the background once the discovery endpoint is back", func() {
+		login().AssertSuccess()
+		cache := readCache()
+		cache[cacheKey()].Discovered = time.Now().Add(-time.Hour)
+		writeCache(cache)
+		apiTestServer.SetUnavailable(true)
+
+		login := login()
+		Eventually(login.GetOutput, 10*time.Second).Should(ContainSubstring("while they are refreshed"))
+		apiTestServer.SetUnavailable(false)
+		login.EventuallyAssertSuccess(15*time.Second, 100*time.Millisecond)
+		Expect(login.GetOutput()).To(ContainSubstring("Refreshed the cached cluster details of " + OspreyconfigTargetName("local")))
+		Expect(readCache()[cacheKey()].Discovered).To(BeTemporally(">", time.Now().Add(-time.Minute)))
+	})
+
+	It("gives up refreshing the cached cluster details while the discovery endpoint is down", func() {
+		login().AssertSuccess()
+		apiTestServer.SetUnavailable(true)
+
+		login := login()
+		login.EventuallyAssertSuccess(15*time.Second, 100*time.Millisecond)
+		Expect(login.GetOutput()).To(ContainSubstring("Failed to refresh the cached cluster details of " + OspreyconfigTargetName("local")))
+	})
+
+	It("fails when the discovery endpoint is down and nothing is cached", func() {
+		apiTestServer.SetUnavailable(true)
+
+		login := login()
+		login.AssertFailure()
+		Expect(login.GetOutput()).To(ContainSubstring("503 Service Unavailable"))
+	})
+
+	It("does not use expired cluster details", func() {
+		ospreyconfig.ClusterCacheTTL = "1s"
+		Expect(SaveConfig(ospreyconfig.Config, ospreyconfig.ConfigFile)).To(Succeed())
+		login().AssertSuccess()
+		time.Sleep(2 * time.Second)
+		apiTestServer.SetUnavailable(true)
+
+		login := login()
+		login.AssertFailure()
+		Expect(login.GetOutput()).NotTo(ContainSubstring("Using the cluster details"))
+	})
+
+	It("warns when the discovered CA differs from the cached one", func() {
+		login().AssertSuccess()
+		cache := readCache()
+		cache[cacheKey()].CertificateAuthorityData = base64.StdEncoding.EncodeToString([]byte(apiservertest.CaCert2Pem))
+		writeCache(cache)
+
+		login := login()
+		login.AssertSuccess()
+		Expect(login.GetOutput()).To(ContainSubstring("changed since it was cached"))
+		Expect(readCache()[cacheKey()].CertificateAuthorityData).
+			To(Equal(base64.StdEncoding.EncodeToString([]byte(apiservertest.CaCert1Pem))))
+	})
+	It("uses and migrates the cluster details cached by target name", func() {
+		login().AssertSuccess()
+		cache := readCache()
+		writeCache(map[string]*client.CachedCluster{OspreyconfigTargetName("local"): cache[cacheKey()]})
+		apiTestServer.SetUnavailable(true)
+
+		login().EventuallyAssertSuccess(15*time.Second, 100*time.Millisecond)
+		apiTestServer.SetUnavailable(false)
+		login().AssertSuccess()
+
+		cache = readCache()
+		Expect(cache).To(HaveKey(cacheKey()))
+		Expect(cache).NotTo(HaveKey(OspreyconfigTargetName("local")))
+	})
+})
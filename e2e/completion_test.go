@@ -0,0 +1,93 @@
+package e2e
+
+import (
+	"fmt"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/sky-uk/osprey/v2/client/kubeconfig"
+	. "github.com/sky-uk/osprey/v2/e2e/ospreytest"
+)
+
+var _ = Describe("Completion", func() {
+	BeforeEach(func() {
+		resetDefaults()
+	})
+
+	JustBeforeEach(func() {
+		setupClientForEnvironments(ospreyProviderName, environmentsToUse, "", "", false)
+	})
+
+	AfterEach(func() {
+		cleanup()
+	})
+
+	It("generates the completion scripts", func() {
+		for _, shell := range []string{"bash", "zsh", "fish"} {
+			completion := Client("completion", shell)
+			completion.RunAndAssertSuccess()
+
+			Expect(completion.GetStdout()).To(ContainSubstring("osprey"), shell)
+		}
+	})
+
+	It("completes the targets and their aliases", func() {
+		complete := Client("__complete", "user", "login", ospreyconfigFlag, "--target", "")
+		complete.RunAndAssertSuccess()
+
+		for environment, groups := range environmentsToUse {
+			target := OspreyconfigTargetName(environment)
+			description := ospreyProviderName + ":provider-0"
+			if len(groups) > 0 {
+				description = fmt.Sprintf("%s, groups: %s", description, groups[0])
+			}
+			Expect(complete.GetStdout()).To(ContainSubstring("%s\t%s\n", target, description))
+			Expect(complete.GetStdout()).To(ContainSubstring("%s\talias of %s\n", OspreyconfigAliasName(environment), target))
+		}
+	})
+
+	It("completes the last group of a list", func() {
+		complete := Client("__complete", "config", "targets", ospreyconfigFlag, "--group", "development,pro")
+		complete.RunAndAssertSuccess()
+
+		Expect(complete.GetStdout()).To(HavePrefix("development,production\ttargets: 1\n:4\n"))
+	})
+
+	It("completes the arguments of use", func() {
+		complete := Client("__complete", "use", ospreyconfigFlag, "alias.")
+		complete.RunAndAssertSuccess()
+
+		Expect(complete.GetStdout()).To(ContainSubstring("%s\talias of %s\n", OspreyconfigAliasName("dev"), OspreyconfigTargetName("dev")))
+		Expect(complete.GetStdout()).ToNot(ContainSubstring("%s\t", OspreyconfigTargetName("dev")))
+	})
+
+	Context("use", func() {
+		It("switches the current context to a target alias", func() {
+			login := Client("user", "login", ospreyconfigFlag, "--username=jane", "--password=foo")
+			login.RunAndAssertSuccess()
+
+			use := Client("use", ospreyconfigFlag, OspreyconfigAliasName("local"))
+			use.RunAndAssertSuccess()
+
+			err := kubeconfig.LoadConfig(ospreyconfig.Kubeconfig)
+			Expect(err).To(BeNil(), "successfully loads the kubeconfig")
+			generatedConfig, err := kubeconfig.GetConfig()
+			Expect(err).To(BeNil(), "successfully loads the kubeconfig")
+			Expect(generatedConfig.CurrentContext).To(Equal(OspreyconfigAliasName("local")))
+		})
+
+		It("fails for targets the user has not logged in to", func() {
+			use := Client("use", ospreyconfigFlag, OspreyconfigTargetName("prod"))
+			use.RunAndAssertFailure()
+
+			Expect(use.GetOutput()).To(ContainSubstring("log in to it first"))
+		})
+
+		It("fails for unknown targets", func() {
+			use := Client("use", ospreyconfigFlag, "non-existent")
+			use.RunAndAssertFailure()
+
+			Expect(use.GetOutput()).To(ContainSubstring(`Target not found: "non-existent"`))
+		})
+	})
+})
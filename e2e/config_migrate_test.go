@@ -0,0 +1,130 @@
+package e2e
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/sky-uk/osprey/v2/client"
+	"github.com/sky-uk/osprey/v2/e2e/clitest"
+	. "github.com/sky-uk/osprey/v2/e2e/ospreytest"
+)
+
+var _ = Describe("Config migrate", func() {
+	var migrate clitest.TestCommand
+
+	BeforeEach(func() {
+		resetDefaults()
+		environmentsToUse = map[string][]string{
+			"dev":   {"development"},
+			"stage": {"development"},
+			"prod":  {"production"},
+		}
+		defaultGroup = "development"
+	})
+
+	AfterEach(func() {
+		cleanup()
+	})
+
+	AssertMigratesTo := func(configFile func() string, version string) {
+		JustBeforeEach(func() {
+			migrate = Client("config", "migrate", "--ospreyconfig="+configFile())
+		})
+
+		It("warns that the format is deprecated when loading it", func() {
+			targets := Client("config", "targets", "--ospreyconfig="+configFile())
+			targets.RunAndAssertSuccess()
+
+			Expect(targets.GetOutput()).To(ContainSubstring("uses the deprecated %s config format", version))
+		})
+
+		It("rewrites the file in the v3 format keeping a backup", func() {
+			original, err := os.ReadFile(configFile())
+			Expect(err).NotTo(HaveOccurred())
+
+			migrate.RunAndAssertSuccess()
+
+			backup, err := os.ReadFile(configFile() + ".bak")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(backup).To(Equal(original))
+
+			migrated, migratedVersion, err := client.ReadConfig(configFile())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(migratedVersion).To(Equal(client.ConfigVersionV3))
+			Expect(migrated.DefaultGroup).To(Equal("development"))
+			Expect(migrated.Providers).To(HaveLen(1))
+			Expect(migrated.Providers[0].Type).To(Equal(client.OspreyProviderName))
+			for _, osprey := range targetedOspreys {
+				target := migrated.Providers[0].Targets[osprey.OspreyconfigTargetName()]
+				Expect(target).NotTo(BeNil())
+				Expect(target.Aliases).To(ConsistOf(osprey.OspreyconfigAliasName()))
+				Expect(target.Groups).To(ConsistOf("development"))
+				Expect(target.CertificateAuthority).To(Equal(osprey.CertFile))
+			}
+		})
+
+		It("no longer warns after migrating", func() {
+			migrate.RunAndAssertSuccess()
+
+			targets := Client("config", "targets", "--ospreyconfig="+configFile())
+			targets.RunAndAssertSuccess()
+
+			Expect(targets.GetOutput()).NotTo(ContainSubstring("deprecated"))
+		})
+	}
+
+	JustBeforeEach(func() {
+		setupClientForEnvironments(ospreyProviderName, environmentsToUse, "", "", false)
+	})
+
+	Context("v1 config", func() {
+		AssertMigratesTo(func() string { return ospreyconfig.LegacyConfigFile }, "v1")
+	})
+
+	Context("v2 config", func() {
+		AssertMigratesTo(func() string { return ospreyconfig.V2ConfigFile }, "v2")
+	})
+
+	Context("unnamed providers", func() {
+		It("are numbered among the providers of their type, as in the v1 and v2 formats", func() {
+			config := fmt.Sprintf(`apiVersion: v3
+kubeconfig: %s
+providers:
+  - type: azure
+    azure:
+      tenant-id: some-tenant-id
+      server-application-id: some-server-application-id
+      client-id: some-client-id
+      client-secret: some-client-secret
+      redirect-uri: http://localhost:65525/auth/callback
+    targets:
+      azure.cluster:
+        api-server: https://azure.cluster
+  - type: osprey
+    targets:
+      osprey.cluster:
+        server: https://osprey.cluster
+`, ospreyconfig.Kubeconfig)
+			configFile := filepath.Join(testDir, "unnamed-providers-config")
+			Expect(os.WriteFile(configFile, []byte(config), 0644)).To(Succeed())
+
+			targets := Client("config", "targets", "--ospreyconfig="+configFile, "--output=json")
+			targets.RunAndAssertSuccess()
+			Expect(targets.GetStdout()).To(ContainSubstring(`"provider": "azure:provider-0"`))
+			Expect(targets.GetStdout()).To(ContainSubstring(`"provider": "osprey:provider-0"`))
+		})
+	})
+
+	Context("v3 config", func() {
+		It("leaves the file untouched", func() {
+			migrate = Client("config", "migrate", ospreyconfigFlag)
+			migrate.RunAndAssertSuccess()
+
+			Expect(migrate.GetOutput()).To(ContainSubstring("already in the v3 format"))
+			Expect(ospreyconfig.ConfigFile + ".bak").NotTo(BeAnExistingFile())
+		})
+	})
+})
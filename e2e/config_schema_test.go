@@ -0,0 +1,40 @@
+package e2e
+
+import (
+	"encoding/json"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/sky-uk/osprey/v2/e2e/ospreytest"
+)
+
+var _ = Describe("Config schema", func() {
+	It("discriminates the providers by their type", func() {
+		schema := Client("config", "schema")
+		schema.RunAndAssertSuccess()
+
+		var config struct {
+			Properties struct {
+				Providers struct {
+					Items struct {
+						OneOf []struct {
+							Properties map[string]interface{} `json:"properties"`
+							Required   []string               `json:"required"`
+						} `json:"oneOf"`
+					} `json:"items"`
+				} `json:"providers"`
+			} `json:"properties"`
+		}
+		Expect(json.Unmarshal([]byte(schema.GetStdout()), &config)).To(Succeed())
+		providers := config.Properties.Providers.Items.OneOf
+		Expect(providers).To(HaveLen(2))
+
+		Expect(providers[0].Properties["type"]).To(Equal(map[string]interface{}{"const": "azure"}))
+		Expect(providers[0].Properties["osprey"]).To(BeFalse())
+		Expect(providers[0].Required).To(ConsistOf("type", "azure"))
+
+		Expect(providers[1].Properties["type"]).To(Equal(map[string]interface{}{"const": "osprey"}))
+		Expect(providers[1].Properties["azure"]).To(BeFalse())
+		Expect(providers[1].Required).To(ConsistOf("type"))
+	})
+})
@@ -0,0 +1,78 @@
+package e2e
+
+import (
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/sky-uk/osprey/v2/e2e/oidctest"
+)
+
+var _ = Describe("Device-code flow", func() {
+	var userLoginArgs []string
+
+	BeforeEach(func() {
+		resetDefaults()
+		apiServerURL = fmt.Sprintf("http://localhost:%d", apiServerPort)
+		userLoginArgs = []string{"user", "login", ospreyconfigFlag, "--use-device-code"}
+	})
+
+	AfterEach(func() {
+		oidcTestServer.Reset()
+		apiTestServer.Reset()
+		cleanup()
+	})
+
+	setup := func(clientID string) {
+		setupClientForEnvironments(azureProviderName, environmentsToUse, clientID, apiServerURL, useGKEClientConfig)
+	}
+
+	It("logs in through the device authorization endpoint of the well-known config", func() {
+		setup("good_client_id")
+		login := loginCommand(ospreyBinary, userLoginArgs...)
+		login.EventuallyAssertSuccess(10*time.Second, time.Second)
+
+		Expect(oidcTestServer.RequestCount(oidctest.DeviceAuthorizationPath)).To(Equal(1))
+		verificationURI := fmt.Sprintf("http://localhost:%d/device?user_code=%s", oidcPort, oidctest.DeviceUserCode)
+		Expect(login.GetOutput()).To(ContainSubstring(
+			fmt.Sprintf("To sign in, open %s and check that it shows the code %s.", verificationURI, oidctest.DeviceUserCode)))
+	})
+
+	It("shows a QR code of the verification URL", func() {
+		setup("good_client_id")
+		login := loginCommand(ospreyBinary, userLoginArgs...)
+		login.EventuallyAssertSuccess(10*time.Second, time.Second)
+
+		Expect(login.GetOutput()).To(MatchRegexp("(?m)^[█▀▄ ]{25,}$"))
+	})
+
+	It("fails to log in when the user denies the login", func() {
+		setup("access_denied_client_id")
+		login := loginCommand(ospreyBinary, userLoginArgs...)
+		Eventually(login.Error, 10*time.Second).Should(HaveOccurred())
+		login.AssertFailure()
+
+		Expect(login.GetOutput()).To(ContainSubstring("failed to fetch device-flow token: the login was denied"))
+	})
+
+	It("fails to log in when the device code expires", func() {
+		setup("expired_client_id")
+		login := loginCommand(ospreyBinary, userLoginArgs...)
+		Eventually(login.Error, 10*time.Second).Should(HaveOccurred())
+		login.AssertFailure()
+
+		Expect(login.GetOutput()).To(ContainSubstring("the device code expired before the login was completed"))
+	})
+
+	It("fails to log in when the issuer has no device authorization endpoint", func() {
+		oidcTestServer.SetDeviceFlow(false)
+		setup("good_client_id")
+		login := loginCommand(ospreyBinary, userLoginArgs...)
+		Eventually(login.Error, 10*time.Second).Should(HaveOccurred())
+		login.AssertFailure()
+
+		Expect(login.GetOutput()).To(ContainSubstring("the issuer has no device_authorization_endpoint"))
+		Expect(oidcTestServer.RequestCount(oidctest.DeviceAuthorizationPath)).To(Equal(0))
+	})
+})
@@ -0,0 +1,92 @@
+package e2e
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/onsi/gomega/gstruct"
+	. "github.com/sky-uk/osprey/v2/e2e/ospreytest"
+)
+
+var _ = Describe("Doctor", func() {
+	BeforeEach(func() {
+		resetDefaults()
+	})
+
+	JustBeforeEach(func() {
+		setupClientForEnvironments(ospreyProviderName, environmentsToUse, "", "", false)
+	})
+
+	AfterEach(func() {
+		cleanup()
+	})
+
+	It("passes all the checks for healthy targets", func() {
+		doctor := Client("doctor", ospreyconfigFlag, "--all")
+		doctor.RunAndAssertSuccess()
+
+		output := doctor.GetStdout()
+		for _, check := range []string{"writable", "dns", "tcp", "tls", "healthz", "clock"} {
+			Expect(output).To(MatchRegexp(`\[ok\]\s+%s\s`, check))
+		}
+		Expect(output).ToNot(ContainSubstring("[failed]"))
+		Expect(output).ToNot(ContainSubstring("Hints:"))
+	})
+
+	It("checks the issuer of logged in targets", func() {
+		login := Client("user", "login", ospreyconfigFlag, "--username=jane", "--password=foo")
+		login.RunAndAssertSuccess()
+
+		doctor := Client("doctor", ospreyconfigFlag, "--output=json")
+		doctor.RunAndAssertSuccess()
+
+		var result struct {
+			Targets []struct {
+				Name   string `json:"name"`
+				Checks []struct {
+					Check  string `json:"check"`
+					Status string `json:"status"`
+				} `json:"checks"`
+			} `json:"targets"`
+			Success bool `json:"success"`
+		}
+		Expect(json.Unmarshal([]byte(doctor.GetStdout()), &result)).To(Succeed(), doctor.GetStdout())
+		Expect(result.Success).To(BeTrue())
+		Expect(result.Targets).To(HaveLen(len(targetedOspreys)))
+		for _, target := range result.Targets {
+			Expect(target.Checks).To(ContainElement(MatchFields(IgnoreExtras, Fields{"Check": Equal("issuer"), "Status": Equal("ok")})))
+		}
+	})
+
+	It("fails with hints for unreachable or untrusted targets", func() {
+		config := fmt.Sprintf(`apiVersion: v3
+kubeconfig: %s
+providers:
+  - type: osprey
+    targets:
+      untrusted:
+        server: %s
+      unresolvable:
+        server: https://osprey.invalid
+      closed:
+        server: https://localhost:1
+`, ospreyconfig.Kubeconfig, ospreys[0].URL)
+		configFile := filepath.Join(testDir, "doctor-config")
+		Expect(ioutil.WriteFile(configFile, []byte(config), 0644)).To(Succeed())
+
+		doctor := Client("doctor", "--ospreyconfig="+configFile, "--all")
+		doctor.RunAndAssertFailure()
+
+		output := doctor.GetStdout()
+		Expect(output).To(MatchRegexp(`\[failed\]\s+tls\s+.*unknown authority`))
+		Expect(output).To(MatchRegexp(`\[failed\]\s+dns\s`))
+		Expect(output).To(MatchRegexp(`\[failed\]\s+tcp\s`))
+		Expect(output).To(ContainSubstring("untrusted tls: the server's certificate is not signed by the configured CA (system)"))
+		Expect(output).To(ContainSubstring("unresolvable dns: check the host name of the target"))
+		Expect(output).To(ContainSubstring("closed tcp: check that the server is up"))
+	})
+})
@@ -3,6 +3,7 @@ package e2e
 import (
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/sky-uk/osprey/v2/e2e/apiservertest"
@@ -142,5 +143,56 @@ func cleanup() {
 		if err := os.Remove(ospreyconfig.LegacyConfig.Kubeconfig); err != nil {
 			Expect(os.IsNotExist(err)).To(BeTrue())
 		}
+		if err := os.Remove(ospreyconfig.V2Config.Kubeconfig); err != nil {
+			Expect(os.IsNotExist(err)).To(BeTrue())
+		}
+		forgetKnownCAs()
+		clearClusterCache()
+		clearGroupsCache()
+		forgetAccounts()
+	}
+}
+
+// knownCAsFile is the default file of the API server CAs trusted on first use, next to the ospreyconfig file
+func knownCAsFile() string {
+	return filepath.Join(filepath.Dir(ospreyconfig.ConfigFile), "known_cas")
+}
+
+// clusterCacheFile is the default file of the cached cluster details, next to the ospreyconfig file
+func clusterCacheFile() string {
+	return filepath.Join(filepath.Dir(ospreyconfig.ConfigFile), "cluster_cache")
+}
+
+func clearClusterCache() {
+	if err := os.Remove(clusterCacheFile()); err != nil {
+		Expect(os.IsNotExist(err)).To(BeTrue())
+	}
+}
+
+// groupsCacheFile is the default file of the groups resolved on login, next to the ospreyconfig file
+func groupsCacheFile() string {
+	return filepath.Join(filepath.Dir(ospreyconfig.ConfigFile), "groups_cache")
+}
+
+func clearGroupsCache() {
+	if err := os.Remove(groupsCacheFile()); err != nil {
+		Expect(os.IsNotExist(err)).To(BeTrue())
+	}
+}
+
+// accountsFile is the default file of the accounts last logged in with, next to the ospreyconfig file
+func accountsFile() string {
+	return filepath.Join(filepath.Dir(ospreyconfig.ConfigFile), "accounts")
+}
+
+func forgetAccounts() {
+	if err := os.Remove(accountsFile()); err != nil {
+		Expect(os.IsNotExist(err)).To(BeTrue())
+	}
+}
+
+func forgetKnownCAs() {
+	if err := os.Remove(knownCAsFile()); err != nil {
+		Expect(os.IsNotExist(err)).To(BeTrue())
 	}
 }
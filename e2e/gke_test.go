@@ -0,0 +1,190 @@
+package e2e
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/SermoDigital/jose/jws"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/sky-uk/osprey/v2/client"
+	"github.com/sky-uk/osprey/v2/client/kubeconfig"
+	"github.com/sky-uk/osprey/v2/e2e/apiservertest"
+	"github.com/sky-uk/osprey/v2/e2e/oidctest"
+	. "github.com/sky-uk/osprey/v2/e2e/ospreytest"
+)
+
+var _ = Describe("GKE ClientConfig authentication", func() {
+	const clientConfigPath = "/apis/authentication.gke.io/v2alpha1/namespaces/kube-public/clientconfigs/default"
+	var userLoginArgs []string
+
+	BeforeEach(func() {
+		resetDefaults()
+		apiServerURL = fmt.Sprintf("http://localhost:%d", apiServerPort)
+		setupClientForEnvironments(azureProviderName, environmentsToUse, oidcClientID, apiServerURL, true)
+		userLoginArgs = []string{"user", "login", ospreyconfigFlag, "--disable-browser-popup"}
+	})
+
+	AfterEach(func() {
+		oidcTestServer.Reset()
+		apiTestServer.Reset()
+		forgetKnownCAs()
+		clearClusterCache()
+		cleanup()
+	})
+
+	// configure removes the oidc settings of the provider, leaving only the api-server on the targets
+	configure := func(configureTarget func(target *client.TargetEntry)) {
+		ospreyconfig.Providers[0].Azure = &client.AzureOptions{}
+		for _, target := range ospreyconfig.Providers[0].Targets {
+			configureTarget(target)
+		}
+		Expect(SaveConfig(ospreyconfig.Config, ospreyconfig.ConfigFile)).To(Succeed())
+	}
+
+	assertLoggedIn := func() {
+		Expect(kubeconfig.LoadConfig(ospreyconfig.Kubeconfig)).To(Succeed())
+		generatedConfig, err := kubeconfig.GetConfig()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(generatedConfig.Clusters[OspreyconfigTargetName("local")].Server).To(Equal(apiservertest.InternalAPIServerURL))
+		Expect(generatedConfig.AuthInfos[OspreyconfigTargetName("local")].Token).NotTo(BeEmpty())
+	}
+
+	writtenTokenAudience := func() interface{} {
+		Expect(kubeconfig.LoadConfig(ospreyconfig.Kubeconfig)).To(Succeed())
+		generatedConfig, err := kubeconfig.GetConfig()
+		Expect(err).NotTo(HaveOccurred())
+		jwt, err := jws.ParseJWT([]byte(generatedConfig.AuthInfos[OspreyconfigTargetName("local")].Token))
+		Expect(err).NotTo(HaveOccurred())
+		return jwt.Claims().Get("aud")
+	}
+
+	loginWithClientConfig := func() {
+		login := loginCommand(ospreyBinary, userLoginArgs...)
+		_, err := doOIDCMockRequest("/v2.0/authorize", apiservertest.GKEClientID, apiservertest.GKERedirectURI, []string{"openid", "email"})
+		Expect(err).NotTo(HaveOccurred())
+		login.AssertSuccess()
+	}
+
+	It("logs in with the first oidc authentication of the ClientConfig", func() {
+		configure(func(target *client.TargetEntry) {})
+
+		login := loginCommand(ospreyBinary, userLoginArgs...)
+		_, err := doOIDCMockRequest("/v2.0/authorize", apiservertest.GKEClientID, apiservertest.GKERedirectURI, []string{"openid", "email"})
+		Expect(err).NotTo(HaveOccurred())
+
+		login.AssertSuccess()
+		Expect(apiTestServer.RequestCount(clientConfigPath)).To(Equal(1))
+		Expect(oidcTestServer.RequestCount("/v2.0/authorize")).To(Equal(1))
+		assertLoggedIn()
+		Expect(writtenTokenAudience()).To(Equal(apiservertest.GKEClientID), "writes the id token of the ClientConfig's client")
+	})
+
+	It("refuses the access tokens of the ClientConfig's scopes, which are for Microsoft Graph", func() {
+		configure(func(target *client.TargetEntry) {})
+		ospreyconfig.Providers[0].TokenType = client.AccessTokenType
+		Expect(SaveConfig(ospreyconfig.Config, ospreyconfig.ConfigFile)).To(Succeed())
+
+		login := loginCommand(ospreyBinary, userLoginArgs...)
+		_, err := doOIDCMockRequest("/v2.0/authorize", apiservertest.GKEClientID, apiservertest.GKERedirectURI, []string{"openid", "email"})
+		Expect(err).NotTo(HaveOccurred())
+
+		login.AssertFailure()
+		Expect(login.GetOutput()).To(ContainSubstring(`the token is for the audience "%s" instead of the client id of the GKE ClientConfig "%s"`,
+			oidctest.GraphAudience, apiservertest.GKEClientID))
+	})
+
+	It("trusts the CA of the ClientConfig before logging in with its settings", func() {
+		configure(func(target *client.TargetEntry) {})
+		loginWithClientConfig()
+
+		fingerprint1, err := client.CAFingerprint([]byte(apiservertest.CaCert1Pem))
+		Expect(err).NotTo(HaveOccurred())
+		fingerprint2, err := client.CAFingerprint([]byte(apiservertest.CaCert2Pem))
+		Expect(err).NotTo(HaveOccurred())
+		knownCAs, err := ioutil.ReadFile(knownCAsFile())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(knownCAs)).To(ContainSubstring(fingerprint2))
+		err = ioutil.WriteFile(knownCAsFile(), []byte(strings.Replace(string(knownCAs), fingerprint2, fingerprint1, -1)), 0600)
+		Expect(err).NotTo(HaveOccurred())
+
+		login := Client(userLoginArgs...)
+		login.RunAndAssertFailure()
+		Expect(login.GetOutput()).To(ContainSubstring(fmt.Sprintf("changed from %s to %s", fingerprint1, fingerprint2)))
+		Expect(oidcTestServer.RequestCount("/v2.0/authorize")).To(Equal(1), "does not log in with the untrusted ClientConfig")
+	})
+
+	It("logs in with the oidc authentication chosen by the target", func() {
+		configure(func(target *client.TargetEntry) {
+			target.GKEAuthentication = apiservertest.GKEAdminAuthentication
+		})
+
+		login := loginCommand(ospreyBinary, userLoginArgs...)
+		_, err := doOIDCMockRequest("/v2.0/authorize", "gke-admin-client-id", apiservertest.GKEAdminRedirectURI, []string{"openid"})
+		Expect(err).NotTo(HaveOccurred())
+
+		login.AssertSuccess()
+		assertLoggedIn()
+	})
+
+	It("fails when the target chooses an authentication the ClientConfig doesn't have", func() {
+		configure(func(target *client.TargetEntry) {
+			target.GKEAuthentication = "missing"
+		})
+
+		login := Client(userLoginArgs...)
+		login.RunAndAssertFailure()
+		Expect(login.GetOutput()).To(ContainSubstring("the GKE ClientConfig has no authentication named missing, it has ldap, azure-ad, azure-ad-admin"))
+	})
+
+	It("fails when the target chooses an authentication that is not an oidc one", func() {
+		configure(func(target *client.TargetEntry) {
+			target.GKEAuthentication = "ldap"
+		})
+
+		login := Client(userLoginArgs...)
+		login.RunAndAssertFailure()
+		Expect(login.GetOutput()).To(ContainSubstring("the authentication ldap of the GKE ClientConfig is not an oidc one"))
+	})
+
+	It("fails when neither the provider nor the unavailable ClientConfig configure the login", func() {
+		configure(func(target *client.TargetEntry) {})
+		apiTestServer.SetUnavailable(true)
+
+		login := Client(userLoginArgs...)
+		login.RunAndAssertFailure()
+		Expect(login.GetOutput()).To(ContainSubstring("unable to configure the oidc login from the GKE ClientConfig"))
+	})
+
+	It("requires the provider's oidc settings for targets that don't use the ClientConfig", func() {
+		configure(func(target *client.TargetEntry) {
+			target.UseGKEClientConfig = false
+		})
+
+		login := Client(userLoginArgs...)
+		login.RunAndAssertFailure()
+		Expect(login.GetOutput()).To(ContainSubstring("tenant-id is required for azure targets"))
+	})
+
+	It("requires use-gke-clientconfig to choose an authentication", func() {
+		configure(func(target *client.TargetEntry) {
+			target.UseGKEClientConfig = false
+			target.GKEAuthentication = apiservertest.GKEAdminAuthentication
+		})
+		ospreyconfig.Providers[0].Azure = &client.AzureOptions{
+			ClientID:            oidcClientID,
+			ClientSecret:        "some-client-secret",
+			RedirectURI:         oidcRedirectURI,
+			AzureTenantID:       "some-tenant-id",
+			ServerApplicationID: oidctest.ServerApplicationID,
+			IssuerURL:           fmt.Sprintf("http://localhost:%d", oidcPort),
+		}
+		Expect(SaveConfig(ospreyconfig.Config, ospreyconfig.ConfigFile)).To(Succeed())
+
+		login := Client(userLoginArgs...)
+		login.RunAndAssertFailure()
+		Expect(login.GetOutput()).To(ContainSubstring("gke-authentication requires use-gke-clientconfig:true"))
+	})
+})
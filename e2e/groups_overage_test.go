@@ -0,0 +1,103 @@
+package e2e
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/sky-uk/osprey/v2/client"
+	"github.com/sky-uk/osprey/v2/e2e/clitest"
+	"github.com/sky-uk/osprey/v2/e2e/oidctest"
+	. "github.com/sky-uk/osprey/v2/e2e/ospreytest"
+	"gopkg.in/yaml.v2"
+)
+
+var _ = Describe("Groups overage", func() {
+	var userLoginArgs []string
+
+	BeforeEach(func() {
+		resetDefaults()
+		apiServerURL = fmt.Sprintf("http://localhost:%d", apiServerPort)
+		setupClientForEnvironments(azureProviderName, environmentsToUse, oidcClientID, apiServerURL, useGKEClientConfig)
+		userLoginArgs = []string{"user", "login", ospreyconfigFlag, "--disable-browser-popup"}
+		oidcTestServer.SetGroupsOverage(true)
+	})
+
+	AfterEach(func() {
+		oidcTestServer.Reset()
+		apiTestServer.Reset()
+		cleanup()
+	})
+
+	login := func() clitest.AsyncTestCommand {
+		login := loginCommand(ospreyBinary, userLoginArgs...)
+		_, err := doOIDCMockRequest("/v2.0/authorize", oidcClientID, oidcRedirectURI, []string{"api://some-dummy-scope"})
+		Expect(err).NotTo(HaveOccurred())
+		return login
+	}
+
+	setGroupsOverageURL := func(url string) {
+		ospreyconfig.Providers[0].Azure.GroupsOverageURL = url
+		Expect(SaveConfig(ospreyconfig.Config, ospreyconfig.ConfigFile)).To(Succeed())
+	}
+
+	cacheKey := func() string {
+		return fmt.Sprintf("%s:provider-0/%s", azureProviderName, OspreyconfigTargetName("local"))
+	}
+
+	readCache := func() map[string]*client.CachedGroups {
+		data, err := ioutil.ReadFile(groupsCacheFile())
+		Expect(err).NotTo(HaveOccurred())
+		cache := map[string]*client.CachedGroups{}
+		Expect(yaml.Unmarshal(data, &cache)).To(Succeed())
+		return cache
+	}
+
+	It("resolves the groups from the endpoint of the token's claim sources with a token for its audience", func() {
+		login().AssertSuccess()
+
+		Expect(oidcTestServer.RequestCount(oidctest.MemberObjectsPath)).To(Equal(1))
+		cache := readCache()
+		Expect(cache).To(HaveKey(cacheKey()))
+		Expect(cache[cacheKey()].User).To(Equal("john.doe@osprey.org"))
+		Expect(cache[cacheKey()].Groups).To(Equal(oidctest.OverageGroups))
+	})
+
+	It("resolves the groups from the pages of the groups-overage-url", func() {
+		setGroupsOverageURL(fmt.Sprintf("http://localhost:%d%s", oidcPort, oidctest.MemberOfPath))
+
+		login().AssertSuccess()
+
+		Expect(oidcTestServer.RequestCount(oidctest.MemberObjectsPath)).To(Equal(0))
+		Expect(oidcTestServer.RequestCount(oidctest.MemberOfPath)).To(Equal(2))
+		Expect(readCache()[cacheKey()].Groups).To(Equal(oidctest.OverageGroups))
+	})
+
+	It("shows the resolved groups in osprey user", func() {
+		login().AssertSuccess()
+
+		user := Client("user", ospreyconfigFlag, "--output=json")
+		user.RunAndAssertSuccess()
+		for _, group := range oidctest.OverageGroups {
+			Expect(user.GetStdout()).To(ContainSubstring(group))
+		}
+	})
+
+	It("logs in with a warning when the groups can't be resolved", func() {
+		setGroupsOverageURL(fmt.Sprintf("http://localhost:%d/v1.0/not-found", oidcPort))
+
+		login := login()
+		login.AssertSuccess()
+		Expect(login.GetOutput()).To(ContainSubstring("Unable to resolve the groups of john.doe@osprey.org"))
+		Expect(login.GetOutput()).To(ContainSubstring("404 Not Found"))
+	})
+	It("warns when the issuer returns no refresh token to get a token for the groups endpoint", func() {
+		oidcTestServer.SetRefreshTokens(false)
+
+		login := login()
+		login.AssertSuccess()
+		Expect(oidcTestServer.RequestCount(oidctest.MemberObjectsPath)).To(Equal(0))
+		Expect(login.GetOutput()).To(ContainSubstring("add the offline_access scope to the provider"))
+	})
+})
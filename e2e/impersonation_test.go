@@ -0,0 +1,92 @@
+package e2e
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/sky-uk/osprey/v2/client"
+	"github.com/sky-uk/osprey/v2/client/kubeconfig"
+	. "github.com/sky-uk/osprey/v2/e2e/ospreytest"
+	clientgo "k8s.io/client-go/tools/clientcmd/api"
+)
+
+var _ = Describe("Impersonation", func() {
+	var target, alias string
+
+	BeforeEach(func() {
+		resetDefaults()
+		target = OspreyconfigTargetName("local")
+		alias = OspreyconfigAliasName("local")
+	})
+
+	JustBeforeEach(func() {
+		setupClientForEnvironments(ospreyProviderName, environmentsToUse, "", "", false)
+		targetEntry := ospreyconfig.Providers[0].Targets[target]
+		targetEntry.ImpersonateUser = "jane"
+		targetEntry.ImpersonateGroups = []string{"viewers"}
+		targetEntry.ImpersonateUID = "42"
+		ospreyconfig.Providers[0].Profiles = []*client.ProfileEntry{
+			{Name: "admin", Username: "jane", ImpersonateUser: "jane", ImpersonateGroups: []string{"cluster-admins"}},
+		}
+		Expect(SaveConfig(ospreyconfig.Config, ospreyconfig.ConfigFile)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		cleanup()
+	})
+
+	loadKubeconfig := func() *clientgo.Config {
+		Expect(kubeconfig.LoadConfig(ospreyconfig.Kubeconfig)).To(Succeed())
+		generatedConfig, err := kubeconfig.GetConfig()
+		Expect(err).NotTo(HaveOccurred())
+		return generatedConfig
+	}
+
+	It("writes an elevated user and context that impersonate the target's identity", func() {
+		login := Client("user", "login", ospreyconfigFlag, "--target="+target, "--username=jane", "--password=foo")
+		login.RunAndAssertSuccess()
+		Expect(login.GetOutput()).To(ContainSubstring("Elevated context: %s-elevated", target))
+
+		generatedConfig := loadKubeconfig()
+		Expect(generatedConfig.AuthInfos[target].Impersonate).To(BeEmpty())
+		elevatedUser := generatedConfig.AuthInfos[target+"-elevated"]
+		Expect(elevatedUser).NotTo(BeNil())
+		Expect(elevatedUser.Impersonate).To(Equal("jane"))
+		Expect(elevatedUser.ImpersonateGroups).To(Equal([]string{"viewers"}))
+		Expect(elevatedUser.ImpersonateUID).To(Equal("42"))
+		Expect(elevatedUser.AuthProvider).To(Equal(generatedConfig.AuthInfos[target].AuthProvider))
+		Expect(generatedConfig.Contexts[target+"-elevated"].AuthInfo).To(Equal(target + "-elevated"))
+		Expect(generatedConfig.Contexts[target+"-elevated"].Cluster).To(Equal(target))
+	})
+
+	It("impersonates the identity of the profile instead of the target's", func() {
+		Client("user", "login", ospreyconfigFlag, "--target="+target, "--profile=admin", "--password=foo").RunAndAssertSuccess()
+
+		elevatedUser := loadKubeconfig().AuthInfos[target+"@admin-elevated"]
+		Expect(elevatedUser).NotTo(BeNil())
+		Expect(elevatedUser.ImpersonateGroups).To(Equal([]string{"cluster-admins"}))
+		Expect(elevatedUser.ImpersonateUID).To(BeEmpty())
+	})
+
+	It("switches to the elevated context with use --elevated", func() {
+		Client("user", "login", ospreyconfigFlag, "--target="+target, "--username=jane", "--password=foo").RunAndAssertSuccess()
+
+		Client("use", ospreyconfigFlag, alias, "--elevated").RunAndAssertSuccess()
+		Expect(loadKubeconfig().CurrentContext).To(Equal(target + "-elevated"))
+	})
+
+	It("logs out of the elevated user", func() {
+		Client("user", "login", ospreyconfigFlag, "--target="+target, "--username=jane", "--password=foo").RunAndAssertSuccess()
+
+		Client("user", "logout", ospreyconfigFlag, "--target="+target).RunAndAssertSuccess()
+		Expect(loadKubeconfig().AuthInfos[target+"-elevated"].AuthProvider.Config["id-token"]).To(BeEmpty())
+	})
+
+	It("rejects impersonated groups without an impersonated user", func() {
+		ospreyconfig.Providers[0].Targets[target].ImpersonateUser = ""
+		Expect(SaveConfig(ospreyconfig.Config, ospreyconfig.ConfigFile)).To(Succeed())
+
+		login := Client("user", "login", ospreyconfigFlag, "--target="+target, "--username=jane", "--password=foo")
+		login.RunAndAssertFailure()
+		Expect(login.GetOutput()).To(ContainSubstring("impersonate-groups and impersonate-uid require impersonate-user"))
+	})
+})
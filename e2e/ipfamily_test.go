@@ -0,0 +1,83 @@
+package e2e
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/sky-uk/osprey/v2/client/kubeconfig"
+	. "github.com/sky-uk/osprey/v2/e2e/ospreytest"
+)
+
+var _ = Describe("IP family", func() {
+	var configFile string
+
+	// the osprey test servers listen on all the addresses, including the IPv6 loopback address
+	writeConfig := func(ipFamily string) {
+		config := fmt.Sprintf(`apiVersion: v3
+kubeconfig: %s
+providers:
+  - type: osprey
+    certificate-authority: %s
+    targets:
+      loopback6:
+        server: https://[::1]:%d
+        ip-family: %q
+`, ospreyconfig.Kubeconfig, ospreys[0].CertFile, ospreys[0].Port, ipFamily)
+		configFile = filepath.Join(testDir, "ip-family-config")
+		Expect(ioutil.WriteFile(configFile, []byte(config), 0644)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		resetDefaults()
+		setupClientForEnvironments(ospreyProviderName, environmentsToUse, "", "", false)
+	})
+
+	AfterEach(func() {
+		cleanup()
+	})
+
+	AssertLogin := func(ipFamily string) {
+		It(fmt.Sprintf("logs in to an IPv6 target with ip-family %q", ipFamily), func() {
+			writeConfig(ipFamily)
+			login := Client("user", "login", "--ospreyconfig="+configFile, "--username=jane", "--password=foo")
+			login.RunAndAssertSuccess()
+
+			Expect(kubeconfig.LoadConfig(ospreyconfig.Kubeconfig)).To(Succeed())
+			generatedConfig, err := kubeconfig.GetConfig()
+			Expect(err).To(BeNil(), "successfully creates a kubeconfig")
+			Expect(generatedConfig.Clusters).To(HaveKey("loopback6"))
+		})
+	}
+
+	AssertLogin("")
+	AssertLogin("auto")
+	AssertLogin("ipv6")
+
+	It("fails to log in to an IPv6 target over ipv4", func() {
+		writeConfig("ipv4")
+		login := Client("user", "login", "--ospreyconfig="+configFile, "--username=jane", "--password=foo")
+		login.RunAndAssertFailure()
+
+		Expect(login.GetOutput()).To(ContainSubstring("no suitable address"))
+	})
+
+	It("diagnoses the ip-family mismatch", func() {
+		writeConfig("ipv4")
+		doctor := Client("doctor", "--ospreyconfig="+configFile, "--all")
+		doctor.RunAndAssertFailure()
+
+		Expect(doctor.GetStdout()).To(MatchRegexp(`\[failed\]\s+dns\s+::1 is not an ipv4 address`))
+		Expect(doctor.GetStdout()).To(ContainSubstring("set it to auto"))
+	})
+
+	It("rejects unknown ip families", func() {
+		writeConfig("ipv5")
+		targets := Client("config", "targets", "--ospreyconfig="+configFile)
+		targets.RunAndAssertFailure()
+
+		Expect(targets.GetOutput()).To(ContainSubstring("must be one of auto, ipv4 or ipv6"))
+	})
+})
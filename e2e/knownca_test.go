@@ -0,0 +1,129 @@
+package e2e
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/sky-uk/osprey/v2/client"
+	"github.com/sky-uk/osprey/v2/e2e/apiservertest"
+	. "github.com/sky-uk/osprey/v2/e2e/ospreytest"
+)
+
+var _ = Describe("Known API server CAs", func() {
+	var (
+		userLoginArgs []string
+		fingerprint1  string
+		fingerprint2  string
+	)
+
+	BeforeEach(func() {
+		resetDefaults()
+		apiServerURL = fmt.Sprintf("http://localhost:%d", apiServerPort)
+
+		var err error
+		fingerprint1, err = client.CAFingerprint([]byte(apiservertest.CaCert1Pem))
+		Expect(err).NotTo(HaveOccurred())
+		fingerprint2, err = client.CAFingerprint([]byte(apiservertest.CaCert2Pem))
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	JustBeforeEach(func() {
+		setupClientForEnvironments(azureProviderName, environmentsToUse, oidcClientID, apiServerURL, useGKEClientConfig)
+		userLoginArgs = []string{"user", "login", ospreyconfigFlag, "--disable-browser-popup"}
+	})
+
+	AfterEach(func() {
+		oidcTestServer.Reset()
+		apiTestServer.Reset()
+		cleanup()
+	})
+
+	login := func(args ...string) {
+		login := loginCommand(ospreyBinary, append(userLoginArgs, args...)...)
+		_, err := doOIDCMockRequest("/v2.0/authorize", oidcClientID, oidcRedirectURI, []string{"api://some-dummy-scope"})
+		Expect(err).NotTo(HaveOccurred())
+		login.AssertSuccess()
+	}
+
+	replaceKnownFingerprint := func(old, new string) {
+		knownCAs, err := ioutil.ReadFile(knownCAsFile())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(knownCAs)).To(ContainSubstring(old))
+		err = ioutil.WriteFile(knownCAsFile(), []byte(strings.Replace(string(knownCAs), old, new, -1)), 0600)
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	It("trusts the CA of the API server on first use", func() {
+		login()
+
+		knownCAs := Client("config", "known-cas", ospreyconfigFlag)
+		knownCAs.RunAndAssertSuccess()
+		Expect(knownCAs.GetStdout()).To(ContainSubstring(fmt.Sprintf("%s %s %s", OspreyconfigTargetName("local"), apiServerURL, fingerprint1)))
+		Expect(knownCAs.GetOutput()).NotTo(ContainSubstring(fingerprint2))
+	})
+
+	It("keys the CAs by provider, profile and target", func() {
+		login()
+
+		knownCAs := Client("config", "known-cas", ospreyconfigFlag)
+		knownCAs.RunAndAssertSuccess()
+		Expect(knownCAs.GetStdout()).To(ContainSubstring(fmt.Sprintf("%s:provider-0/%s %s", azureProviderName,
+			OspreyconfigTargetName("local"), apiServerURL)))
+	})
+
+	It("migrates the CAs known by target name", func() {
+		login()
+		key := fmt.Sprintf("%s:provider-0/%s ", azureProviderName, OspreyconfigTargetName("local"))
+		replaceKnownFingerprint(key, OspreyconfigTargetName("local")+" ")
+
+		login()
+
+		knownCAs, err := ioutil.ReadFile(knownCAsFile())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(knownCAs)).To(ContainSubstring(key + apiServerURL + " " + fingerprint1))
+	})
+
+	It("refuses to log in when the CA changes", func() {
+		login()
+		replaceKnownFingerprint(fingerprint1, fingerprint2)
+
+		login := loginCommand(ospreyBinary, userLoginArgs...)
+		_, err := doOIDCMockRequest("/v2.0/authorize", oidcClientID, oidcRedirectURI, []string{"api://some-dummy-scope"})
+		Expect(err).NotTo(HaveOccurred())
+		login.AssertFailure()
+		Expect(login.GetOutput()).To(ContainSubstring(fmt.Sprintf("changed from %s to %s", fingerprint2, fingerprint1)))
+		Expect(login.GetOutput()).To(ContainSubstring("--accept-new-ca"))
+	})
+
+	It("accepts the new CA with --accept-new-ca", func() {
+		login()
+		replaceKnownFingerprint(fingerprint1, fingerprint2)
+
+		login("--accept-new-ca")
+
+		knownCAs, err := ioutil.ReadFile(knownCAsFile())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(knownCAs)).To(ContainSubstring(fingerprint1))
+		Expect(string(knownCAs)).NotTo(ContainSubstring(fingerprint2))
+	})
+
+	It("trusts the next CA on first use after forgetting the target", func() {
+		login()
+		replaceKnownFingerprint(fingerprint1, fingerprint2)
+
+		forget := Client("config", "known-cas", "forget", ospreyconfigFlag, OspreyconfigTargetName("local"))
+		forget.RunAndAssertSuccess()
+		Expect(forget.GetOutput()).To(ContainSubstring("Forgot the CA of " + OspreyconfigTargetName("local")))
+
+		login()
+	})
+
+	It("fails to forget unknown targets", func() {
+		forget := Client("config", "known-cas", "forget", ospreyconfigFlag, "unknown")
+		forget.RunAndAssertFailure()
+		Expect(forget.GetOutput()).To(ContainSubstring("No known CA for unknown"))
+	})
+})
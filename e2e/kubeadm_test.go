@@ -0,0 +1,117 @@
+package e2e
+
+import (
+	"fmt"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/sky-uk/osprey/v2/client/kubeconfig"
+	"github.com/sky-uk/osprey/v2/e2e/apiservertest"
+	. "github.com/sky-uk/osprey/v2/e2e/ospreytest"
+)
+
+var _ = Describe("Kubeadm cluster-info discovery", func() {
+	var userLoginArgs []string
+
+	BeforeEach(func() {
+		resetDefaults()
+		apiServerURL = fmt.Sprintf("http://localhost:%d", apiServerPort)
+		setupClientForEnvironments(azureProviderName, environmentsToUse, oidcClientID, apiServerURL, useGKEClientConfig)
+		userLoginArgs = []string{"user", "login", ospreyconfigFlag, "--disable-browser-popup"}
+	})
+
+	AfterEach(func() {
+		oidcTestServer.Reset()
+		apiTestServer.Reset()
+		cleanup()
+	})
+
+	useKubeadmClusterInfo := func(bootstrapToken string, caCertHashes ...string) {
+		for _, target := range ospreyconfig.Providers[0].Targets {
+			target.UseKubeadmClusterInfo = true
+			target.BootstrapToken = bootstrapToken
+			target.CACertHashes = caCertHashes
+		}
+		Expect(SaveConfig(ospreyconfig.Config, ospreyconfig.ConfigFile)).To(Succeed())
+	}
+
+	login := func() {
+		login := loginCommand(ospreyBinary, userLoginArgs...)
+		_, err := doOIDCMockRequest("/v2.0/authorize", oidcClientID, oidcRedirectURI, []string{"api://some-dummy-scope"})
+		Expect(err).NotTo(HaveOccurred())
+		login.AssertSuccess()
+	}
+
+	assertClusterFromClusterInfo := func() {
+		Expect(apiTestServer.RequestCount("/api/v1/namespaces/kube-public/configmaps/cluster-info")).To(Equal(1))
+		Expect(apiTestServer.RequestCount("/api/v1/namespaces/kube-public/configmaps/kube-root-ca.crt")).To(Equal(0))
+		Expect(kubeconfig.LoadConfig(ospreyconfig.Kubeconfig)).To(Succeed())
+		generatedConfig, err := kubeconfig.GetConfig()
+		Expect(err).NotTo(HaveOccurred())
+		cluster := generatedConfig.Clusters[OspreyconfigTargetName("local")]
+		Expect(cluster.Server).To(Equal(apiservertest.KubeadmAPIServerURL))
+		Expect(cluster.CertificateAuthorityData).To(Equal([]byte(apiservertest.CaCert2Pem)))
+	}
+
+	It("verifies the cluster-info with the bootstrap token", func() {
+		useKubeadmClusterInfo(apiservertest.BootstrapToken)
+		login()
+		assertClusterFromClusterInfo()
+	})
+
+	It("verifies the cluster-info with the ca-cert-hashes", func() {
+		useKubeadmClusterInfo("", "sha256:"+fmt.Sprintf("%064d", 0), apiservertest.KubeadmCACertHash())
+		login()
+		assertClusterFromClusterInfo()
+	})
+
+	It("refuses a cluster-info not signed by the bootstrap token", func() {
+		useKubeadmClusterInfo("abcdef.aaaaaaaaaaaaaaaa")
+		login := loginCommand(ospreyBinary, userLoginArgs...)
+		_, err := doOIDCMockRequest("/v2.0/authorize", oidcClientID, oidcRedirectURI, []string{"api://some-dummy-scope"})
+		Expect(err).NotTo(HaveOccurred())
+		login.AssertFailure()
+		Expect(login.GetOutput()).To(ContainSubstring("the kubeconfig is not signed by the token abcdef"))
+	})
+
+	It("refuses a cluster-info without a signature for the bootstrap token", func() {
+		useKubeadmClusterInfo("zyxwvu.0123456789abcdef")
+		login := loginCommand(ospreyBinary, userLoginArgs...)
+		_, err := doOIDCMockRequest("/v2.0/authorize", oidcClientID, oidcRedirectURI, []string{"api://some-dummy-scope"})
+		Expect(err).NotTo(HaveOccurred())
+		login.AssertFailure()
+		Expect(login.GetOutput()).To(ContainSubstring("no signature for the token zyxwvu"))
+	})
+
+	It("refuses a cluster-info whose CA matches none of the ca-cert-hashes", func() {
+		useKubeadmClusterInfo(apiservertest.BootstrapToken, "sha256:"+fmt.Sprintf("%064d", 0))
+		login := loginCommand(ospreyBinary, userLoginArgs...)
+		_, err := doOIDCMockRequest("/v2.0/authorize", oidcClientID, oidcRedirectURI, []string{"api://some-dummy-scope"})
+		Expect(err).NotTo(HaveOccurred())
+		login.AssertFailure()
+		Expect(login.GetOutput()).To(ContainSubstring(apiservertest.KubeadmCACertHash() + " matches none of the ca-cert-hashes"))
+	})
+
+	It("diagnoses an invalid bootstrap token", func() {
+		useKubeadmClusterInfo("abcdef.aaaaaaaaaaaaaaaa")
+		doctor := Client("doctor", ospreyconfigFlag, "--all")
+		doctor.RunAndAssertFailure()
+		Expect(doctor.GetStdout()).To(MatchRegexp(`\[ok\]\s+kube-public configmap\s+configmaps/cluster-info is readable`))
+		Expect(doctor.GetStdout()).To(MatchRegexp(`\[failed\]\s+cluster-info\s+cluster-info signature verification failed`))
+		Expect(doctor.GetStdout()).To(ContainSubstring("kubeadm token create"))
+	})
+
+	It("requires a bootstrap token or ca-cert-hashes", func() {
+		useKubeadmClusterInfo("")
+		targets := Client("config", "targets", ospreyconfigFlag)
+		targets.RunAndAssertFailure()
+		Expect(targets.GetOutput()).To(ContainSubstring("requires a bootstrap-token or ca-cert-hashes"))
+	})
+
+	It("rejects invalid bootstrap tokens", func() {
+		useKubeadmClusterInfo("abcdef")
+		targets := Client("config", "targets", ospreyconfigFlag)
+		targets.RunAndAssertFailure()
+		Expect(targets.GetOutput()).To(ContainSubstring("invalid bootstrap-token"))
+	})
+})
@@ -0,0 +1,119 @@
+package e2e
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/sky-uk/osprey/v2/client/kubeconfig"
+	"github.com/sky-uk/osprey/v2/e2e/clitest"
+	. "github.com/sky-uk/osprey/v2/e2e/ospreytest"
+	"k8s.io/client-go/tools/clientcmd"
+	clientgo "k8s.io/client-go/tools/clientcmd/api"
+)
+
+var _ = Describe("Kubeconfig names", func() {
+	var target, alias string
+
+	BeforeEach(func() {
+		resetDefaults()
+		target = OspreyconfigTargetName("local")
+		alias = OspreyconfigAliasName("local")
+	})
+
+	JustBeforeEach(func() {
+		setupClientForEnvironments(ospreyProviderName, environmentsToUse, "", "", false)
+	})
+
+	AfterEach(func() {
+		cleanup()
+	})
+
+	userLogin := func(args ...string) clitest.TestCommand {
+		return Client(append([]string{"user", "login", ospreyconfigFlag, "--target=" + target, "--username=jane", "--password=foo"}, args...)...)
+	}
+
+	loadKubeconfig := func() *clientgo.Config {
+		Expect(kubeconfig.LoadConfig(ospreyconfig.Kubeconfig)).To(Succeed())
+		generatedConfig, err := kubeconfig.GetConfig()
+		Expect(err).NotTo(HaveOccurred())
+		return generatedConfig
+	}
+
+	// writeKubeconfig writes a cluster, user and context named after the target, with the given credentials
+	writeKubeconfig := func(authInfo *clientgo.AuthInfo) {
+		config := clientgo.NewConfig()
+		config.Clusters[target] = &clientgo.Cluster{Server: "https://gke.example.com"}
+		config.AuthInfos[target] = authInfo
+		config.Contexts[target] = &clientgo.Context{Cluster: target, AuthInfo: target}
+		Expect(clientcmd.WriteToFile(*config, ospreyconfig.Kubeconfig)).To(Succeed())
+	}
+
+	It("names the clusters, users and contexts with the name templates", func() {
+		ospreyconfig.ClusterNameTemplate = "osprey-{{.Target}}"
+		ospreyconfig.UserNameTemplate = "{{.ProviderType}}-{{.Provider}}-{{.Target}}"
+		ospreyconfig.ContextNameTemplate = "osprey-{{.Alias}}"
+		Expect(SaveConfig(ospreyconfig.Config, ospreyconfig.ConfigFile)).To(Succeed())
+
+		login := userLogin()
+		login.RunAndAssertSuccess()
+		Expect(login.GetOutput()).To(ContainSubstring("Logged in to: osprey-%s  | osprey-%s", target, alias))
+
+		generatedConfig := loadKubeconfig()
+		Expect(generatedConfig.Clusters).To(HaveKey("osprey-" + target))
+		Expect(generatedConfig.AuthInfos).To(HaveKey("osprey-provider-0-" + target))
+		for _, context := range []string{"osprey-" + target, "osprey-" + alias} {
+			Expect(generatedConfig.Contexts).To(HaveKey(context))
+			Expect(generatedConfig.Contexts[context].Cluster).To(Equal("osprey-" + target))
+			Expect(generatedConfig.Contexts[context].AuthInfo).To(Equal("osprey-provider-0-" + target))
+		}
+
+		user := Client("user", ospreyconfigFlag, "--target="+target)
+		user.RunAndAssertSuccess()
+		Expect(user.GetOutput()).NotTo(ContainSubstring("osprey-%s: none", target))
+	})
+
+	It("rejects invalid name templates", func() {
+		ospreyconfig.ContextNameTemplate = "{{.Cluster}}"
+		Expect(SaveConfig(ospreyconfig.Config, ospreyconfig.ConfigFile)).To(Succeed())
+
+		login := userLogin()
+		login.RunAndAssertFailure()
+		Expect(login.GetOutput()).To(ContainSubstring("invalid context-name-template"))
+	})
+
+	It("refuses to overwrite the entries that were not written by osprey", func() {
+		writeKubeconfig(&clientgo.AuthInfo{Exec: &clientgo.ExecConfig{
+			APIVersion: "client.authentication.k8s.io/v1beta1", Command: "gke-gcloud-auth-plugin"}})
+
+		login := userLogin()
+		login.RunAndAssertFailure()
+		Expect(login.GetOutput()).To(ContainSubstring("the kubeconfig cluster %q was not written by osprey", target))
+		Expect(loadKubeconfig().AuthInfos[target].Exec).NotTo(BeNil())
+
+		login = userLogin("--force")
+		login.RunAndAssertSuccess()
+		Expect(loadKubeconfig().AuthInfos[target].Exec).To(BeNil())
+	})
+
+	It("takes over the entries written by older versions of osprey", func() {
+		writeKubeconfig(&clientgo.AuthInfo{AuthProvider: &clientgo.AuthProviderConfig{
+			Name: "oidc", Config: map[string]string{"id-token": ""}}})
+
+		userLogin().RunAndAssertSuccess()
+	})
+
+	It("refuses to overwrite the entries of the targets of other osprey configs", func() {
+		userLogin().RunAndAssertSuccess()
+
+		otherConfigFile := filepath.Join(filepath.Dir(ospreyconfig.ConfigFile), "other-config")
+		Expect(SaveConfig(ospreyconfig.Config, otherConfigFile)).To(Succeed())
+		defer os.Remove(otherConfigFile)
+
+		login := Client("user", "login", "--ospreyconfig="+otherConfigFile, "--target="+target, "--username=jane", "--password=foo")
+		login.RunAndAssertFailure()
+		Expect(login.GetOutput()).To(ContainSubstring("the kubeconfig cluster %q belongs to the target %s of the osprey config %s",
+			target, target, ospreyconfig.ConfigFile))
+	})
+})
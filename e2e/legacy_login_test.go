@@ -95,7 +95,7 @@ var _ = Describe("Sanity check Login using a legacy osprey config file format",
 
 			It("contains a cluster per osprey", func() {
 				for _, osprey := range targetedOspreys {
-					expectedCluster := osprey.ToKubeconfigCluster(ospreyconfig.LegacyConfig.Kubeconfig)
+					expectedCluster := osprey.ToKubeconfigCluster(ospreyconfig.LegacyConfig.Kubeconfig, ospreyconfig.LegacyConfigFile)
 					target := osprey.OspreyconfigTargetName()
 					Expect(generatedConfig.Clusters).To(HaveKeyWithValue(target, expectedCluster))
 				}
@@ -104,7 +104,7 @@ var _ = Describe("Sanity check Login using a legacy osprey config file format",
 
 			It("contains a user per osprey", func() {
 				for _, osprey := range targetedOspreys {
-					expectedAuthInfo := osprey.ToKubeconfigUserWithoutToken(ospreyconfig.LegacyConfig.Kubeconfig)
+					expectedAuthInfo := osprey.ToKubeconfigUserWithoutToken(ospreyconfig.LegacyConfig.Kubeconfig, ospreyconfig.LegacyConfigFile)
 					authInfoID := osprey.OspreyconfigTargetName()
 					Expect(generatedConfig.AuthInfos).To(HaveKey(authInfoID))
 					Expect(generatedConfig.AuthInfos[authInfoID]).To(WithTransform(WithoutToken, Equal(expectedAuthInfo)))
@@ -115,7 +115,7 @@ var _ = Describe("Sanity check Login using a legacy osprey config file format",
 
 			It("contains a context per osprey", func() {
 				for _, osprey := range targetedOspreys {
-					kcontext := osprey.ToKubeconfigContext(ospreyconfig.LegacyConfig.Kubeconfig)
+					kcontext := osprey.ToKubeconfigContext(ospreyconfig.LegacyConfig.Kubeconfig, ospreyconfig.LegacyConfigFile)
 					target := osprey.OspreyconfigTargetName()
 					Expect(generatedConfig.Contexts).To(HaveKeyWithValue(target, kcontext))
 				}
@@ -125,7 +125,7 @@ var _ = Describe("Sanity check Login using a legacy osprey config file format",
 
 			It("contains an alias per context", func() {
 				for _, osprey := range targetedOspreys {
-					kcontext := osprey.ToKubeconfigContext(ospreyconfig.LegacyConfig.Kubeconfig)
+					kcontext := osprey.ToKubeconfigContext(ospreyconfig.LegacyConfig.Kubeconfig, ospreyconfig.LegacyConfigFile)
 					targetAlias := osprey.OspreyconfigAliasName()
 					Expect(generatedConfig.Contexts).To(HaveKeyWithValue(targetAlias, kcontext))
 				}
@@ -153,7 +153,7 @@ var _ = Describe("Sanity check Login using a legacy osprey config file format",
 
 			It("preserves namespace per context", func() {
 				for _, osprey := range targetedOspreys {
-					kcontext := osprey.ToKubeconfigContext(ospreyconfig.LegacyConfig.Kubeconfig)
+					kcontext := osprey.ToKubeconfigContext(ospreyconfig.LegacyConfig.Kubeconfig, ospreyconfig.LegacyConfigFile)
 					kcontext.Namespace = osprey.CustomTargetNamespace("-namespace")
 					target := osprey.OspreyconfigTargetName()
 					Expect(generatedConfig.Contexts).To(HaveKeyWithValue(target, kcontext))
@@ -164,7 +164,7 @@ var _ = Describe("Sanity check Login using a legacy osprey config file format",
 
 			It("preserves namespace per alias", func() {
 				for _, osprey := range targetedOspreys {
-					kcontext := osprey.ToKubeconfigContext(ospreyconfig.LegacyConfig.Kubeconfig)
+					kcontext := osprey.ToKubeconfigContext(ospreyconfig.LegacyConfig.Kubeconfig, ospreyconfig.LegacyConfigFile)
 					kcontext.Namespace = osprey.CustomAliasNamespace("-namespace")
 					targetAlias := osprey.OspreyconfigAliasName()
 					Expect(generatedConfig.Contexts).To(HaveKeyWithValue(targetAlias, kcontext))
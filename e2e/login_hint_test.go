@@ -0,0 +1,91 @@
+package e2e
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/sky-uk/osprey/v2/e2e/clitest"
+	. "github.com/sky-uk/osprey/v2/e2e/ospreytest"
+	"gopkg.in/yaml.v2"
+)
+
+var _ = Describe("Login hints", func() {
+	const account = "john.doe@osprey.org"
+	var userLoginArgs []string
+
+	BeforeEach(func() {
+		resetDefaults()
+		apiServerURL = fmt.Sprintf("http://localhost:%d", apiServerPort)
+		setupClientForEnvironments(azureProviderName, environmentsToUse, oidcClientID, apiServerURL, useGKEClientConfig)
+		userLoginArgs = []string{"user", "login", ospreyconfigFlag, "--disable-browser-popup"}
+	})
+
+	AfterEach(func() {
+		oidcTestServer.Reset()
+		apiTestServer.Reset()
+		cleanup()
+	})
+
+	// login logs in and returns the query of its authorization URL
+	login := func(args ...string) (clitest.AsyncTestCommand, map[string]string) {
+		login := loginCommand(ospreyBinary, append(userLoginArgs, args...)...)
+		query := authorizationURL(login).Query()
+		_, err := doOIDCMockRequest("/v2.0/authorize", oidcClientID, oidcRedirectURI, []string{"api://some-dummy-scope"})
+		Expect(err).NotTo(HaveOccurred())
+		login.AssertSuccess()
+		return login, map[string]string{
+			"login_hint":  query.Get("login_hint"),
+			"domain_hint": query.Get("domain_hint"),
+			"prompt":      query.Get("prompt"),
+		}
+	}
+
+	readAccounts := func() map[string]string {
+		data, err := ioutil.ReadFile(accountsFile())
+		Expect(err).NotTo(HaveOccurred())
+		accounts := map[string]string{}
+		Expect(yaml.Unmarshal(data, &accounts)).To(Succeed())
+		return accounts
+	}
+
+	It("sends the hints of the provider", func() {
+		ospreyconfig.Providers[0].Azure.LoginHint = account
+		ospreyconfig.Providers[0].Azure.DomainHint = "osprey.org"
+		ospreyconfig.Providers[0].Azure.Prompt = "select_account"
+		Expect(SaveConfig(ospreyconfig.Config, ospreyconfig.ConfigFile)).To(Succeed())
+
+		_, hints := login()
+		Expect(hints).To(Equal(map[string]string{"login_hint": account, "domain_hint": "osprey.org", "prompt": "select_account"}))
+	})
+
+	It("sends the hints of the flags over the ones of the provider", func() {
+		ospreyconfig.Providers[0].Azure.Prompt = "select_account"
+		Expect(SaveConfig(ospreyconfig.Config, ospreyconfig.ConfigFile)).To(Succeed())
+
+		_, hints := login("--login-hint="+account, "--domain-hint=osprey.org", "--prompt=login")
+		Expect(hints).To(Equal(map[string]string{"login_hint": account, "domain_hint": "osprey.org", "prompt": "login"}))
+	})
+
+	It("remembers the account logged in with for the next logins", func() {
+		_, hints := login()
+		Expect(hints["login_hint"]).To(BeEmpty())
+		Expect(readAccounts()).To(And(HaveLen(1), ContainElement(account)))
+
+		_, hints = login()
+		Expect(hints["login_hint"]).To(Equal(account))
+	})
+
+	It("warns when the user logged in with another account than the expected one", func() {
+		login, _ := login("--login-hint=jane.doe@osprey.org")
+		Expect(login.GetOutput()).To(ContainSubstring("as john.doe@osprey.org instead of the expected account jane.doe@osprey.org"))
+		Expect(readAccounts()).To(And(HaveLen(1), ContainElement(account)))
+	})
+
+	It("rejects an invalid prompt", func() {
+		login := Client(append(userLoginArgs, "--prompt=none")...)
+		login.RunAndAssertFailure()
+		Expect(login.GetOutput()).To(ContainSubstring(`invalid prompt "none": must be one of select_account, login or consent`))
+	})
+})
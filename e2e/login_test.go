@@ -94,7 +94,7 @@ var _ = Describe("Login", func() {
 
 			It("contains a cluster per osprey", func() {
 				for _, osprey := range targetedOspreys {
-					expectedCluster := osprey.ToKubeconfigCluster(ospreyconfig.Kubeconfig)
+					expectedCluster := osprey.ToKubeconfigCluster(ospreyconfig.Kubeconfig, ospreyconfig.ConfigFile)
 					target := osprey.OspreyconfigTargetName()
 					Expect(generatedConfig.Clusters).To(HaveKeyWithValue(target, expectedCluster))
 				}
@@ -103,7 +103,7 @@ var _ = Describe("Login", func() {
 
 			It("contains a user per osprey", func() {
 				for _, osprey := range targetedOspreys {
-					expectedAuthInfo := osprey.ToKubeconfigUserWithoutToken(ospreyconfig.Kubeconfig)
+					expectedAuthInfo := osprey.ToKubeconfigUserWithoutToken(ospreyconfig.Kubeconfig, ospreyconfig.ConfigFile)
 					authInfoID := osprey.OspreyconfigTargetName()
 					Expect(generatedConfig.AuthInfos).To(HaveKey(authInfoID))
 					Expect(generatedConfig.AuthInfos[authInfoID]).To(WithTransform(WithoutToken, Equal(expectedAuthInfo)))
@@ -114,7 +114,7 @@ var _ = Describe("Login", func() {
 
 			It("contains a context per osprey", func() {
 				for _, osprey := range targetedOspreys {
-					kcontext := osprey.ToKubeconfigContext(ospreyconfig.Kubeconfig)
+					kcontext := osprey.ToKubeconfigContext(ospreyconfig.Kubeconfig, ospreyconfig.ConfigFile)
 					target := osprey.OspreyconfigTargetName()
 					Expect(generatedConfig.Contexts).To(HaveKeyWithValue(target, kcontext))
 				}
@@ -124,7 +124,7 @@ var _ = Describe("Login", func() {
 
 			It("contains an alias per context", func() {
 				for _, osprey := range targetedOspreys {
-					kcontext := osprey.ToKubeconfigContext(ospreyconfig.Kubeconfig)
+					kcontext := osprey.ToKubeconfigContext(ospreyconfig.Kubeconfig, ospreyconfig.ConfigFile)
 					targetAlias := osprey.OspreyconfigAliasName()
 					Expect(generatedConfig.Contexts).To(HaveKeyWithValue(targetAlias, kcontext))
 				}
@@ -152,7 +152,7 @@ var _ = Describe("Login", func() {
 
 			It("namespace preserved per context", func() {
 				for _, osprey := range targetedOspreys {
-					kcontext := osprey.ToKubeconfigContext(ospreyconfig.Kubeconfig)
+					kcontext := osprey.ToKubeconfigContext(ospreyconfig.Kubeconfig, ospreyconfig.ConfigFile)
 					kcontext.Namespace = osprey.CustomTargetNamespace("-namespace")
 					target := osprey.OspreyconfigTargetName()
 					Expect(generatedConfig.Contexts).To(HaveKeyWithValue(target, kcontext))
@@ -163,7 +163,7 @@ var _ = Describe("Login", func() {
 
 			It("namespace preserved per alias", func() {
 				for _, osprey := range targetedOspreys {
-					kcontext := osprey.ToKubeconfigContext(ospreyconfig.Kubeconfig)
+					kcontext := osprey.ToKubeconfigContext(ospreyconfig.Kubeconfig, ospreyconfig.ConfigFile)
 					kcontext.Namespace = osprey.CustomAliasNamespace("-namespace")
 					targetAlias := osprey.OspreyconfigAliasName()
 					Expect(generatedConfig.Contexts).To(HaveKeyWithValue(targetAlias, kcontext))
@@ -67,7 +67,7 @@ var _ = Describe("Logout", func() {
 				loggedOutConfig, err := kubeconfig.GetConfig()
 				Expect(err).To(BeNil(), "successfully updated kubeconfig")
 				for _, osprey := range loggedInEnvironments {
-					expectedAuthInfo := osprey.ToKubeconfigUserWithoutToken(ospreyconfig.Kubeconfig)
+					expectedAuthInfo := osprey.ToKubeconfigUserWithoutToken(ospreyconfig.Kubeconfig, ospreyconfig.ConfigFile)
 					authInfoID := osprey.OspreyconfigTargetName()
 					Expect(loggedOutConfig.AuthInfos).To(HaveKey(authInfoID))
 					Expect(loggedOutConfig.AuthInfos[authInfoID]).To(WithTransform(WithoutToken, Equal(expectedAuthInfo)))
@@ -81,7 +81,7 @@ var _ = Describe("Logout", func() {
 				loggedOutConfig, err := kubeconfig.GetConfig()
 				Expect(err).To(BeNil(), "successfully updated kubeconfig")
 				for _, osprey := range targetedOspreys {
-					expectedAuthInfo := osprey.ToKubeconfigUserWithoutToken(ospreyconfig.Kubeconfig)
+					expectedAuthInfo := osprey.ToKubeconfigUserWithoutToken(ospreyconfig.Kubeconfig, ospreyconfig.ConfigFile)
 					authInfoID := osprey.OspreyconfigTargetName()
 					Expect(loggedOutConfig.AuthInfos).To(HaveKey(authInfoID))
 					Expect(loggedOutConfig.AuthInfos[authInfoID]).To(Equal(expectedAuthInfo), "does not have a token")
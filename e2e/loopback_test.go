@@ -0,0 +1,103 @@
+package e2e
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/sky-uk/osprey/v2/e2e/ospreytest"
+)
+
+var _ = Describe("Loopback redirect", func() {
+	var userLoginArgs []string
+
+	BeforeEach(func() {
+		resetDefaults()
+		apiServerURL = fmt.Sprintf("http://localhost:%d", apiServerPort)
+		setupClientForEnvironments(azureProviderName, environmentsToUse, oidcClientID, apiServerURL, useGKEClientConfig)
+		userLoginArgs = []string{"user", "login", ospreyconfigFlag, "--disable-browser-popup"}
+	})
+
+	AfterEach(func() {
+		oidcTestServer.Reset()
+		apiTestServer.Reset()
+		cleanup()
+	})
+
+	setLoopbackRedirect := func(loopbackRedirect string) {
+		ospreyconfig.Providers[0].Azure.LoopbackRedirect = loopbackRedirect
+		Expect(SaveConfig(ospreyconfig.Config, ospreyconfig.ConfigFile)).To(Succeed())
+	}
+
+	AssertEphemeralPort := func(loopbackRedirect, loopbackIP string) {
+		It(fmt.Sprintf("logs in on an ephemeral port of %s with loopback-redirect %s", loopbackIP, loopbackRedirect), func() {
+			setLoopbackRedirect(loopbackRedirect)
+
+			login := loginCommand(ospreyBinary, userLoginArgs...)
+			redirect := authorizationURL(login).Query().Get("redirect_uri")
+			Expect(redirect).To(MatchRegexp(`^http://%s:\d+/auth/callback$`, regexp.QuoteMeta(loopbackIP)))
+			Expect(redirect).NotTo(ContainSubstring(":65525/"))
+
+			_, err := doOIDCMockRequest("/v2.0/authorize", oidcClientID, redirect, []string{"api://some-dummy-scope"})
+			Expect(err).NotTo(HaveOccurred())
+			login.AssertSuccess()
+		})
+	}
+
+	AssertEphemeralPort("ipv4", "127.0.0.1")
+	AssertEphemeralPort("ipv6", "[::1]")
+
+	It("names the address in use when the port of the redirect uri is busy", func() {
+		listener, err := net.Listen("tcp", "localhost:65525")
+		Expect(err).NotTo(HaveOccurred())
+		defer listener.Close()
+
+		login := Client(userLoginArgs...)
+		login.RunAndAssertFailure()
+		Expect(login.GetOutput()).To(ContainSubstring("localhost:65525 is already in use by another process: "))
+		Expect(login.GetOutput()).To(ContainSubstring("(pid %d)", os.Getpid()))
+		Expect(login.GetOutput()).To(ContainSubstring("use an ephemeral loopback port"))
+	})
+
+	It("does not find the paths other than the one of the redirect uri", func() {
+		login := loginCommand(ospreyBinary, userLoginArgs...)
+		authorizationURL(login)
+
+		resp, err := http.Get("http://localhost:65525/favicon.ico?state=forged&code=AWORKINGJTW")
+		Expect(err).NotTo(HaveOccurred())
+		resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusNotFound))
+
+		_, err = doOIDCMockRequest("/v2.0/authorize", oidcClientID, oidcRedirectURI, []string{"api://some-dummy-scope"})
+		Expect(err).NotTo(HaveOccurred())
+		login.AssertSuccess()
+	})
+
+	It("refuses the redirects without the state of the login and keeps waiting for its redirect", func() {
+		login := loginCommand(ospreyBinary, userLoginArgs...)
+		authorizationURL(login)
+
+		for _, query := range []string{"state=forged&code=AWORKINGJTW", "code=AWORKINGJTW", "error=access_denied"} {
+			resp, err := http.Get("http://localhost:65525/auth/callback?" + query)
+			Expect(err).NotTo(HaveOccurred())
+			resp.Body.Close()
+			Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+		}
+
+		_, err := doOIDCMockRequest("/v2.0/authorize", oidcClientID, oidcRedirectURI, []string{"api://some-dummy-scope"})
+		Expect(err).NotTo(HaveOccurred())
+		login.AssertSuccess()
+	})
+
+	It("rejects an invalid loopback-redirect", func() {
+		setLoopbackRedirect("localhost")
+
+		login := Client(userLoginArgs...)
+		login.RunAndAssertFailure()
+		Expect(login.GetOutput()).To(ContainSubstring(`invalid loopback-redirect "localhost": must be ipv4 or ipv6`))
+	})
+})
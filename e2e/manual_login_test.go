@@ -0,0 +1,112 @@
+package e2e
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/sky-uk/osprey/v2/client/kubeconfig"
+	"github.com/sky-uk/osprey/v2/e2e/clitest"
+	. "github.com/sky-uk/osprey/v2/e2e/ospreytest"
+)
+
+var _ = Describe("Manual login", func() {
+	var userLoginArgs []string
+	var stdin *os.File
+
+	BeforeEach(func() {
+		resetDefaults()
+		apiServerURL = fmt.Sprintf("http://localhost:%d", apiServerPort)
+		setupClientForEnvironments(azureProviderName, environmentsToUse, oidcClientID, apiServerURL, useGKEClientConfig)
+		userLoginArgs = []string{"user", "login", ospreyconfigFlag, "--manual"}
+	})
+
+	AfterEach(func() {
+		stdin.Close()
+		oidcTestServer.Reset()
+		apiTestServer.Reset()
+		cleanup()
+	})
+
+	manualLogin := func() clitest.AsyncTestCommand {
+		var stdinReader *os.File
+		var err error
+		stdinReader, stdin, err = os.Pipe()
+		Expect(err).NotTo(HaveOccurred())
+		login := clitest.NewAsyncCommandWithStdin(stdinReader, ospreyBinary, userLoginArgs...)
+		login.Run()
+		return login
+	}
+
+	// paste writes the redirect URL pasted by the user
+	paste := func(pasted string) {
+		_, err := fmt.Fprintln(stdin, pasted)
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	It("logs in with the pasted redirect URL", func() {
+		login := manualLogin()
+		authURL := authorizationURL(login)
+		Expect(authURL.Query().Get("redirect_uri")).To(Equal(oidcRedirectURI))
+
+		paste(fmt.Sprintf("%s?code=AWORKINGJTW&state=%s", oidcRedirectURI, authURL.Query().Get("state")))
+		login.EventuallyAssertSuccess(5*time.Second, 100*time.Millisecond)
+		Expect(oidcTestServer.RequestCount("/v2.0/authorize")).To(Equal(0))
+
+		Expect(kubeconfig.LoadConfig(ospreyconfig.Kubeconfig)).To(Succeed())
+		generatedConfig, err := kubeconfig.GetConfig()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(generatedConfig.AuthInfos[OspreyconfigTargetName("local")].Token).NotTo(BeEmpty())
+	})
+
+	It("refuses a code pasted without its redirect URL", func() {
+		login := manualLogin()
+		authorizationURL(login)
+
+		paste("AWORKINGJTW")
+		Eventually(login.Error, 5*time.Second).Should(HaveOccurred())
+		login.AssertFailure()
+		Expect(login.GetOutput()).To(ContainSubstring("paste the whole URL of the failed page, not only its code"))
+	})
+
+	It("sends a loopback redirect URI without a port with loopback-redirect", func() {
+		ospreyconfig.Providers[0].Azure.LoopbackRedirect = "ipv4"
+		Expect(SaveConfig(ospreyconfig.Config, ospreyconfig.ConfigFile)).To(Succeed())
+
+		login := manualLogin()
+		authURL := authorizationURL(login)
+		Expect(authURL.Query().Get("redirect_uri")).To(Equal("http://127.0.0.1/auth/callback"))
+
+		paste(fmt.Sprintf("http://127.0.0.1/auth/callback?code=AWORKINGJTW&state=%s", authURL.Query().Get("state")))
+		login.EventuallyAssertSuccess(5*time.Second, 100*time.Millisecond)
+	})
+
+	It("fails to log in when the state of the pasted redirect URL doesn't match", func() {
+		login := manualLogin()
+		authorizationURL(login)
+
+		paste(oidcRedirectURI + "?code=AWORKINGJTW&state=forged")
+		Eventually(login.Error, 5*time.Second).Should(HaveOccurred())
+		login.AssertFailure()
+		Expect(login.GetOutput()).To(ContainSubstring("state did not match"))
+	})
+
+	It("fails to log in when the issuer refused the login", func() {
+		login := manualLogin()
+		authURL := authorizationURL(login)
+
+		paste(fmt.Sprintf("%s?error=access_denied&error_description=denied&state=%s", oidcRedirectURI,
+			authURL.Query().Get("state")))
+		Eventually(login.Error, 5*time.Second).Should(HaveOccurred())
+		login.AssertFailure()
+		Expect(login.GetOutput()).To(ContainSubstring("the issuer refused the login: access_denied denied"))
+	})
+
+	It("can't be combined with the device-code flow", func() {
+		login := Client(append(userLoginArgs, "--use-device-code")...)
+		login.RunAndAssertFailure()
+		Expect(login.GetOutput()).To(ContainSubstring("[manual use-device-code] were all set"))
+	})
+})
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -22,7 +23,6 @@ const (
 	oidcPort        = int(14980)
 	oidcClientID    = "some-client-id"
 	oidcRedirectURI = "http://localhost:65525/auth/callback"
-	ospreyState     = "as78*sadf$212"
 	ospreyBinary    = "osprey"
 )
 
@@ -53,12 +53,16 @@ var _ = Describe("Login with a cloud provider", func() {
 		AfterEach(func() {
 			oidcTestServer.Reset()
 			apiTestServer.Reset()
+			forgetKnownCAs()
+			clearClusterCache()
+			clearGroupsCache()
+			forgetAccounts()
 		})
 		It("receives a token and decodes the JWT for user details", func() {
 			By("logging in", func() {
 				login := loginCommand(ospreyBinary, userLoginArgs...)
 
-				_, err := doOIDCMockRequest("/v2.0/authorize", oidcClientID, oidcRedirectURI, ospreyState, []string{"api://some-dummy-scope"})
+				_, err := doOIDCMockRequest("/v2.0/authorize", oidcClientID, oidcRedirectURI, []string{"api://some-dummy-scope"})
 				Expect(err).NotTo(HaveOccurred())
 
 				login.AssertSuccess()
@@ -76,7 +80,7 @@ var _ = Describe("Login with a cloud provider", func() {
 				It("should fetch from the Osprey server", func() {
 					login := loginCommand(ospreyBinary, userLoginArgs...)
 
-					_, err := doOIDCMockRequest("/v2.0/authorize", oidcClientID, oidcRedirectURI, ospreyState, []string{"api://some-dummy-scope"})
+					_, err := doOIDCMockRequest("/v2.0/authorize", oidcClientID, oidcRedirectURI, []string{"api://some-dummy-scope"})
 					Expect(err).NotTo(HaveOccurred())
 
 					login.AssertSuccess()
@@ -90,7 +94,7 @@ var _ = Describe("Login with a cloud provider", func() {
 				It("should fetch from the API Server", func() {
 					login := loginCommand(ospreyBinary, userLoginArgs...)
 
-					_, err := doOIDCMockRequest("/v2.0/authorize", oidcClientID, oidcRedirectURI, ospreyState, []string{"api://some-dummy-scope"})
+					_, err := doOIDCMockRequest("/v2.0/authorize", oidcClientID, oidcRedirectURI, []string{"api://some-dummy-scope"})
 					Expect(err).NotTo(HaveOccurred())
 
 					login.AssertSuccess()
@@ -110,7 +114,7 @@ var _ = Describe("Login with a cloud provider", func() {
 				It("URL should be fetched from GKE's ClientConfig resource", func() {
 					login := loginCommand(ospreyBinary, userLoginArgs...)
 
-					_, err := doOIDCMockRequest("/v2.0/authorize", oidcClientID, oidcRedirectURI, ospreyState, []string{"api://some-dummy-scope"})
+					_, err := doOIDCMockRequest("/v2.0/authorize", oidcClientID, oidcRedirectURI, []string{"api://some-dummy-scope"})
 					Expect(err).NotTo(HaveOccurred())
 
 					login.AssertSuccess()
@@ -128,7 +132,7 @@ var _ = Describe("Login with a cloud provider", func() {
 				It("URL should be the same as the configured api-server field", func() {
 					login := loginCommand(ospreyBinary, userLoginArgs...)
 
-					_, err := doOIDCMockRequest("/v2.0/authorize", oidcClientID, oidcRedirectURI, ospreyState, []string{"api://some-dummy-scope"})
+					_, err := doOIDCMockRequest("/v2.0/authorize", oidcClientID, oidcRedirectURI, []string{"api://some-dummy-scope"})
 					Expect(err).NotTo(HaveOccurred())
 
 					login.AssertSuccess()
@@ -145,7 +149,7 @@ var _ = Describe("Login with a cloud provider", func() {
 			targetGroupArgs := append(userLoginArgs, "--group=development")
 			login := loginCommand(ospreyBinary, targetGroupArgs...)
 
-			_, err := doOIDCMockRequest("/v2.0/authorize", oidcClientID, oidcRedirectURI, ospreyState, []string{"api://some-dummy-scope"})
+			_, err := doOIDCMockRequest("/v2.0/authorize", oidcClientID, oidcRedirectURI, []string{"api://some-dummy-scope"})
 			Expect(err).NotTo(HaveOccurred())
 
 			login.AssertSuccess()
@@ -237,7 +241,7 @@ var _ = Describe("Login with a cloud provider", func() {
 			timeoutArgs := append(userLoginArgs, "--login-timeout=20s")
 			login := loginCommand(ospreyBinary, timeoutArgs...)
 
-			_, err := doOIDCMockRequest("/v2.0/authorize", oidcClientID, oidcRedirectURI, ospreyState, []string{"api://some-dummy-scope"})
+			_, err := doOIDCMockRequest("/v2.0/authorize", "login_timeout_exceeded_client_id", oidcRedirectURI, []string{"api://some-dummy-scope"})
 			Expect(err).NotTo(HaveOccurred())
 
 			login.AssertSuccess()
@@ -278,27 +282,51 @@ func doRequestToMockDeviceFlowEndpoint(clientID string) error {
 	return nil
 }
 
-func doOIDCMockRequest(endpoint, clientID, redirectURI, state string, scopes []string) (*http.Response, error) {
+var authorizationURLPattern = regexp.MustCompile(`http://localhost:\d+/v2.0/authorize\S*`)
+
+// authorizationURL returns the authorization URL shown by the login
+func authorizationURL(login clitest.AsyncTestCommand) *url.URL {
+	Eventually(login.GetOutput, 5*time.Second).Should(MatchRegexp(authorizationURLPattern.String()))
+	authURL, err := url.Parse(authorizationURLPattern.FindString(login.GetOutput()))
+	Expect(err).NotTo(HaveOccurred())
+	return authURL
+}
+
+// doOIDCMockRequest plays the browser of the login in progress: it follows the redirect of the client's call-back
+// webserver to the authorization URL, checks the URL against the expected parameters and requests it from the mock
+// issuer, which calls the client back.
+func doOIDCMockRequest(endpoint, clientID, redirectURI string, scopes []string) (*http.Response, error) {
 	// include sleeps in order for the client's callback webserver to become available, and also to finish processing
 	// the requests it does to fetch cluster information.
-	client := http.Client{}
+	client := http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
 	time.Sleep(time.Second)
-	httpParameters := &url.Values{
-		"response_code": {"code"},
-		"client_id":     {clientID},
-		"redirect_uri":  {redirectURI},
-		"scope":         {strings.Join(scopes, " ")},
-		"state":         {state},
+	callbackURL, err := url.Parse(redirectURI)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redirect URI: %w", err)
+	}
+	resp, err := client.Get(fmt.Sprintf("%s://%s/", callbackURL.Scheme, callbackURL.Host))
+	if err != nil {
+		return nil, fmt.Errorf("unable to reach the call-back webserver: %w", err)
+	}
+	resp.Body.Close()
+	authURL, err := resp.Location()
+	if err != nil {
+		return nil, fmt.Errorf("the call-back webserver did not redirect to the authorization URL: %w", err)
+	}
+	query := authURL.Query()
+	if authURL.Path != endpoint || query.Get("client_id") != clientID || query.Get("redirect_uri") != redirectURI ||
+		query.Get("scope") != strings.Join(scopes, " ") || query.Get("state") == "" {
+		return nil, fmt.Errorf("unexpected authorization URL %s", authURL)
 	}
 
-	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("http://localhost:%d%s?%s", oidcPort, endpoint, httpParameters.Encode()), nil)
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("http://localhost:%d%s?%s", oidcPort, endpoint, query.Encode()), nil)
 	if err != nil {
 		return nil, fmt.Errorf("unable to create request: %w", err)
 	}
 
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-
-	resp, err := client.Do(req)
+	resp, err = client.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("unable to fetch response: %w", err)
 	}
@@ -2,37 +2,101 @@ package oidctest
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"math/big"
 	"net/http"
 	"net/url"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/sky-uk/osprey/v2/client/oidc"
-	"golang.org/x/oauth2"
 )
 
 const (
 	errAuthorizationPending = "authorization_pending"
-	errAccessDenied         = "authorization_declined"
+	errAccessDenied         = "access_denied"
 	errExpiredToken         = "expired_token"
 	errbadVerificationCode  = "bad_verification_code"
 	ospreyState             = "as78*sadf$212"
+
+	// DeviceAuthorizationPath is the RFC 8628 device authorization endpoint, advertised by the well-known config
+	DeviceAuthorizationPath = "/oauth2/v2.0/devicecode"
+	// DeviceUserCode is the user code of the device-code logins
+	DeviceUserCode = "MOCK-CODE"
+
+	// MemberObjectsPath is the getMemberObjects endpoint of the _claim_sources of the tokens with a groups overage
+	MemberObjectsPath = "/v1.0/users/some-object-id/getMemberObjects"
+	// MemberOfPath is a Graph-compatible memberOf endpoint, which lists the OverageGroups over two pages
+	MemberOfPath = "/v1.0/me/memberOf"
+	// KeysPath is the jwks_uri serving the key the tokens are signed with
+	KeysPath = "/discovery/v2.0/keys"
+
+	// ServerApplicationID is the audience of the access tokens requested for one of its api:// scopes
+	ServerApplicationID = "some-server-application-id"
+	// GraphAudience is the audience of the access tokens requested for other scopes only, e.g. openid and email,
+	// which Azure AD issues for Microsoft Graph
+	GraphAudience = "00000003-0000-0000-c000-000000000000"
+	// RefreshToken is the refresh token of the logins, redeemed for the tokens of other scopes
+	RefreshToken = "MOCKREFRESHTOKEN"
+	signingKeyID = "oidctest-key"
 )
 
+// IDTokenRoles are the roles claim of the id tokens
+var IDTokenRoles = []string{"cluster-viewers"}
+
+// OverageGroups are the groups of the user listed by the Graph-compatible endpoints
+var OverageGroups = []string{
+	"0a1b2c3d-0000-0000-0000-000000000001",
+	"0a1b2c3d-0000-0000-0000-000000000002",
+	"0a1b2c3d-0000-0000-0000-000000000003",
+}
+
 // Server holds the interface to a mocked OIDC server
 type Server interface {
 	RequestCount(endpoint string) int
+	// SetGroupsOverage issues tokens without groups, that point to the MemberObjectsPath to list them instead
+	SetGroupsOverage(overage bool)
+	// SetDeviceFlow advertises the DeviceAuthorizationPath in the well-known config, or not
+	SetDeviceFlow(enabled bool)
+	// SetExpiredTokens issues tokens that expired an hour ago, past the leeway of the clients
+	SetExpiredTokens(expired bool)
+	// SetRefreshTokens returns the RefreshToken with the tokens of the logins, or not
+	SetRefreshTokens(enabled bool)
 	Reset()
 	Stop()
 }
 
 func (m *mockOidcServer) Reset() {
 	m.requestCount = initialiseRequestStates()
+	m.groupsOverage = false
+	m.deviceFlow = true
+	m.expiredTokens = false
+	m.refreshTokens = true
+	m.scopes = ""
+}
+
+func (m *mockOidcServer) SetGroupsOverage(overage bool) {
+	m.groupsOverage = overage
+}
+
+func (m *mockOidcServer) SetDeviceFlow(enabled bool) {
+	m.deviceFlow = enabled
+}
+
+func (m *mockOidcServer) SetExpiredTokens(expired bool) {
+	m.expiredTokens = expired
+}
+
+func (m *mockOidcServer) SetRefreshTokens(enabled bool) {
+	m.refreshTokens = enabled
 }
 
 func (m *mockOidcServer) RequestCount(endpoint string) int {
@@ -45,13 +109,21 @@ type mockOidcServer struct {
 	httpServer               *http.Server
 	requestCount             map[string]int
 	mux                      *http.ServeMux
+	groupsOverage            bool
+	deviceFlow               bool
+	expiredTokens            bool
+	refreshTokens            bool
+	signingKey               *rsa.PrivateKey
+	// scopes are the ones of the last authorization or device request, which the tokens are issued for
+	scopes string
 }
 
 type wellKnownConfig struct {
 	Issuer                string `json:"issuer"`
 	AuthorizationEndpoint string `json:"authorization_endpoint"`
 	TokenEndpoint         string `json:"token_endpoint"`
-	DeviceEndpoint        string `json:"device_endpoint"`
+	DeviceEndpoint        string `json:"device_authorization_endpoint,omitempty"`
+	JWKSURI               string `json:"jwks_uri"`
 }
 
 func setup(m *mockOidcServer) *http.Server {
@@ -65,8 +137,10 @@ func setup(m *mockOidcServer) *http.Server {
 func initialiseRequestStates() map[string]int {
 	endpoints := []string{
 		"/v2.0/token",
-		"/v2.0/devicecode",
+		DeviceAuthorizationPath,
 		"/v2.0/authorize",
+		MemberObjectsPath,
+		MemberOfPath,
 	}
 	requestStates := make(map[string]int)
 
@@ -81,11 +155,18 @@ const wellKnownConfigurationURI = "/v2.0/.well-known/openid-configuration"
 
 // Start returns and starts a new OIDC test server server
 func Start(host string, port int) (Server, error) {
+	signingKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, fmt.Errorf("unable to generate the signing key: %w", err)
+	}
 	server := &mockOidcServer{
 		IssuerURL:                fmt.Sprintf("%s:%d", host, port),
 		DeviceFlowRequestPending: false,
 		requestCount:             initialiseRequestStates(),
 		mux:                      http.NewServeMux(),
+		deviceFlow:               true,
+		refreshTokens:            true,
+		signingKey:               signingKey,
 	}
 	server.httpServer = &http.Server{
 		Addr:      server.IssuerURL,
@@ -96,7 +177,10 @@ func Start(host string, port int) (Server, error) {
 	server.mux.Handle(wellKnownConfigurationURI, handleWellKnownConfigRequest(server))
 	server.mux.Handle("/v2.0/authorize", handleAuthorizeRequest(server))
 	server.mux.Handle("/v2.0/token", handleTokenRequest(server))
-	server.mux.Handle("/v2.0/devicecode", handleDeviceCodeFlowRequest(server))
+	server.mux.Handle(DeviceAuthorizationPath, handleDeviceCodeFlowRequest(server))
+	server.mux.Handle(MemberObjectsPath, handleMemberObjectsRequest(server))
+	server.mux.Handle(MemberOfPath, handleMemberOfRequest(server))
+	server.mux.Handle(KeysPath, handleKeysRequest(server))
 
 	go func() {
 		if err := server.httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
@@ -116,12 +200,18 @@ func handleDeviceCodeFlowRequest(m *mockOidcServer) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		deviceCode := "MOCKDEVICECODE"
 		defer r.Body.Close()
+		m.requestCount[r.URL.Path]++
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
 
 		_ = r.ParseForm()
+		m.scopes = r.FormValue("scope")
 		clientID := r.FormValue("client_id")
 		if clientID != "" {
 			switch clientID {
-			case "invalid_client_id":
+			case "invalid_client_id", "access_denied_client_id":
 				deviceCode = "invalid_device_code"
 			case "expired_client_id":
 				deviceCode = "expired_token_device_code"
@@ -134,13 +224,14 @@ func handleDeviceCodeFlowRequest(m *mockOidcServer) http.HandlerFunc {
 			}
 		}
 
+		verificationURI := fmt.Sprintf("http://%s/device", m.IssuerURL)
 		deviceFlowResponse := &oidc.DeviceFlowAuth{
-			UserCode:        "mock-user-code",
-			DeviceCode:      deviceCode,
-			VerificationURI: fmt.Sprintf("https://%s/v2.0/devicecode-auth", m.IssuerURL),
-			Message:         fmt.Sprintf("[Osprey Test Suite] Visit https://%s/v2.0/devicecode-auth and enter the code: testing123", m.IssuerURL),
-			ExpiresIn:       0,
-			Interval:        1,
+			UserCode:                DeviceUserCode,
+			DeviceCode:              deviceCode,
+			VerificationURI:         verificationURI,
+			VerificationURIComplete: fmt.Sprintf("%s?user_code=%s", verificationURI, DeviceUserCode),
+			ExpiresIn:               900,
+			Interval:                1,
 		}
 		m.DeviceFlowRequestPending = true
 		resp, _ := json.Marshal(deviceFlowResponse)
@@ -153,28 +244,96 @@ type errorResponse struct {
 	Error string `json:"error"`
 }
 
+// accessTokenAudience returns the audience of the access tokens issued for the scopes
+func accessTokenAudience(scopes string) string {
+	for _, scope := range strings.Fields(scopes) {
+		if strings.HasPrefix(scope, "api://") {
+			return ServerApplicationID
+		}
+	}
+	return GraphAudience
+}
+
+// signedToken signs the claims with the key of the jwks_uri
+func (m *mockOidcServer) signedToken(claims jwt.MapClaims) string {
+	fakeJWT := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	fakeJWT.Header["kid"] = signingKeyID
+	tokenString, _ := fakeJWT.SignedString(m.signingKey)
+	return tokenString
+}
+
+// graphAuthorized returns true if the request has a bearer token of the mock for the GraphAudience
+func (m *mockOidcServer) graphAuthorized(r *http.Request) bool {
+	bearer := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(bearer, claims, func(*jwt.Token) (interface{}, error) {
+		return &m.signingKey.PublicKey, nil
+	})
+	return err == nil && claims.VerifyAudience(GraphAudience, true)
+}
+
 func handleTokenRequest(m *mockOidcServer) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		fakeJWT := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-			"aud":         "osprey-tests",
+		_ = r.ParseForm()
+		clientID, _, ok := r.BasicAuth()
+		if !ok {
+			clientID = r.FormValue("client_id")
+		}
+		// the tokens are for the scopes of the login, or the ones requested with its refresh token
+		scopes := m.scopes
+		if r.FormValue("grant_type") == "refresh_token" {
+			if r.FormValue("refresh_token") != RefreshToken {
+				w.Header().Add("Content-Type", "application/json")
+				w.WriteHeader(http.StatusBadRequest)
+				resp, _ := json.Marshal(&errorResponse{"invalid_grant"})
+				w.Write(resp)
+				return
+			}
+			scopes = r.FormValue("scope")
+		}
+		expiry := time.Now().Add(time.Hour)
+		if m.expiredTokens {
+			expiry = time.Now().Add(-time.Hour)
+		}
+		claims := jwt.MapClaims{
+			"iss":         m.issuer(),
+			"aud":         accessTokenAudience(scopes),
+			"exp":         expiry.Unix(),
 			"family_name": "Doe",
 			"given_name":  "John",
 			"name":        "Doe, John",
 			"unique_name": "john.doe@osprey.org",
 			"scp":         "offline_access openid profile User.Read",
 			"nbf":         time.Date(2015, 10, 10, 12, 0, 0, 0, time.UTC).Unix(),
-		})
-
-		// Sign and get the complete encoded token as a string using the secret
-		tokenString, _ := fakeJWT.SignedString([]byte("super-secret"))
+		}
+		if m.groupsOverage {
+			claims["_claim_names"] = map[string]string{"groups": "src1"}
+			claims["_claim_sources"] = map[string]interface{}{
+				"src1": map[string]string{"endpoint": fmt.Sprintf("http://%s%s", m.IssuerURL, MemberObjectsPath)},
+			}
+		}
+		// the id token is for the client itself, with the claims of the openid, profile and email scopes
+		idClaims := jwt.MapClaims{
+			"iss":                m.issuer(),
+			"aud":                clientID,
+			"exp":                expiry.Unix(),
+			"name":               "Doe, John",
+			"email":              "john.doe@osprey.org",
+			"preferred_username": "jdoe",
+			"roles":              IDTokenRoles,
+		}
 
-		token := &oauth2.Token{
-			AccessToken: tokenString,
-			Expiry:      time.Now().Add(time.Hour),
+		response := map[string]interface{}{
+			"access_token": m.signedToken(claims),
+			"id_token":     m.signedToken(idClaims),
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+		}
+		if m.refreshTokens {
+			response["refresh_token"] = RefreshToken
 		}
-		resp, _ := json.Marshal(token)
+		resp, _ := json.Marshal(response)
 
-		_ = r.ParseForm()
 		deviceCode := r.FormValue("device_code")
 		if deviceCode != "" {
 			switch deviceCode {
@@ -212,10 +371,13 @@ func handleWellKnownConfigRequest(m *mockOidcServer) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		defer r.Body.Close()
 		config := &wellKnownConfig{
-			Issuer:                m.IssuerURL,
+			Issuer:                m.issuer(),
 			AuthorizationEndpoint: fmt.Sprintf("http://%s/v2.0/authorize", m.IssuerURL),
 			TokenEndpoint:         fmt.Sprintf("http://%s/v2.0/token", m.IssuerURL),
-			DeviceEndpoint:        fmt.Sprintf("http://%s/v2.0/devicecode", m.IssuerURL),
+			JWKSURI:               fmt.Sprintf("http://%s%s", m.IssuerURL, KeysPath),
+		}
+		if m.deviceFlow {
+			config.DeviceEndpoint = fmt.Sprintf("http://%s%s", m.IssuerURL, DeviceAuthorizationPath)
 		}
 		resp, err := json.Marshal(config)
 		if err != nil {
@@ -228,10 +390,33 @@ func handleWellKnownConfigRequest(m *mockOidcServer) http.HandlerFunc {
 	}
 }
 
+// issuer is the issuer of the tokens, as advertised by the well-known config
+func (m *mockOidcServer) issuer() string {
+	return fmt.Sprintf("http://%s/v2.0", m.IssuerURL)
+}
+
+func handleKeysRequest(m *mockOidcServer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		key := map[string]string{
+			"kty": "RSA",
+			"use": "sig",
+			"alg": "RS256",
+			"kid": signingKeyID,
+			"n":   base64.RawURLEncoding.EncodeToString(m.signingKey.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(m.signingKey.E)).Bytes()),
+		}
+		resp, _ := json.Marshal(map[string]interface{}{"keys": []map[string]string{key}})
+		w.Header().Add("Content-Type", "application/json")
+		w.Write(resp)
+	}
+}
+
 func handleAuthorizeRequest(m *mockOidcServer) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		defer r.Body.Close()
-		if err := returnAuthRequest(r.URL.Query().Get("redirect_uri")); err != nil {
+		m.scopes = r.URL.Query().Get("scope")
+		if err := returnAuthRequest(r.URL.Query().Get("redirect_uri"), r.URL.Query().Get("state")); err != nil {
 			log.Errorf("unable to send login response: %v", err)
 			log.Errorf("values: %v", r)
 			w.WriteHeader(http.StatusBadRequest)
@@ -240,8 +425,11 @@ func handleAuthorizeRequest(m *mockOidcServer) http.HandlerFunc {
 	}
 }
 
-func returnAuthRequest(callbackURL string) error {
-	successfulLoginResponse, _ := url.Parse(fmt.Sprintf("%s?state=%s&code=AWORKINGJTW", callbackURL, ospreyState))
+func returnAuthRequest(callbackURL, state string) error {
+	if state == "" {
+		state = ospreyState
+	}
+	successfulLoginResponse, _ := url.Parse(fmt.Sprintf("%s?state=%s&code=AWORKINGJTW", callbackURL, url.QueryEscape(state)))
 	resp, err := http.PostForm(successfulLoginResponse.String(), nil)
 	if err != nil {
 		return fmt.Errorf("unable to post form: %w", err)
@@ -258,3 +446,52 @@ func returnAuthRequest(callbackURL string) error {
 	}
 	return nil
 }
+
+func handleMemberObjectsRequest(m *mockOidcServer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		m.requestCount[r.URL.Path]++
+		if r.Method != http.MethodPost || !m.graphAuthorized(r) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		resp, _ := json.Marshal(map[string][]string{"value": OverageGroups})
+		w.Header().Add("Content-Type", "application/json")
+		w.Write(resp)
+	}
+}
+
+type directoryObject struct {
+	Type string `json:"@odata.type"`
+	ID   string `json:"id"`
+}
+
+func handleMemberOfRequest(m *mockOidcServer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		m.requestCount[r.URL.Path]++
+		if r.Method != http.MethodGet || !m.graphAuthorized(r) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		// the first page also lists a role, which isn't a group
+		page := struct {
+			Value    []directoryObject `json:"value"`
+			NextLink string            `json:"@odata.nextLink,omitempty"`
+		}{
+			Value: []directoryObject{
+				{Type: "#microsoft.graph.group", ID: OverageGroups[0]},
+				{Type: "#microsoft.graph.directoryRole", ID: "some-role-id"},
+				{Type: "#microsoft.graph.group", ID: OverageGroups[1]},
+			},
+			NextLink: fmt.Sprintf("http://%s%s?$skiptoken=page2", m.IssuerURL, MemberOfPath),
+		}
+		if r.URL.Query().Get("$skiptoken") == "page2" {
+			page.Value = []directoryObject{{Type: "#microsoft.graph.group", ID: OverageGroups[2]}}
+			page.NextLink = ""
+		}
+		resp, _ := json.Marshal(page)
+		w.Header().Add("Content-Type", "application/json")
+		w.Write(resp)
+	}
+}
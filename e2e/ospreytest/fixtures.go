@@ -1,6 +1,7 @@
 package ospreytest
 
 import (
+	"encoding/json"
 	"fmt"
 
 	"io/ioutil"
@@ -9,8 +10,10 @@ import (
 
 	"github.com/SermoDigital/jose/jws"
 	"github.com/SermoDigital/jose/jwt"
+	"github.com/sky-uk/osprey/v2/client"
 	"github.com/sky-uk/osprey/v2/common/web"
 	"github.com/sky-uk/osprey/v2/server/osprey"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/tools/clientcmd"
 	clientgo "k8s.io/client-go/tools/clientcmd/api"
 )
@@ -39,19 +42,27 @@ func AddCustomNamespaceToContexts(namespaceSuffix, kubeconfig string, targetedOs
 	return nil
 }
 
+// ownerExtensions returns the extensions of the kubeconfig entries written for the TestOsprey instance's target of
+// the ospreyconfig file.
+func (o *TestOsprey) ownerExtensions(ospreyconfigFile string) map[string]runtime.Object {
+	owner, _ := json.Marshal(client.KubeconfigOwner{Config: ospreyconfigFile, Target: o.OspreyconfigTargetName()})
+	return map[string]runtime.Object{"osprey": &runtime.Unknown{Raw: owner, ContentType: runtime.ContentTypeJSON}}
+}
+
 // ToKubeconfigCluster returns a *Cluster representation of the TestOsprey instance.
-func (o *TestOsprey) ToKubeconfigCluster(locationOfOrigin string) *clientgo.Cluster {
+func (o *TestOsprey) ToKubeconfigCluster(locationOfOrigin, ospreyconfigFile string) *clientgo.Cluster {
 	apiServer := fmt.Sprintf("https://apiserver.%s.cluster", o.Environment)
 	caData, _ := ioutil.ReadFile(o.APIServerCA)
 	expectedCluster := clientgo.NewCluster()
 	expectedCluster.LocationOfOrigin = locationOfOrigin
+	expectedCluster.Extensions = o.ownerExtensions(ospreyconfigFile)
 	expectedCluster.Server = apiServer
 	expectedCluster.CertificateAuthorityData = caData
 	return expectedCluster
 }
 
 // ToKubeconfigUserWithoutToken returns an *AuthInfo representation, with an empty id-token, of the TestOsprey instance.
-func (o *TestOsprey) ToKubeconfigUserWithoutToken(locationOfOrigin string) *clientgo.AuthInfo {
+func (o *TestOsprey) ToKubeconfigUserWithoutToken(locationOfOrigin, ospreyconfigFile string) *clientgo.AuthInfo {
 	caData, _ := osprey.ReadAndEncodeFile(o.IssuerCA)
 	authInfo := clientgo.NewAuthInfo()
 	authProviderConfig := make(map[string]string)
@@ -63,6 +74,7 @@ func (o *TestOsprey) ToKubeconfigUserWithoutToken(locationOfOrigin string) *clie
 	authProviderConfig["client-id"] = o.Environment
 	authInfo.ImpersonateUserExtra = nil
 	authInfo.LocationOfOrigin = locationOfOrigin
+	authInfo.Extensions = o.ownerExtensions(ospreyconfigFile)
 	authInfo.AuthProvider = &clientgo.AuthProviderConfig{
 		Name:   "oidc",
 		Config: authProviderConfig,
@@ -103,13 +115,14 @@ func (o *TestOsprey) OspreyconfigAliasName() string {
 }
 
 // ToKubeconfigContext returns a *Context representation of the TestOsprey instance.
-func (o *TestOsprey) ToKubeconfigContext(locationOfOrigin string) *clientgo.Context {
+func (o *TestOsprey) ToKubeconfigContext(locationOfOrigin, ospreyconfigFile string) *clientgo.Context {
 	targetName := o.OspreyconfigTargetName()
 
 	kubeconfigCtx := clientgo.NewContext()
 	kubeconfigCtx.Cluster = targetName
 	kubeconfigCtx.AuthInfo = targetName
 	kubeconfigCtx.LocationOfOrigin = locationOfOrigin
+	kubeconfigCtx.Extensions = o.ownerExtensions(ospreyconfigFile)
 
 	return kubeconfigCtx
 }
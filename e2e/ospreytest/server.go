@@ -13,6 +13,7 @@ import (
 	"github.com/sky-uk/osprey/v2/common/web"
 	"github.com/sky-uk/osprey/v2/e2e/clitest"
 	"github.com/sky-uk/osprey/v2/e2e/dextest"
+	"github.com/sky-uk/osprey/v2/e2e/oidctest"
 	"github.com/sky-uk/osprey/v2/e2e/ssltest"
 	"github.com/sky-uk/osprey/v2/e2e/util"
 	"go.uber.org/multierr"
@@ -35,14 +36,26 @@ type TestOsprey struct {
 	KeyFile      string
 	CertFile     string
 	TestDir      string
+	IPFamily     string
+	ClientCA     string
+}
+
+// ServerOptions holds the optional flags of a TestOsprey server
+type ServerOptions struct {
+	// IPFamily is the IP version used to connect to the issuer
+	IPFamily string
+	// ClientCA is the path to the CA of the client certificates required by /access-token
+	ClientCA string
 }
 
 // TestConfig represents an Osprey client configuration file used for testing.
 type TestConfig struct {
 	*client.Config
 	LegacyConfig     *client.ConfigV1
+	V2Config         *client.ConfigV2
 	ConfigFile       string
 	LegacyConfigFile string
+	V2ConfigFile     string
 }
 
 // StartOspreys creates one Osprey test server per TestDex provided, using ports starting from portsFrom.
@@ -58,6 +71,12 @@ func StartOspreys(testDir string, dexes []*dextest.TestDex, portsFrom int32) ([]
 // Start creates one Osprey test server for the dex Server.
 // Its directory will be testDir/dex.Environment
 func Start(testDir string, useTLS bool, port int32, dex *dextest.TestDex) *TestOsprey {
+	return StartWithOptions(testDir, useTLS, port, dex, ServerOptions{})
+}
+
+// StartWithOptions creates one Osprey test server for the dex Server with the optional flags in options.
+// Its directory will be testDir/dex.Environment
+func StartWithOptions(testDir string, useTLS bool, port int32, dex *dextest.TestDex, options ServerOptions) *TestOsprey {
 	ospreyDir := fmt.Sprintf("%s/%s", testDir, dex.Environment)
 	serverDir := filepath.Join(ospreyDir, "osprey")
 	ospreyCert, ospreyKey := ssltest.CreateCertificates("localhost", serverDir)
@@ -77,6 +96,8 @@ func Start(testDir string, useTLS bool, port int32, dex *dextest.TestDex) *TestO
 		IssuerURL:    issuerHost,
 		IssuerCA:     dex.DexCA,
 		TestDir:      serverDir,
+		IPFamily:     options.IPFamily,
+		ClientCA:     options.ClientCA,
 	}
 	if useTLS {
 		server.KeyFile = ospreyKey
@@ -102,9 +123,16 @@ func (o *TestOsprey) buildArgs() []string {
 	tlsKeyFlag := "--tls-key=" + o.KeyFile
 	tlsCertFlag := "--tls-cert=" + o.CertFile
 	serveClusterInfoFlag := "--serve-cluster-info=true"
-	return []string{"serve", "auth", "-X",
+	args := []string{"serve", "auth", "-X",
 		portFlag, envFlag, secretFlag, apiServerURLFlag, apiServerCAFlag, redirectURLFlag,
 		issuerURLFlag, issuerCAFlag, tlsKeyFlag, tlsCertFlag, serveClusterInfoFlag}
+	if o.IPFamily != "" {
+		args = append(args, "--ip-family="+o.IPFamily)
+	}
+	if o.ClientCA != "" {
+		args = append(args, "--client-ca="+o.ClientCA)
+	}
+	return args
 }
 
 // Stop stops the TestOsprey server.
@@ -146,15 +174,21 @@ func BuildFullConfig(testDir, providerName, defaultGroup string,
 	caData bool, caPath, clientID, apiServerURL string, useGKEClientConfig bool) (*TestConfig, error) {
 	config := &client.Config{
 		Kubeconfig:   fmt.Sprintf("%s/.kube/config", testDir),
-		APIVersion:   "v2",
+		APIVersion:   client.ConfigVersionV3,
 		DefaultGroup: defaultGroup,
 	}
 	configV1 := &client.ConfigV1{
 		Kubeconfig:   fmt.Sprintf("%s/.kube/configv1", testDir),
 		DefaultGroup: defaultGroup,
 	}
+	configV2 := &client.ConfigV2{
+		Kubeconfig:   fmt.Sprintf("%s/.kube/configv2", testDir),
+		APIVersion:   client.ConfigVersionV2,
+		DefaultGroup: defaultGroup,
+	}
 	ospreyconfigFile := fmt.Sprintf("%s/.osprey/config", testDir)
 	legacyOspreyconfigFile := fmt.Sprintf("%s/.osprey/configv1", testDir)
+	v2OspreyconfigFile := fmt.Sprintf("%s/.osprey/configv2", testDir)
 
 	targets := make(map[string]*client.TargetEntry)
 	var certData string
@@ -167,6 +201,7 @@ func BuildFullConfig(testDir, providerName, defaultGroup string,
 
 		target := &client.TargetEntry{
 			Aliases: []string{osprey.OspreyconfigAliasName()},
+			Labels:  map[string]string{"env": osprey.Environment},
 		}
 
 		target.UseGKEClientConfig = useGKEClientConfig
@@ -180,7 +215,8 @@ func BuildFullConfig(testDir, providerName, defaultGroup string,
 
 		if caData {
 			ospreyconfigFile = fmt.Sprintf("%s/.osprey/config-data", testDir)
-			legacyOspreyconfigFile = fmt.Sprintf("%s/.osprey/config-data", testDir)
+			legacyOspreyconfigFile = fmt.Sprintf("%s/.osprey/configv1-data", testDir)
+			v2OspreyconfigFile = fmt.Sprintf("%s/.osprey/configv2-data", testDir)
 			certData, err = web.LoadTLSCert(osprey.CertFile)
 			if err != nil {
 				return nil, err
@@ -206,18 +242,39 @@ func BuildFullConfig(testDir, providerName, defaultGroup string,
 			RedirectURI:         "http://localhost:65525/auth/callback",
 			Scopes:              []string{"api://some-dummy-scope"},
 			AzureTenantID:       "some-tenant-id",
-			ServerApplicationID: "some-server-application-id",
+			ServerApplicationID: oidctest.ServerApplicationID,
 			IssuerURL:           "http://localhost:14980",
 			Targets:             targets,
 		}
-		config.Providers = &client.Providers{
+		config.Providers = []*client.ProviderEntry{
+			{
+				Type: client.AzureProviderName,
+				Azure: &client.AzureOptions{
+					ClientID:            azureConfig.ClientID,
+					ClientSecret:        azureConfig.ClientSecret,
+					RedirectURI:         azureConfig.RedirectURI,
+					Scopes:              azureConfig.Scopes,
+					AzureTenantID:       azureConfig.AzureTenantID,
+					ServerApplicationID: azureConfig.ServerApplicationID,
+					IssuerURL:           azureConfig.IssuerURL,
+				},
+				Targets: targets,
+			},
+		}
+		configV2.Providers = &client.ProvidersV2{
 			Azure: []*client.AzureConfig{azureConfig},
 		}
 		configV1.Providers = &client.ProvidersV1{
 			Azure: azureConfig,
 		}
 	case client.OspreyProviderName:
-		config.Providers = &client.Providers{
+		config.Providers = []*client.ProviderEntry{
+			{
+				Type:    client.OspreyProviderName,
+				Targets: targets,
+			},
+		}
+		configV2.Providers = &client.ProvidersV2{
 			Osprey: []*client.OspreyConfig{
 				{
 					//CertificateAuthority: caPath,
@@ -228,10 +285,12 @@ func BuildFullConfig(testDir, providerName, defaultGroup string,
 		configV1.Providers = &client.ProvidersV1{Osprey: &client.OspreyConfig{Targets: targets}}
 	}
 
-	testConfig := &TestConfig{Config: config, LegacyConfig: configV1, ConfigFile: ospreyconfigFile, LegacyConfigFile: legacyOspreyconfigFile}
+	testConfig := &TestConfig{Config: config, LegacyConfig: configV1, V2Config: configV2,
+		ConfigFile: ospreyconfigFile, LegacyConfigFile: legacyOspreyconfigFile, V2ConfigFile: v2OspreyconfigFile}
 	err1 := SaveConfig(config, ospreyconfigFile)
 	err2 := SaveConfig(configV1, legacyOspreyconfigFile)
-	return testConfig, multierr.Combine(err1, err2)
+	err3 := SaveConfig(configV2, v2OspreyconfigFile)
+	return testConfig, multierr.Combine(err1, err2, err3)
 }
 
 // SaveConfig writes the osprey config to the specified path.
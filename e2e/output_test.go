@@ -0,0 +1,125 @@
+package e2e
+
+import (
+	"encoding/json"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/sky-uk/osprey/v2/e2e/ospreytest"
+	"gopkg.in/yaml.v2"
+)
+
+var _ = Describe("Structured output", func() {
+	BeforeEach(func() {
+		resetDefaults()
+	})
+
+	JustBeforeEach(func() {
+		setupClientForEnvironments(ospreyProviderName, environmentsToUse, "", "", false)
+	})
+
+	AfterEach(func() {
+		cleanup()
+	})
+
+	It("rejects unsupported output formats", func() {
+		targets := Client("config", "targets", ospreyconfigFlag, "--output=xml")
+		targets.RunAndAssertFailure()
+
+		Expect(targets.GetOutput()).To(ContainSubstring(`Unsupported output format "xml"`))
+	})
+
+	It("prints the targets as json", func() {
+		targets := Client("config", "targets", ospreyconfigFlag, "--output=json")
+		targets.RunAndAssertSuccess()
+
+		var result struct {
+			Targets []struct {
+				Name         string   `json:"name"`
+				Aliases      []string `json:"aliases"`
+				Groups       []string `json:"groups"`
+				ProviderType string   `json:"providerType"`
+				Server       string   `json:"server"`
+				CASource     string   `json:"caSource"`
+				Default      bool     `json:"default"`
+			} `json:"targets"`
+		}
+		Expect(json.Unmarshal([]byte(targets.GetStdout()), &result)).To(Succeed(), targets.GetStdout())
+		Expect(result.Targets).To(HaveLen(len(environmentsToUse)))
+		for _, target := range result.Targets {
+			Expect(target.ProviderType).To(Equal(ospreyProviderName))
+			Expect(target.Server).ToNot(BeEmpty())
+			Expect(target.CASource).To(HavePrefix("certificate-authority"))
+			Expect(target.Default).To(Equal(target.Name == OspreyconfigTargetName("local")))
+		}
+	})
+
+	It("prints the groups as yaml", func() {
+		targets := Client("config", "targets", ospreyconfigFlag, "--list-groups", "--output=yaml")
+		targets.RunAndAssertSuccess()
+
+		var result struct {
+			Groups []struct {
+				Name    string        `yaml:"name"`
+				Default bool          `yaml:"default"`
+				Targets []interface{} `yaml:"targets"`
+			} `yaml:"groups"`
+		}
+		Expect(yaml.Unmarshal([]byte(targets.GetStdout()), &result)).To(Succeed(), targets.GetStdout())
+		var names []string
+		for _, group := range result.Groups {
+			names = append(names, group.Name)
+			Expect(group.Default).To(Equal(group.Name == ""))
+			Expect(group.Targets).To(BeEmpty())
+		}
+		Expect(names).To(ConsistOf("", "development", "production", "sandbox"))
+	})
+
+	It("prints the login and user results as json", func() {
+		login := Client("user", "login", ospreyconfigFlag, "--username=jane", "--password=foo", "--output=json")
+		login.RunAndAssertSuccess()
+
+		var loginResults []struct {
+			Target       string `json:"target"`
+			Username     string `json:"username"`
+			APIServerURL string `json:"apiServerURL"`
+			Success      bool   `json:"success"`
+		}
+		Expect(json.Unmarshal([]byte(login.GetStdout()), &loginResults)).To(Succeed(), login.GetStdout())
+		Expect(loginResults).To(HaveLen(len(targetedOspreys)))
+		for _, result := range loginResults {
+			Expect(result.Success).To(BeTrue())
+			Expect(result.Username).To(Equal("janedoe@example.com"))
+			Expect(result.APIServerURL).ToNot(BeEmpty())
+		}
+
+		user := Client("user", ospreyconfigFlag, "--output=json")
+		user.RunAndAssertSuccess()
+
+		var userResults []struct {
+			Target   string   `json:"target"`
+			LoggedIn bool     `json:"loggedIn"`
+			Username string   `json:"username"`
+			Roles    []string `json:"roles"`
+		}
+		Expect(json.Unmarshal([]byte(user.GetStdout()), &userResults)).To(Succeed(), user.GetStdout())
+		Expect(userResults).To(HaveLen(len(targetedOspreys)))
+		for _, result := range userResults {
+			Expect(result.LoggedIn).To(BeTrue())
+			Expect(result.Username).To(Equal("janedoe@example.com"))
+			Expect(result.Roles).To(ConsistOf("admins", "developers"))
+		}
+	})
+
+	It("prints the logout results as yaml", func() {
+		logout := Client("user", "logout", ospreyconfigFlag, "--output=yaml")
+		logout.RunAndAssertSuccess()
+
+		var logoutResults []struct {
+			Target  string `yaml:"target"`
+			Success bool   `yaml:"success"`
+		}
+		Expect(yaml.Unmarshal([]byte(logout.GetStdout()), &logoutResults)).To(Succeed(), logout.GetStdout())
+		Expect(logoutResults).To(HaveLen(len(targetedOspreys)))
+	})
+})
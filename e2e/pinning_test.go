@@ -0,0 +1,138 @@
+package e2e
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/sky-uk/osprey/v2/common/web"
+	. "github.com/sky-uk/osprey/v2/e2e/ospreytest"
+)
+
+var _ = Describe("Public key pinning", func() {
+	const otherPin = "sha256/47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU="
+
+	var (
+		configFile string
+		serverPin  string
+	)
+
+	writeServerConfig := func(server string, skipTLSVerify bool, pins ...string) {
+		config := fmt.Sprintf(`apiVersion: v3
+kubeconfig: %s
+providers:
+  - type: osprey
+    certificate-authority: %s
+    targets:
+      pinned:
+        server: %s
+        skip-tls-verify: %t
+        pinned-public-keys: [%s]
+`, ospreyconfig.Kubeconfig, ospreys[0].CertFile, server, skipTLSVerify, strings.Join(pins, ", "))
+		configFile = filepath.Join(testDir, "pinning-config")
+		Expect(ioutil.WriteFile(configFile, []byte(config), 0644)).To(Succeed())
+	}
+
+	writeConfig := func(pins ...string) {
+		writeServerConfig(ospreys[0].URL, false, pins...)
+	}
+
+	BeforeEach(func() {
+		resetDefaults()
+		setupClientForEnvironments(ospreyProviderName, environmentsToUse, "", "", false)
+
+		certData, err := ioutil.ReadFile(ospreys[0].CertFile)
+		Expect(err).To(BeNil(), "reads the osprey certificate")
+		block, _ := pem.Decode(certData)
+		cert, err := x509.ParseCertificate(block.Bytes)
+		Expect(err).To(BeNil(), "parses the osprey certificate")
+		serverPin = web.PublicKeyPin(cert)
+	})
+
+	AfterEach(func() {
+		cleanup()
+	})
+
+	It("logs in when the server's key is pinned", func() {
+		writeConfig(serverPin)
+		Client("user", "login", "--ospreyconfig="+configFile, "--username=jane", "--password=foo").RunAndAssertSuccess()
+	})
+
+	It("logs in when the server's key is a backup pin", func() {
+		writeConfig(otherPin, serverPin)
+		Client("user", "login", "--ospreyconfig="+configFile, "--username=jane", "--password=foo").RunAndAssertSuccess()
+	})
+
+	It("fails to log in when the server's key is not pinned", func() {
+		writeConfig(otherPin)
+		login := Client("user", "login", "--ospreyconfig="+configFile, "--username=jane", "--password=foo")
+		login.RunAndAssertFailure()
+
+		Expect(login.GetOutput()).To(ContainSubstring("public key pinning failed"))
+		Expect(login.GetOutput()).To(ContainSubstring(serverPin), "names the server's key")
+	})
+
+	It("only matches the server's own certificate when the chain is not verified", func() {
+		// the server sends its own certificate along with the pinned one, which it does not hold the key of
+		leafKey, err := rsa.GenerateKey(rand.Reader, 2048)
+		Expect(err).To(BeNil(), "generates the server key")
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(2),
+			Subject:      pkix.Name{CommonName: "localhost"},
+			DNSNames:     []string{"localhost"},
+			NotBefore:    time.Now(),
+			NotAfter:     time.Now().Add(time.Hour),
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+			KeyUsage:     x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
+		}
+		leaf, err := x509.CreateCertificate(rand.Reader, template, template, &leafKey.PublicKey, leafKey)
+		Expect(err).To(BeNil(), "creates the server certificate")
+		certData, err := ioutil.ReadFile(ospreys[0].CertFile)
+		Expect(err).To(BeNil(), "reads the osprey certificate")
+		pinnedCert, _ := pem.Decode(certData)
+
+		server := httptest.NewUnstartedServer(http.NotFoundHandler())
+		server.TLS = &tls.Config{Certificates: []tls.Certificate{
+			{Certificate: [][]byte{leaf, pinnedCert.Bytes}, PrivateKey: leafKey},
+		}}
+		server.StartTLS()
+		defer server.Close()
+
+		writeServerConfig(server.URL, true, serverPin)
+		login := Client("user", "login", "--ospreyconfig="+configFile, "--username=jane", "--password=foo")
+		login.RunAndAssertFailure()
+
+		Expect(login.GetOutput()).To(ContainSubstring("public key pinning failed"))
+		Expect(login.GetOutput()).NotTo(ContainSubstring(serverPin), "ignores the certificates after the server's")
+	})
+
+	It("diagnoses the pinning mismatch", func() {
+		writeConfig(otherPin)
+		doctor := Client("doctor", "--ospreyconfig="+configFile, "--all")
+		doctor.RunAndAssertFailure()
+
+		Expect(doctor.GetStdout()).To(MatchRegexp(`\[failed\]\s+pinning\s`))
+		Expect(doctor.GetStdout()).To(ContainSubstring("add the new pin to pinned-public-keys"))
+	})
+
+	It("rejects invalid pins", func() {
+		writeConfig("sha1/AAAA")
+		targets := Client("config", "targets", "--ospreyconfig="+configFile)
+		targets.RunAndAssertFailure()
+
+		Expect(targets.GetOutput()).To(ContainSubstring("must start with sha256/"))
+	})
+})
@@ -0,0 +1,97 @@
+package e2e
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/sky-uk/osprey/v2/client"
+	"github.com/sky-uk/osprey/v2/client/kubeconfig"
+	. "github.com/sky-uk/osprey/v2/e2e/ospreytest"
+)
+
+var _ = Describe("Profiles", func() {
+	var target, alias string
+
+	BeforeEach(func() {
+		resetDefaults()
+		target = OspreyconfigTargetName("local")
+		alias = OspreyconfigAliasName("local")
+	})
+
+	JustBeforeEach(func() {
+		setupClientForEnvironments(ospreyProviderName, environmentsToUse, "", "", false)
+		ospreyconfig.Providers[0].Profiles = []*client.ProfileEntry{{Name: "admin", Username: "jane"}}
+		Expect(SaveConfig(ospreyconfig.Config, ospreyconfig.ConfigFile)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		cleanup()
+	})
+
+	loginWithProfile := func() {
+		login := Client("user", "login", ospreyconfigFlag, "--profile=admin", "--password=foo")
+		login.RunAndAssertSuccess()
+		Expect(login.GetOutput()).To(ContainSubstring("Logged in to: %s@admin", target))
+	}
+
+	It("logs in with the username of the profile to its own user and contexts", func() {
+		loginWithProfile()
+
+		Expect(kubeconfig.LoadConfig(ospreyconfig.Kubeconfig)).To(Succeed())
+		generatedConfig, err := kubeconfig.GetConfig()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(generatedConfig.AuthInfos).To(HaveKey(target + "@admin"))
+		Expect(generatedConfig.AuthInfos).NotTo(HaveKey(target))
+		Expect(generatedConfig.Clusters).To(HaveKey(target))
+		for _, context := range []string{target + "@admin", alias + "@admin"} {
+			Expect(generatedConfig.Contexts).To(HaveKey(context))
+			Expect(generatedConfig.Contexts[context].Cluster).To(Equal(target))
+			Expect(generatedConfig.Contexts[context].AuthInfo).To(Equal(target + "@admin"))
+		}
+	})
+
+	It("lists the user of every profile of the targets", func() {
+		loginWithProfile()
+
+		status := Client("user", "status", ospreyconfigFlag)
+		status.RunAndAssertSuccess()
+		Expect(status.GetOutput()).To(ContainSubstring("%s: none", target))
+		Expect(status.GetOutput()).To(ContainSubstring("%s@admin: ", target))
+		Expect(status.GetOutput()).NotTo(ContainSubstring("%s@admin: none", target))
+	})
+
+	It("switches to the context of the profile", func() {
+		loginWithProfile()
+
+		use := Client("use", ospreyconfigFlag, alias, "--profile=admin")
+		use.RunAndAssertSuccess()
+
+		Expect(kubeconfig.LoadConfig(ospreyconfig.Kubeconfig)).To(Succeed())
+		generatedConfig, err := kubeconfig.GetConfig()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(generatedConfig.CurrentContext).To(Equal(alias + "@admin"))
+	})
+
+	It("logs out of the profile only", func() {
+		login := Client("user", "login", ospreyconfigFlag, "--username=jane", "--password=foo")
+		login.RunAndAssertSuccess()
+		loginWithProfile()
+
+		logout := Client("user", "logout", ospreyconfigFlag, "--profile=admin")
+		logout.RunAndAssertSuccess()
+		Expect(logout.GetOutput()).To(ContainSubstring("Logged out from %s@admin", target))
+
+		user := Client("user", ospreyconfigFlag)
+		user.RunAndAssertSuccess()
+		Expect(user.GetOutput()).NotTo(ContainSubstring("%s: none", target))
+		user = Client("user", ospreyconfigFlag, "--profile=admin")
+		user.RunAndAssertSuccess()
+		Expect(user.GetOutput()).To(ContainSubstring("%s@admin: none", target))
+	})
+
+	It("fails for profiles that are not defined", func() {
+		login := Client("user", "login", ospreyconfigFlag, "--profile=unknown", "--username=jane", "--password=foo")
+		login.RunAndAssertFailure()
+
+		Expect(login.GetOutput()).To(ContainSubstring(`Profile "unknown" is not defined for provider osprey:provider-0`))
+	})
+})
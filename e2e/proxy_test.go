@@ -0,0 +1,94 @@
+package e2e
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/sky-uk/osprey/v2/client/kubeconfig"
+	. "github.com/sky-uk/osprey/v2/e2e/ospreytest"
+	"github.com/sky-uk/osprey/v2/e2e/proxytest"
+)
+
+var _ = Describe("Proxy", func() {
+	var (
+		proxy      *proxytest.Server
+		proxyURL   string
+		configFile string
+	)
+
+	writeConfig := func(providerProxyURL, targetProxyURL string) {
+		config := fmt.Sprintf(`apiVersion: v3
+kubeconfig: %s
+providers:
+  - type: osprey
+    certificate-authority: %s
+    proxy-url: %q
+    targets:
+      proxied:
+        server: %s
+        proxy-url: %q
+`, ospreyconfig.Kubeconfig, ospreys[0].CertFile, providerProxyURL, ospreys[0].URL, targetProxyURL)
+		configFile = filepath.Join(testDir, "proxy-config")
+		Expect(ioutil.WriteFile(configFile, []byte(config), 0644)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		resetDefaults()
+		var err error
+		proxy, err = proxytest.Start("proxyuser", "proxypass")
+		Expect(err).To(BeNil(), "starts the proxy")
+		proxyURL = fmt.Sprintf("http://proxyuser:proxypass@%s", strings.TrimPrefix(proxy.URL, "http://"))
+		setupClientForEnvironments(ospreyProviderName, environmentsToUse, "", "", false)
+	})
+
+	AfterEach(func() {
+		proxy.Stop()
+		cleanup()
+	})
+
+	assertLoginThroughProxy := func() {
+		login := Client("user", "login", "--ospreyconfig="+configFile, "--username=jane", "--password=foo")
+		login.RunAndAssertSuccess()
+
+		server, err := url.Parse(ospreys[0].URL)
+		Expect(err).To(BeNil())
+		Expect(proxy.ConnectCount(server.Host)).To(BeNumerically(">", 0), "requests the token through the proxy")
+
+		Expect(kubeconfig.LoadConfig(ospreyconfig.Kubeconfig)).To(Succeed())
+		generatedConfig, err := kubeconfig.GetConfig()
+		Expect(err).To(BeNil(), "successfully creates a kubeconfig")
+		Expect(generatedConfig.Clusters).To(HaveKey("proxied"))
+		Expect(generatedConfig.Clusters["proxied"].ProxyURL).To(Equal(proxyURL))
+	}
+
+	It("logs in through the provider's proxy", func() {
+		writeConfig(proxyURL, "")
+		assertLoginThroughProxy()
+	})
+
+	It("logs in through the target's proxy", func() {
+		writeConfig("", proxyURL)
+		assertLoginThroughProxy()
+	})
+
+	It("fails to log in with the wrong proxy credentials", func() {
+		writeConfig("", "http://proxyuser:wrong@"+strings.TrimPrefix(proxy.URL, "http://"))
+		login := Client("user", "login", "--ospreyconfig="+configFile, "--username=jane", "--password=foo")
+		login.RunAndAssertFailure()
+
+		Expect(login.GetOutput()).To(ContainSubstring("Proxy Authentication Required"))
+	})
+
+	It("rejects unsupported proxy schemes", func() {
+		writeConfig("ftp://proxy.example.com", "")
+		targets := Client("config", "targets", "--ospreyconfig="+configFile)
+		targets.RunAndAssertFailure()
+
+		Expect(targets.GetOutput()).To(ContainSubstring("the scheme must be one of http, https or socks5"))
+	})
+})
@@ -0,0 +1,105 @@
+package proxytest
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+)
+
+// Server is an HTTP proxy that tunnels CONNECT requests and counts them per destination
+type Server struct {
+	URL        string
+	username   string
+	password   string
+	listener   net.Listener
+	httpServer *http.Server
+	mu         sync.Mutex
+	connects   map[string]int
+}
+
+// Start starts a proxy on a random local port. If username is not empty, clients must authenticate with
+// the username and password.
+func Start(username, password string) (*Server, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen: %w", err)
+	}
+	server := &Server{
+		URL:      "http://" + listener.Addr().String(),
+		username: username,
+		password: password,
+		listener: listener,
+		connects: make(map[string]int),
+	}
+	server.httpServer = &http.Server{Handler: http.HandlerFunc(server.handleConnect)}
+	go server.httpServer.Serve(listener)
+	return server, nil
+}
+
+// ConnectCount returns the number of tunnels opened to the host:port destination
+func (s *Server) ConnectCount(destination string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.connects[destination]
+}
+
+// Reset clears the tunnel counts
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.connects = make(map[string]int)
+}
+
+// Stop closes the proxy
+func (s *Server) Stop() {
+	s.httpServer.Close()
+}
+
+func (s *Server) handleConnect(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodConnect {
+		http.Error(w, "only CONNECT is supported", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.username != "" {
+		credentials := base64.StdEncoding.EncodeToString([]byte(s.username + ":" + s.password))
+		if r.Header.Get("Proxy-Authorization") != "Basic "+credentials {
+			w.Header().Set("Proxy-Authenticate", `Basic realm="proxytest"`)
+			http.Error(w, "proxy authentication required", http.StatusProxyAuthRequired)
+			return
+		}
+	}
+
+	destination, err := net.Dial("tcp", r.Host)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		destination.Close()
+		http.Error(w, "hijacking not supported", http.StatusInternalServerError)
+		return
+	}
+	source, _, err := hijacker.Hijack()
+	if err != nil {
+		destination.Close()
+		return
+	}
+
+	s.mu.Lock()
+	s.connects[r.Host]++
+	s.mu.Unlock()
+
+	source.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+	go tunnel(destination, source)
+	go tunnel(source, destination)
+}
+
+func tunnel(dst, src net.Conn) {
+	defer dst.Close()
+	defer src.Close()
+	io.Copy(dst, src)
+}
@@ -0,0 +1,153 @@
+package e2e
+
+import (
+	"fmt"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/sky-uk/osprey/v2/client/kubeconfig"
+	"github.com/sky-uk/osprey/v2/e2e/clitest"
+	. "github.com/sky-uk/osprey/v2/e2e/ospreytest"
+)
+
+var _ = Describe("Target selectors", func() {
+	var selectorFlags []string
+
+	BeforeEach(func() {
+		resetDefaults()
+		selectorFlags = nil
+	})
+
+	JustBeforeEach(func() {
+		setupClientForEnvironments(ospreyProviderName, environmentsToUse, "", "", false)
+	})
+
+	AfterEach(func() {
+		cleanup()
+	})
+
+	targetsCommand := func() clitest.TestCommand {
+		return Client(append([]string{"config", "targets", ospreyconfigFlag}, selectorFlags...)...)
+	}
+
+	AssertTargets := func(environments ...string) {
+		It("displays only the selected targets", func() {
+			targets := targetsCommand()
+			targets.RunAndAssertSuccess()
+
+			var expectedOutputLines []string
+			for _, environment := range environments {
+				highlight := " "
+				if environment == "local" {
+					highlight = "*"
+				}
+				expectedOutputLines = append(expectedOutputLines, fmt.Sprintf("%s %s", highlight, OspreyTargetOutput(environment)))
+			}
+			Expect(targets.GetStdout()).To(Equal(fmt.Sprintf("Configured targets:\n%s\n", strings.Join(expectedOutputLines, "\n"))))
+		})
+
+		It("logs in to the selected targets only", func() {
+			login := Client(append([]string{"user", "login", ospreyconfigFlag, "--username=jane", "--password=foo"}, selectorFlags...)...)
+			login.RunAndAssertSuccess()
+
+			err := kubeconfig.LoadConfig(ospreyconfig.Kubeconfig)
+			Expect(err).To(BeNil(), "successfully creates a kubeconfig")
+			generatedConfig, err := kubeconfig.GetConfig()
+			Expect(err).To(BeNil(), "successfully creates a kubeconfig")
+
+			Expect(generatedConfig.Clusters).To(HaveLen(len(environments)))
+			for _, environment := range environments {
+				Expect(generatedConfig.Clusters).To(HaveKey(OspreyconfigTargetName(environment)))
+			}
+		})
+	}
+
+	Context("by target name", func() {
+		BeforeEach(func() {
+			selectorFlags = []string{"--target=" + OspreyconfigTargetName("prod"), "--target=" + OspreyconfigTargetName("dev")}
+		})
+
+		AssertTargets("dev", "prod")
+	})
+
+	Context("by alias", func() {
+		BeforeEach(func() {
+			selectorFlags = []string{"--target=" + OspreyconfigAliasName("stage")}
+		})
+
+		AssertTargets("stage")
+	})
+
+	Context("by glob pattern", func() {
+		BeforeEach(func() {
+			selectorFlags = []string{"--target=" + OspreyconfigTargetName("s*")}
+		})
+
+		AssertTargets("sandbox", "stage")
+	})
+
+	Context("by label selector", func() {
+		BeforeEach(func() {
+			selectorFlags = []string{"--group=development,production", "--selector=env in (dev,prod,stage),env!=stage"}
+		})
+
+		AssertTargets("dev", "prod")
+	})
+
+	Context("by label selector only", func() {
+		BeforeEach(func() {
+			selectorFlags = []string{"-l", "env in (dev,prod)"}
+		})
+
+		AssertTargets("dev", "prod")
+	})
+
+	It("narrows down a group with a label selector", func() {
+		user := Client("user", ospreyconfigFlag, "--group=development", "-l", "env=stage")
+		user.RunAndAssertSuccess()
+
+		Expect(user.GetOutput()).To(ContainSubstring("%s: none", OspreyconfigTargetName("stage")))
+		Expect(user.GetOutput()).ToNot(ContainSubstring(OspreyconfigTargetName("dev")))
+	})
+
+	It("selects the union of comma-separated groups", func() {
+		user := Client("user", ospreyconfigFlag, "--group=production,sandbox")
+		user.RunAndAssertSuccess()
+
+		for _, environment := range []string{"prod", "sandbox"} {
+			Expect(user.GetOutput()).To(ContainSubstring("%s: none", OspreyconfigTargetName(environment)))
+		}
+		Expect(user.GetOutput()).ToNot(ContainSubstring(OspreyconfigTargetName("dev")))
+	})
+
+	It("selects all the targets", func() {
+		user := Client("user", ospreyconfigFlag, "--all")
+		user.RunAndAssertSuccess()
+
+		for environment := range environmentsToUse {
+			Expect(user.GetOutput()).To(ContainSubstring("%s: none", OspreyconfigTargetName(environment)))
+		}
+	})
+
+	It("fails when a target does not match", func() {
+		user := Client("user", ospreyconfigFlag, "--target=non-existent")
+		user.RunAndAssertFailure()
+
+		Expect(user.GetOutput()).To(ContainSubstring(`no targets match "non-existent"`))
+	})
+
+	It("fails with an invalid label selector", func() {
+		user := Client("user", ospreyconfigFlag, "-l", "env in (prod")
+		user.RunAndAssertFailure()
+
+		Expect(user.GetOutput()).To(ContainSubstring("invalid label selector"))
+	})
+
+	It("fails when a group of the list does not exist", func() {
+		user := Client("user", ospreyconfigFlag, "--group=production,non-existent")
+		user.RunAndAssertFailure()
+
+		Expect(user.GetOutput()).To(ContainSubstring(`Group not found: "non-existent"`))
+	})
+})
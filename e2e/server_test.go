@@ -104,4 +104,37 @@ var _ = Describe("Server", func() {
 		})
 
 	})
+
+	Context("IP family", func() {
+		// the test dex only listens on the IPv4 loopback address
+		startLocalOspreyWithIPFamily := func(ipFamily string) {
+			localOsprey = ospreytest.StartWithOptions(testDir, true, ospreyPort, localDex, ospreytest.ServerOptions{IPFamily: ipFamily})
+			time.Sleep(100 * time.Millisecond)
+			localOsprey.AssertStillRunning()
+		}
+
+		AfterEach(func() {
+			localOsprey.Stop()
+			localOsprey.AssertStoppedRunning()
+			localOsprey.AssertSuccess()
+		})
+
+		It("Should reach the issuer over ipv4", func() {
+			startLocalOspreyWithIPFamily("ipv4")
+
+			resp, err := localOsprey.CallHealthcheck()
+
+			Expect(err).To(BeNil(), "called healthcheck")
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		})
+
+		It("Should not reach an ipv4 only issuer over ipv6", func() {
+			startLocalOspreyWithIPFamily("ipv6")
+
+			resp, err := localOsprey.CallHealthcheck()
+
+			Expect(err).To(BeNil(), "called healthcheck")
+			Expect(resp.StatusCode).To(Equal(http.StatusServiceUnavailable))
+		})
+	})
 })
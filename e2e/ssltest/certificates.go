@@ -8,6 +8,7 @@ import (
 	"encoding/pem"
 	"fmt"
 	"math/big"
+	"net"
 	"os"
 	"time"
 )
@@ -15,8 +16,19 @@ import (
 // CreateCertificates creates an RSA private key and a self signed certificate to use for TLS.
 // Writes the pem encoded files to disk and returns the locations for the files.
 func CreateCertificates(cn, destDir string) (certFile, keyFile string) {
-	keyFile = fmt.Sprintf("%s/%sserver.key", destDir, cn)
-	certFile = fmt.Sprintf("%s/%sserver.crt", destDir, cn)
+	return createCertificates(cn, destDir, "server", x509.ExtKeyUsageServerAuth)
+}
+
+// CreateClientCertificates creates an RSA private key and a self signed certificate to use as a TLS client
+// certificate. The certificate is also its own CA.
+// Writes the pem encoded files to disk and returns the locations for the files.
+func CreateClientCertificates(cn, destDir string) (certFile, keyFile string) {
+	return createCertificates(cn, destDir, "client", x509.ExtKeyUsageClientAuth)
+}
+
+func createCertificates(cn, destDir, suffix string, extKeyUsage x509.ExtKeyUsage) (certFile, keyFile string) {
+	keyFile = fmt.Sprintf("%s/%s%s.key", destDir, cn, suffix)
+	certFile = fmt.Sprintf("%s/%s%s.crt", destDir, cn, suffix)
 
 	if err := checkPemPair(keyFile, certFile); err != nil {
 		if err := os.MkdirAll(destDir, 0755); err != nil {
@@ -29,12 +41,13 @@ func CreateCertificates(cn, destDir string) (certFile, keyFile string) {
 			Subject: pkix.Name{
 				CommonName: cn,
 			},
-			DNSNames: []string{cn},
+			DNSNames:    []string{cn},
+			IPAddresses: loopbackAddresses(cn),
 
 			NotBefore: time.Now(),
 			NotAfter:  time.Now().Add(1 * time.Hour),
 
-			ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+			ExtKeyUsage: []x509.ExtKeyUsage{extKeyUsage},
 			KeyUsage:    x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
 		}
 
@@ -55,6 +68,15 @@ func CreateCertificates(cn, destDir string) (certFile, keyFile string) {
 	return certFile, keyFile
 }
 
+// loopbackAddresses returns the IPv4 and IPv6 loopback addresses for localhost, so servers can be reached
+// on 127.0.0.1 and [::1] as well
+func loopbackAddresses(cn string) []net.IP {
+	if cn != "localhost" {
+		return nil
+	}
+	return []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback}
+}
+
 func writePem(filename, pemType string, content []byte) {
 	pemFile, err := os.Create(filename)
 	if err != nil {
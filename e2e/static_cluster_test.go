@@ -0,0 +1,129 @@
+package e2e
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/sky-uk/osprey/v2/client"
+	"github.com/sky-uk/osprey/v2/client/kubeconfig"
+	"github.com/sky-uk/osprey/v2/e2e/apiservertest"
+	. "github.com/sky-uk/osprey/v2/e2e/ospreytest"
+	"k8s.io/client-go/tools/clientcmd/api"
+)
+
+var _ = Describe("Static cluster details", func() {
+	const staticAPIServerURL = "https://static.cluster:6443"
+
+	BeforeEach(func() {
+		resetDefaults()
+	})
+
+	AfterEach(func() {
+		oidcTestServer.Reset()
+		apiTestServer.Reset()
+		cleanup()
+	})
+
+	// configure sets the static cluster details on all the targets, on top of their discovery endpoint if keepServer
+	configure := func(keepServer bool, configureTarget func(target *client.TargetEntry)) {
+		for _, target := range ospreyconfig.Providers[0].Targets {
+			if !keepServer {
+				target.Server = ""
+				target.APIServer = ""
+			}
+			target.APIServerURL = staticAPIServerURL
+			configureTarget(target)
+		}
+		Expect(SaveConfig(ospreyconfig.Config, ospreyconfig.ConfigFile)).To(Succeed())
+	}
+
+	getCluster := func(name string) *api.Cluster {
+		Expect(kubeconfig.LoadConfig(ospreyconfig.Kubeconfig)).To(Succeed())
+		generatedConfig, err := kubeconfig.GetConfig()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(generatedConfig.Clusters).To(HaveKey(name))
+		return generatedConfig.Clusters[name]
+	}
+
+	Context("azure targets", func() {
+		BeforeEach(func() {
+			setupClientForEnvironments(azureProviderName, environmentsToUse, oidcClientID, "", false)
+		})
+
+		It("writes the static cluster details to the kubeconfig without any discovery", func() {
+			configure(false, func(target *client.TargetEntry) {
+				target.APIServerCAData = base64.StdEncoding.EncodeToString([]byte(apiservertest.CaCert1Pem))
+				target.TLSServerName = "kubernetes.default.svc"
+				target.DisableCompression = true
+			})
+
+			login := loginCommand(ospreyBinary, "user", "login", ospreyconfigFlag, "--disable-browser-popup")
+			_, err := doOIDCMockRequest("/v2.0/authorize", oidcClientID, oidcRedirectURI, []string{"api://some-dummy-scope"})
+			Expect(err).NotTo(HaveOccurred())
+			login.AssertSuccess()
+
+			cluster := getCluster(OspreyconfigTargetName("local"))
+			Expect(cluster.Server).To(Equal(staticAPIServerURL))
+			Expect(cluster.CertificateAuthorityData).To(Equal([]byte(apiservertest.CaCert1Pem)))
+			Expect(cluster.TLSServerName).To(Equal("kubernetes.default.svc"))
+			Expect(cluster.DisableCompression).To(BeTrue())
+			Expect(apiTestServer.RequestCount("/api/v1/namespaces/kube-public/configmaps/kube-root-ca.crt")).To(Equal(0))
+		})
+
+		It("requires exactly one discovery mode", func() {
+			configure(false, func(target *client.TargetEntry) {
+				target.APIServer = fmt.Sprintf("http://localhost:%d", apiServerPort)
+				target.APIServerCAData = base64.StdEncoding.EncodeToString([]byte(apiservertest.CaCert1Pem))
+			})
+
+			targets := Client("config", "targets", ospreyconfigFlag)
+			targets.RunAndAssertFailure()
+			Expect(targets.GetOutput()).To(ContainSubstring("exactly one of server, api-server or api-server-url must be set"))
+		})
+
+		It("requires the CA of the api-server-url", func() {
+			configure(false, func(_ *client.TargetEntry) {})
+
+			targets := Client("config", "targets", ospreyconfigFlag)
+			targets.RunAndAssertFailure()
+			Expect(targets.GetOutput()).To(ContainSubstring("api-server-url requires api-server-ca or api-server-ca-data"))
+		})
+
+		It("requires an https api-server-url", func() {
+			configure(false, func(target *client.TargetEntry) {
+				target.APIServerURL = "http://static.cluster"
+				target.APIServerCAData = base64.StdEncoding.EncodeToString([]byte(apiservertest.CaCert1Pem))
+			})
+
+			targets := Client("config", "targets", ospreyconfigFlag)
+			targets.RunAndAssertFailure()
+			Expect(targets.GetOutput()).To(ContainSubstring("must be an https URL"))
+		})
+	})
+
+	Context("osprey targets", func() {
+		BeforeEach(func() {
+			setupClientForEnvironments(ospreyProviderName, environmentsToUse, "", "", false)
+		})
+
+		It("overrides the cluster details of the osprey server", func() {
+			var caFile string
+			configure(true, func(target *client.TargetEntry) {
+				caFile = target.CertificateAuthority
+				target.APIServerCA = caFile
+			})
+
+			login := Client("user", "login", ospreyconfigFlag, "--username=jane", "--password=foo")
+			login.RunAndAssertSuccess()
+
+			caData, err := ioutil.ReadFile(ospreyconfig.Providers[0].Targets[OspreyconfigTargetName("local")].CertificateAuthority)
+			Expect(err).NotTo(HaveOccurred())
+			cluster := getCluster(OspreyconfigTargetName("local"))
+			Expect(cluster.Server).To(Equal(staticAPIServerURL))
+			Expect(cluster.CertificateAuthorityData).To(Equal(caData))
+		})
+	})
+})
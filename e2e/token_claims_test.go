@@ -0,0 +1,131 @@
+package e2e
+
+import (
+	"github.com/SermoDigital/jose/jws"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/sky-uk/osprey/v2/client/kubeconfig"
+	"github.com/sky-uk/osprey/v2/e2e/clitest"
+	. "github.com/sky-uk/osprey/v2/e2e/ospreytest"
+)
+
+var _ = Describe("Token claims", func() {
+	var target string
+	var userLoginArgs []string
+
+	BeforeEach(func() {
+		resetDefaults()
+		target = OspreyconfigTargetName("local")
+	})
+
+	JustBeforeEach(func() {
+		setupClientForEnvironments(azureProviderName, environmentsToUse, oidcClientID, apiServerURL, false)
+		userLoginArgs = []string{"user", "login", ospreyconfigFlag, "--disable-browser-popup"}
+	})
+
+	AfterEach(func() {
+		oidcTestServer.Reset()
+		apiTestServer.Reset()
+		forgetKnownCAs()
+		clearClusterCache()
+		forgetAccounts()
+		cleanup()
+	})
+
+	setClaims := func(tokenType, usernameClaim, groupsClaim string) {
+		ospreyconfig.Providers[0].TokenType = tokenType
+		ospreyconfig.Providers[0].UsernameClaim = usernameClaim
+		ospreyconfig.Providers[0].GroupsClaim = groupsClaim
+		Expect(SaveConfig(ospreyconfig.Config, ospreyconfig.ConfigFile)).To(Succeed())
+	}
+
+	login := func() clitest.AsyncTestCommand {
+		login := loginCommand(ospreyBinary, userLoginArgs...)
+		_, err := doOIDCMockRequest("/v2.0/authorize", oidcClientID, oidcRedirectURI, []string{"api://some-dummy-scope"})
+		Expect(err).NotTo(HaveOccurred())
+		return login
+	}
+
+	writtenTokenClaim := func(claim string) interface{} {
+		Expect(kubeconfig.LoadConfig(ospreyconfig.Kubeconfig)).To(Succeed())
+		generatedConfig, err := kubeconfig.GetConfig()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(generatedConfig.AuthInfos).To(HaveKey(target))
+		jwt, err := jws.ParseJWT([]byte(generatedConfig.AuthInfos[target].Token))
+		Expect(err).NotTo(HaveOccurred())
+		return jwt.Claims().Get(claim)
+	}
+
+	It("writes the access token by default", func() {
+		login().AssertSuccess()
+
+		Expect(writtenTokenClaim("unique_name")).To(Equal("john.doe@osprey.org"))
+	})
+
+	It("writes the id token for the token-type id", func() {
+		setClaims("id", "email", "")
+
+		login().AssertSuccess()
+
+		Expect(writtenTokenClaim("aud")).To(Equal(oidcClientID))
+		Expect(writtenTokenClaim("email")).To(Equal("john.doe@osprey.org"))
+	})
+
+	It("shows the username and groups of the claims of the provider", func() {
+		setClaims("id", "preferred_username", "roles")
+		login().AssertSuccess()
+
+		user := Client("user", ospreyconfigFlag)
+		user.RunAndAssertSuccess()
+		Expect(user.GetOutput()).To(ContainSubstring("%s: jdoe [cluster-viewers]", target))
+	})
+
+	It("refuses the tokens without the username claim", func() {
+		setClaims("", "email", "")
+
+		login := login()
+		login.AssertFailure()
+		Expect(login.GetOutput()).To(ContainSubstring(`the token has no "email" claim, set the username-claim of the provider`))
+	})
+
+	It("rejects invalid token types", func() {
+		setClaims("refresh", "", "")
+
+		login := Client(userLoginArgs...)
+		login.RunAndAssertFailure()
+		Expect(login.GetOutput()).To(ContainSubstring(`invalid token-type "refresh", must be id or access`))
+	})
+})
+
+var _ = Describe("Token claims of osprey providers", func() {
+	BeforeEach(func() {
+		resetDefaults()
+	})
+
+	JustBeforeEach(func() {
+		setupClientForEnvironments(ospreyProviderName, environmentsToUse, "", "", false)
+	})
+
+	AfterEach(func() {
+		cleanup()
+	})
+
+	It("shows a groups claim holding a single group", func() {
+		ospreyconfig.Providers[0].GroupsClaim = "email"
+		Expect(SaveConfig(ospreyconfig.Config, ospreyconfig.ConfigFile)).To(Succeed())
+		Client("user", "login", ospreyconfigFlag, "--username=jane", "--password=foo").RunAndAssertSuccess()
+
+		user := Client("user", ospreyconfigFlag)
+		user.RunAndAssertSuccess()
+		Expect(user.GetOutput()).To(ContainSubstring("janedoe@example.com [janedoe@example.com]"))
+	})
+
+	It("rejects the token-type access", func() {
+		ospreyconfig.Providers[0].TokenType = "access"
+		Expect(SaveConfig(ospreyconfig.Config, ospreyconfig.ConfigFile)).To(Succeed())
+
+		login := Client("user", "login", ospreyconfigFlag, "--username=jane", "--password=foo")
+		login.RunAndAssertFailure()
+		Expect(login.GetOutput()).To(ContainSubstring("token-type access is only supported for azure providers"))
+	})
+})
@@ -0,0 +1,116 @@
+package e2e
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/sky-uk/osprey/v2/client"
+	"github.com/sky-uk/osprey/v2/client/kubeconfig"
+	. "github.com/sky-uk/osprey/v2/e2e/ospreytest"
+)
+
+var _ = Describe("Token verification", func() {
+	var userLoginArgs []string
+
+	BeforeEach(func() {
+		resetDefaults()
+	})
+
+	JustBeforeEach(func() {
+		setupClientForEnvironments(azureProviderName, environmentsToUse, oidcClientID, apiServerURL, false)
+		userLoginArgs = []string{"user", "login", ospreyconfigFlag, "--disable-browser-popup"}
+	})
+
+	AfterEach(func() {
+		oidcTestServer.Reset()
+		apiTestServer.Reset()
+		forgetKnownCAs()
+		clearClusterCache()
+		forgetAccounts()
+		cleanup()
+	})
+
+	assertNotLoggedIn := func() {
+		Expect(kubeconfig.LoadConfig(ospreyconfig.Kubeconfig)).To(Succeed())
+		generatedConfig, err := kubeconfig.GetConfig()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(generatedConfig.AuthInfos).NotTo(HaveKey(OspreyconfigTargetName("local")))
+	}
+
+	It("writes the tokens issued for the server-application-id", func() {
+		login := loginCommand(ospreyBinary, userLoginArgs...)
+		_, err := doOIDCMockRequest("/v2.0/authorize", oidcClientID, oidcRedirectURI, []string{"api://some-dummy-scope"})
+		Expect(err).NotTo(HaveOccurred())
+
+		login.AssertSuccess()
+	})
+
+	It("refuses the tokens issued for another audience", func() {
+		ospreyconfig.Providers[0].Azure.ServerApplicationID = "other-server-application-id"
+		Expect(SaveConfig(ospreyconfig.Config, ospreyconfig.ConfigFile)).To(Succeed())
+
+		login := loginCommand(ospreyBinary, userLoginArgs...)
+		_, err := doOIDCMockRequest("/v2.0/authorize", oidcClientID, oidcRedirectURI, []string{"api://some-dummy-scope"})
+		Expect(err).NotTo(HaveOccurred())
+
+		login.AssertFailure()
+		Expect(login.GetOutput()).To(ContainSubstring(`the token is for the audience "some-server-application-id" instead of the server-application-id "other-server-application-id"`))
+		assertNotLoggedIn()
+	})
+
+	It("refuses the expired tokens", func() {
+		oidcTestServer.SetExpiredTokens(true)
+
+		login := loginCommand(ospreyBinary, userLoginArgs...)
+		_, err := doOIDCMockRequest("/v2.0/authorize", oidcClientID, oidcRedirectURI, []string{"api://some-dummy-scope"})
+		Expect(err).NotTo(HaveOccurred())
+
+		login.AssertFailure()
+		Expect(login.GetOutput()).To(ContainSubstring("the token expired at"))
+		assertNotLoggedIn()
+	})
+})
+
+var _ = Describe("Token verification of osprey providers", func() {
+	BeforeEach(func() {
+		resetDefaults()
+	})
+
+	JustBeforeEach(func() {
+		setupClientForEnvironments(ospreyProviderName, environmentsToUse, "", "", false)
+	})
+
+	AfterEach(func() {
+		cleanup()
+	})
+
+	It("logs in with the issuer and client id pinned to the osprey servers' ones", func() {
+		for _, osprey := range targetedOspreys {
+			target := ospreyconfig.Providers[0].Targets[osprey.OspreyconfigTargetName()]
+			target.IssuerURL = osprey.IssuerURL
+			target.ClientID = osprey.Environment
+		}
+		Expect(SaveConfig(ospreyconfig.Config, ospreyconfig.ConfigFile)).To(Succeed())
+
+		Client("user", "login", ospreyconfigFlag, "--username=jane", "--password=foo").RunAndAssertSuccess()
+	})
+
+	It("refuses the osprey servers naming another issuer than the pinned one", func() {
+		ospreyconfig.Providers[0].Osprey = &client.OspreyOptions{IssuerURL: "https://other.issuer"}
+		Expect(SaveConfig(ospreyconfig.Config, ospreyconfig.ConfigFile)).To(Succeed())
+
+		login := Client("user", "login", ospreyconfigFlag, "--username=jane", "--password=foo")
+		login.RunAndAssertFailure()
+		Expect(login.GetOutput()).To(ContainSubstring(`instead of the issuer-url "https://other.issuer"`))
+	})
+
+	It("refuses the osprey servers naming another client id than the pinned one", func() {
+		for _, osprey := range targetedOspreys {
+			ospreyconfig.Providers[0].Targets[osprey.OspreyconfigTargetName()].ClientID = "other-client"
+		}
+		Expect(SaveConfig(ospreyconfig.Config, ospreyconfig.ConfigFile)).To(Succeed())
+
+		login := Client("user", "login", ospreyconfigFlag, "--username=jane", "--password=foo")
+		login.RunAndAssertFailure()
+		Expect(login.GetOutput()).To(ContainSubstring(`instead of the client-id "other-client"`))
+	})
+})
@@ -2,10 +2,15 @@ package web
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
@@ -31,6 +36,38 @@ func NewServer(port int32, tlsCertFile, tlsKeyFile string, shutdownGracePeriod t
 	}
 }
 
+// RequireClientCertificates makes the server verify the client certificates against the CA certs in the
+// PEM-encoded clientCAFile, and rejects the /access-token requests without a valid one.
+// It requires the server to be configured with TLS.
+func (s *Server) RequireClientCertificates(clientCAFile string) error {
+	if s.tlsCertFile == "" {
+		return errors.New("client certificates require TLS, set the tls-cert and tls-key")
+	}
+	data, err := os.ReadFile(clientCAFile)
+	if err != nil {
+		return fmt.Errorf("failed to read client CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	var subjects []string
+	for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return fmt.Errorf("failed to parse client CA %s: %w", clientCAFile, err)
+		}
+		pool.AddCert(cert)
+		subjects = append(subjects, cert.Subject.String())
+	}
+	if len(subjects) == 0 {
+		return fmt.Errorf("no certificates found in client CA %s", clientCAFile)
+	}
+	log.Infof("Requiring client certificates for /access-token signed by: %s", strings.Join(subjects, "; "))
+	s.clientCAs = pool
+	return nil
+}
+
 // Start starts a new HTTP server listening at the specified port. If the server configuration
 // contains tls data, it will start the server with TLS enabled.
 // Start is a blocking method that listens for SIGINT or SIGTERM to start a graceful shutdown,
@@ -75,6 +112,7 @@ type Server struct {
 	mux                   *http.ServeMux
 	authenticationEnabled bool
 	serveClusterInfo      bool
+	clientCAs             *x509.CertPool
 }
 
 // RegisterService binds the http endpoints to the Osprey services
@@ -85,16 +123,44 @@ func (s *Server) RegisterService(service osprey.Osprey) {
 		s.mux.Handle("/cluster-info", handleClusterInfo(service))
 	}
 	if s.authenticationEnabled {
-		s.mux.Handle("/access-token", handleAccessToken(service))
+		s.mux.Handle("/access-token", requireClientCertificate(s.clientCAs != nil, handleAccessToken(service)))
 		s.mux.Handle("/callback", handleCallback(service))
 	}
 }
 
 func setup(server *Server) *http.Server {
-	return &http.Server{
+	httpServer := &http.Server{
 		Addr:    server.addr,
 		Handler: server.mux,
 	}
+	if server.clientCAs != nil {
+		// health checks and the issuer's callbacks come without client certificates, so they are only
+		// required by the handlers that need them
+		httpServer.TLSConfig = &tls.Config{
+			ClientCAs:  server.clientCAs,
+			ClientAuth: tls.VerifyClientCertIfGiven,
+		}
+	}
+	return httpServer
+}
+
+// requireClientCertificate rejects the requests without a verified client certificate, when required,
+// and logs the subject of the accepted ones.
+func requireClientCertificate(required bool, next http.HandlerFunc) http.HandlerFunc {
+	if !required {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+			log.Warnf("Rejected %s request from %s without a valid client certificate", r.URL.Path, r.RemoteAddr)
+			w.Header().Add("Content-Type", "application/octet-stream")
+			handleResponse(w, nil, status.Error(codes.Unauthenticated, "a valid client certificate is required"))
+			return
+		}
+		log.Infof("Accepted %s request from %s with client certificate %q", r.URL.Path, r.RemoteAddr,
+			r.TLS.VerifiedChains[0][0].Subject.String())
+		next(w, r)
+	}
 }
 
 func handleAccessToken(osprey osprey.Osprey) http.HandlerFunc {